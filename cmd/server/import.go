@@ -0,0 +1,147 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/developmeh/mock-cors-server/internal/config"
+	"github.com/developmeh/mock-cors-server/internal/har"
+	"github.com/developmeh/mock-cors-server/internal/importer"
+	"github.com/spf13/cobra"
+)
+
+var (
+	importOutput string
+	importBodies string
+	importHost   string
+)
+
+// importCmd groups the commands generating routes from other formats
+var importCmd = &cobra.Command{
+	Use:   "import",
+	Short: "Generate routes from API descriptions and captured traffic",
+	Long: `Generate a routes file from an API description or captured traffic. The file
+can be listed under include in a configuration, or edited and copied into it.`,
+}
+
+// importOpenAPICmd generates routes from an OpenAPI 3 spec
+var importOpenAPICmd = &cobra.Command{
+	Use:   "openapi <spec>",
+	Short: "Generate routes from an OpenAPI 3 spec",
+	Long: `Create a json route for every operation of an OpenAPI 3 spec in YAML or JSON.
+Each route answers the operation's method with its first 2xx response, or the
+default response, including the declared response headers. Bodies come from the
+response examples, or are generated from the response schema. Path parameters
+become wildcards, e.g. /users/{id}.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		doc, err := importer.LoadOpenAPI(args[0])
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+
+		routes, warnings := importer.OpenAPIRoutes(doc)
+		for _, warning := range warnings {
+			fmt.Fprintf(os.Stderr, "Warning: %s\n", warning)
+		}
+		writeRoutes(routes, importOutput)
+	},
+}
+
+// importHARCmd generates routes from a HAR file
+var importHARCmd = &cobra.Command{
+	Use:   "har <file.har>",
+	Short: "Generate routes from a HAR file",
+	Long: `Create a route for every request captured in a HAR file, as saved from the
+network panel of the browser developer tools. Each route answers the request's
+method and path with the recorded status, headers and body. The first response
+is kept when a request was made several times, and CORS preflights are left out.
+Bodies are written to files next to the routes file.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		log, err := har.Read(args[0])
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+
+		captures, warnings := importer.HAR(log, importHost)
+		writeCaptures(captures, warnings)
+	},
+}
+
+// importPostmanCmd generates routes from a Postman collection
+var importPostmanCmd = &cobra.Command{
+	Use:   "postman <collection.json>",
+	Short: "Generate routes from the examples of a Postman collection",
+	Long: `Create a route for every example response saved in a Postman collection (v2.0
+or v2.1). Each route answers the example's method and path with its status,
+headers and body; path variables such as :id become wildcards. Requests without
+examples are skipped. Bodies are written to files next to the routes file.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		captures, warnings, err := importer.Postman(args[0])
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		writeCaptures(captures, warnings)
+	},
+}
+
+// writeCaptures writes the bodies of captured responses and their routes
+func writeCaptures(captures []importer.Capture, warnings []string) {
+	base := "."
+	if importOutput != "" {
+		base = filepath.Dir(importOutput)
+	}
+	dir := importBodies
+	if dir == "" {
+		dir = filepath.Join(base, "bodies")
+	}
+
+	routes, bodyWarnings, err := importer.WriteBodies(captures, dir, base)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	for _, warning := range append(warnings, bodyWarnings...) {
+		fmt.Fprintf(os.Stderr, "Warning: %s\n", warning)
+	}
+	writeRoutes(routes, importOutput)
+}
+
+// writeRoutes writes routes as YAML to a file, or to stdout when file is
+// empty, exiting on failure
+func writeRoutes(routes []config.Route, file string) {
+	data, err := config.EncodeRoutes(routes)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	if file == "" {
+		os.Stdout.Write(data)
+		return
+	}
+	if err := os.WriteFile(file, data, 0644); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to write %s: %v\n", file, err)
+		os.Exit(1)
+	}
+	fmt.Fprintf(os.Stderr, "Wrote %d routes to %s\n", len(routes), file)
+}
+
+func init() {
+	importCmd.PersistentFlags().StringVarP(&importOutput, "output", "o", "", "routes file to write (default is stdout)")
+	importCmd.AddCommand(importOpenAPICmd)
+
+	for _, cmd := range []*cobra.Command{importHARCmd, importPostmanCmd} {
+		cmd.Flags().StringVar(&importBodies, "bodies", "", "directory for response bodies (default is bodies next to the routes file)")
+		importCmd.AddCommand(cmd)
+	}
+	importHARCmd.Flags().StringVar(&importHost, "host", "", "only import requests to this host, e.g. api.example.com")
+	rootCmd.AddCommand(importCmd)
+}
@@ -4,17 +4,17 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"reflect"
+	"strings"
 
 	"github.com/developmeh/mock-cors-server/internal/config"
 	"github.com/developmeh/mock-cors-server/pkg/server"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
 )
 
-var (
-	cfgFile string
-	port    int
-)
+var cfgFile string
 
 // rootCmd represents the base command when called without any subcommands
 var rootCmd = &cobra.Command{
@@ -23,15 +23,13 @@ var rootCmd = &cobra.Command{
 	Long: `A dummy HTTP mock CORS server that provides configurable routes and CORS settings.
 This server is designed for testing and development purposes.`,
 	Run: func(cmd *cobra.Command, args []string) {
-		// Load configuration
+		// Load configuration; flags are applied by LoadConfig through viper
 		cfg, err := config.LoadConfig()
 		if err != nil {
 			log.Fatalf("Failed to load configuration: %v", err)
 		}
-
-		// Override port if provided via flag
-		if port != 0 {
-			cfg.Port = port
+		if file := viper.ConfigFileUsed(); file != "" {
+			fmt.Fprintln(os.Stderr, "Using config file:", file)
 		}
 
 		// Create and start server
@@ -54,35 +52,51 @@ func init() {
 	cobra.OnInitialize(initConfig)
 
 	// Global flags
-	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.dummy_http_passkeys/config.yaml)")
-	rootCmd.PersistentFlags().IntVarP(&port, "port", "p", 0, "port to run the server on")
+	flags := rootCmd.PersistentFlags()
+	flags.StringVar(&cfgFile, "config", "", "config file in YAML, JSON, TOML or HCL (default is $HOME/.dummy_http_passkeys/config.yaml)")
+	flags.IntP("port", "p", 0, "port to run the server on")
+	flags.StringP("env", "e", "", "environment overlay merged over the config file (e.g. staging reads config.staging.yaml)")
+	viper.BindPFlag("env", flags.Lookup("env"))
 
-	// Bind flags to viper
-	viper.BindPFlag("port", rootCmd.PersistentFlags().Lookup("port"))
+	// Every other global setting gets a flag named after its key, e.g.
+	// cors.allow_origins becomes --cors-allow-origins
+	for _, override := range config.Overrides() {
+		switch override.Key {
+		case "port":
+		case "openapi.spec":
+			flags.String("openapi", "", "Generate routes from an OpenAPI 3 spec (YAML or JSON) ("+override.Env+")")
+			viper.BindPFlag(override.Key, flags.Lookup("openapi"))
+			continue
+		case "version":
+			// --version conventionally prints the program version
+			continue
+		default:
+			addOverrideFlag(flags, override)
+		}
+		viper.BindPFlag(override.Key, flags.Lookup(override.Flag))
+	}
 }
 
-// initConfig reads in config file and ENV variables if set.
+// addOverrideFlag registers a flag matching the type of a setting
+func addOverrideFlag(flags *pflag.FlagSet, override config.Override) {
+	usage := strings.TrimSuffix(override.Description, ".") + " (" + override.Env + ")"
+	switch override.Type.Kind() {
+	case reflect.Bool:
+		flags.Bool(override.Flag, false, usage)
+	case reflect.Int:
+		flags.Int(override.Flag, 0, usage)
+	case reflect.Slice:
+		flags.StringSlice(override.Flag, nil, usage)
+	default:
+		flags.String(override.Flag, "", usage)
+	}
+}
+
+// initConfig records the config file set with --config. LoadConfig reads it,
+// together with the environment.
 func initConfig() {
 	if cfgFile != "" {
-		// Use config file from the flag.
 		viper.SetConfigFile(cfgFile)
-	} else {
-		// Find home directory.
-		home, err := os.UserHomeDir()
-		cobra.CheckErr(err)
-
-		// Search config in home directory with name ".dummy_http_passkeys" (without extension).
-		viper.AddConfigPath(home + "/.dummy_http_passkeys")
-		viper.AddConfigPath(".")
-		viper.SetConfigType("yaml")
-		viper.SetConfigName("config")
-	}
-
-	viper.AutomaticEnv() // read in environment variables that match
-
-	// If a config file is found, read it in.
-	if err := viper.ReadInConfig(); err == nil {
-		fmt.Fprintln(os.Stderr, "Using config file:", viper.ConfigFileUsed())
 	}
 }
 
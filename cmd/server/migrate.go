@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/developmeh/mock-cors-server/internal/config"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var migrateDryRun bool
+
+// migrateCmd rewrites configuration files to the current schema version
+var migrateCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "Rewrite a configuration file to the latest schema version",
+	Long: `Upgrade a configuration file, the files it includes and, with --env, its
+environment overlay to the latest configuration schema version. Deprecated
+settings are rewritten and listed. YAML files keep their comments and
+formatting; JSON and TOML files are reformatted. HCL files cannot be rewritten,
+the changes to make are listed instead and the command fails.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		file := config.FindConfigFile()
+		if file == "" {
+			fmt.Fprintln(os.Stderr, "No configuration file found; set one with --config")
+			os.Exit(1)
+		}
+
+		migrated, err := config.MigrateFiles(file, viper.GetString("env"))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to migrate configuration: %v\n", err)
+			os.Exit(1)
+		}
+
+		if len(migrated) == 0 {
+			fmt.Printf("%s is already at version %s\n", file, config.CurrentVersion)
+			return
+		}
+
+		manual := false
+		for _, m := range migrated {
+			for _, d := range m.Deprecations {
+				fmt.Println(d)
+			}
+
+			if m.Manual {
+				// Only the main file carries a version
+				if m.File == file {
+					fmt.Fprintf(os.Stderr, "%s cannot be rewritten; set version = \"%s\" and apply the changes listed by hand\n", m.File, config.CurrentVersion)
+				} else {
+					fmt.Fprintf(os.Stderr, "%s cannot be rewritten; apply the changes listed by hand\n", m.File)
+				}
+				manual = true
+				continue
+			}
+			if migrateDryRun {
+				fmt.Printf("--- %s\n%s", m.File, m.Data)
+				continue
+			}
+
+			mode := os.FileMode(0644)
+			if info, err := os.Stat(m.File); err == nil {
+				mode = info.Mode().Perm()
+			}
+			if err := os.WriteFile(m.File, m.Data, mode); err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to write %s: %v\n", m.File, err)
+				os.Exit(1)
+			}
+			fmt.Printf("Migrated %s to version %s (%d change(s))\n", m.File, config.CurrentVersion, len(m.Deprecations))
+		}
+		if manual {
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	migrateCmd.Flags().BoolVar(&migrateDryRun, "dry-run", false, "print the migrated files instead of writing them")
+	rootCmd.AddCommand(migrateCmd)
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+
+	"github.com/developmeh/mock-cors-server/internal/config"
+	"github.com/spf13/cobra"
+)
+
+var schemaOutput string
+
+// schemaCmd prints the JSON Schema of the configuration file
+var schemaCmd = &cobra.Command{
+	Use:   "schema",
+	Short: "Print the JSON Schema of the configuration file",
+	Long: `Print a JSON Schema describing the configuration file. Point your editor at it
+to get autocompletion and validation of config.yaml, for example with the YAML
+language server:
+
+  # yaml-language-server: $schema=./config.schema.json`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		data, err := json.MarshalIndent(config.Schema(), "", "  ")
+		if err != nil {
+			log.Fatalf("Failed to encode schema: %v", err)
+		}
+		data = append(data, '\n')
+
+		if schemaOutput == "" {
+			os.Stdout.Write(data)
+			return
+		}
+		if err := os.WriteFile(schemaOutput, data, 0644); err != nil {
+			log.Fatalf("Failed to write schema: %v", err)
+		}
+	},
+}
+
+func init() {
+	schemaCmd.Flags().StringVarP(&schemaOutput, "output", "o", "", "write the schema to a file instead of stdout")
+	rootCmd.AddCommand(schemaCmd)
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/developmeh/mock-cors-server/internal/config"
+	"github.com/developmeh/mock-cors-server/internal/importer"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// validateCmd checks a configuration file without starting the server
+var validateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "Validate a configuration file",
+	Long: `Load a configuration file and check every route for problems such as unknown
+keys, unknown types, missing files, invalid JSON content, invalid content types,
+duplicate paths and unreadable OpenAPI specs, including routes from included
+files and the environment overlay selected with --env. Exits with a non-zero
+status when problems are found, so it can gate configuration changes in CI.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		cfg, err := config.LoadConfig()
+		file := viper.ConfigFileUsed()
+
+		var problems []config.ValidationError
+		var unknown *config.UnknownKeysError
+		var conflicts *config.RouteConflictError
+		switch {
+		case errors.As(err, &unknown):
+			problems = unknown.ValidationErrors(file)
+		case errors.As(err, &conflicts):
+			problems = conflicts.ValidationErrors()
+		case err != nil:
+			fmt.Fprintf(os.Stderr, "Failed to load configuration: %v\n", err)
+			os.Exit(1)
+		default:
+			problems = config.Validate(cfg, file)
+			if cfg.OpenAPI.Spec != "" {
+				if _, err := importer.LoadOpenAPI(cfg.OpenAPI.Spec); err != nil {
+					problems = append(problems, config.ValidationError{File: file, Field: "openapi.spec", Message: err.Error()})
+				}
+			}
+		}
+
+		for _, problem := range problems {
+			fmt.Fprintln(os.Stderr, problem.Error())
+		}
+
+		if len(problems) > 0 {
+			fmt.Fprintf(os.Stderr, "%d problem(s) found\n", len(problems))
+			os.Exit(1)
+		}
+
+		if file == "" {
+			file = "default configuration"
+		}
+		fmt.Printf("%s is valid (%d routes)\n", file, len(cfg.Routes))
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(validateCmd)
+}
@@ -0,0 +1,282 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/go-viper/mapstructure/v2"
+)
+
+// RouteConflict is a path defined by more than one configuration file
+type RouteConflict struct {
+	Path   string
+	First  string // File of the first definition
+	Second string // File of the conflicting definition
+	Index  int    // Index of the conflicting route in Second
+}
+
+// RouteConflictError reports routes defined in more than one file
+type RouteConflictError struct {
+	Conflicts []RouteConflict
+}
+
+// Error lists every conflicting path with both source files
+func (e *RouteConflictError) Error() string {
+	var b strings.Builder
+	b.WriteString("route conflicts:")
+	for _, c := range e.Conflicts {
+		fmt.Fprintf(&b, "\n  %s is defined in %s and %s", c.Path, c.First, c.Second)
+	}
+	return b.String()
+}
+
+// ValidationErrors converts the conflicts into validation errors annotated
+// with the position of the conflicting definition
+func (e *RouteConflictError) ValidationErrors() []ValidationError {
+	var errs []ValidationError
+	for _, c := range e.Conflicts {
+		v := &validator{file: c.Second, positions: loadPositions(c.Second)}
+		v.add(fmt.Sprintf("routes[%d].path", c.Index), "path %q is already defined in %s", c.Path, c.First)
+		errs = append(errs, v.errors...)
+	}
+	return errs
+}
+
+// includeFile is the structure of files pulled in with include
+type includeFile struct {
+	Routes []Route `mapstructure:"routes"`
+}
+
+// readSettings reads a configuration file into a settings map, migrating it
+// to the current version and expanding ${...} references in its values
+func readSettings(file string) (map[string]interface{}, error) {
+	settings, err := decodeFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("error reading config file %s (as %s): %w", file, configFormat(file), err)
+	}
+
+	// Migrate before expanding, so references are seen as written
+	deprecations, err := migrateSettings(settings)
+	if err != nil {
+		return nil, fmt.Errorf("error reading config file %s: %w", file, err)
+	}
+	warnDeprecations(file, deprecations)
+
+	if _, err := interpolateSettings(settings, filepath.Dir(file), ""); err != nil {
+		return nil, fmt.Errorf("error reading config file %s: %w", file, err)
+	}
+	return settings, nil
+}
+
+// decodeStrict decodes settings the way viper does, but fails on keys that
+// do not map to any field
+func decodeStrict(input interface{}, output interface{}) error {
+	decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		DecodeHook: mapstructure.ComposeDecodeHookFunc(
+			mapstructure.StringToTimeDurationHookFunc(),
+			mapstructure.StringToSliceHookFunc(","),
+		),
+		ErrorUnused:      true,
+		WeaklyTypedInput: true,
+		Result:           output,
+	})
+	if err != nil {
+		return err
+	}
+	return decoder.Decode(input)
+}
+
+// checkUnknownKeys reports keys of a file's settings that do not map to t
+func checkUnknownKeys(settings map[string]interface{}, t reflect.Type, file string) error {
+	unknown := findUnknownKeys(settings, t, "")
+	if len(unknown) == 0 {
+		return nil
+	}
+	for i := range unknown {
+		unknown[i].File = file
+	}
+	return &UnknownKeysError{Keys: unknown}
+}
+
+// decodeRoutes decodes a list of routes loaded from file. Route cors and
+// compression blocks are merged field by field onto the global settings.
+func decodeRoutes(raw interface{}, global *Config, file string) ([]Route, error) {
+	var routes []Route
+	if err := decodeStrict(raw, &routes); err != nil {
+		return nil, fmt.Errorf("unable to decode routes in %s: %w", file, err)
+	}
+
+	items, _ := raw.([]interface{})
+	for i := range routes {
+		routes[i].Source = file
+		routes[i].SourceIndex = i
+
+		if i >= len(items) {
+			continue
+		}
+		route, _ := toStringMap(items[i])
+		if routes[i].CORS != nil {
+			merged := global.CORS
+			mergeBlock(&merged, routes[i].CORS, route, "cors")
+			routes[i].CORS = &merged
+		}
+		if routes[i].Compression != nil {
+			merged := global.Compression
+			mergeBlock(&merged, routes[i].Compression, route, "compression")
+			routes[i].Compression = &merged
+		}
+	}
+	return routes, nil
+}
+
+// mergeBlock merges the fields of a decoded route block that are present in
+// the route settings onto dst
+func mergeBlock(dst, decoded interface{}, route map[string]interface{}, key string) {
+	settings, _ := lookupKey(route, key)
+	if blockMap, ok := toStringMap(settings); ok {
+		mergeSettings(reflect.ValueOf(dst).Elem(), reflect.ValueOf(decoded).Elem(), blockMap)
+	}
+}
+
+// overlayFile returns the environment overlay of a config file, for example
+// config.staging.yaml for config.yaml and the staging environment. An
+// overlay in another format is used when there is none with the same
+// extension.
+func overlayFile(file, env string) string {
+	ext := filepath.Ext(file)
+	base := strings.TrimSuffix(file, ext) + "." + env
+	candidates := []string{base + ext}
+	for _, format := range Formats {
+		candidates = append(candidates, base+"."+format)
+	}
+	for _, candidate := range candidates {
+		if info, err := os.Stat(candidate); err == nil && !info.IsDir() {
+			return candidate
+		}
+	}
+	return candidates[0]
+}
+
+// deepMerge merges overlay into base, recursing into nested maps and
+// replacing every other value
+func deepMerge(base, overlay map[string]interface{}) {
+	for key, value := range overlay {
+		if nested, ok := toStringMap(value); ok {
+			if existing, ok := toStringMap(base[key]); ok {
+				deepMerge(existing, nested)
+				base[key] = existing
+				continue
+			}
+		}
+		base[key] = value
+	}
+}
+
+// includedFiles resolves include patterns to files, in alphabetical order
+// per pattern. Relative patterns are resolved against dir.
+func includedFiles(patterns []string, dir string) ([]string, error) {
+	var files []string
+	seen := make(map[string]bool)
+
+	for _, pattern := range patterns {
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(dir, pattern)
+		}
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid include pattern %q: %w", pattern, err)
+		}
+		if len(matches) == 0 && !strings.ContainsAny(pattern, "*?[") {
+			return nil, fmt.Errorf("included file %s does not exist", pattern)
+		}
+		sort.Strings(matches)
+
+		for _, file := range matches {
+			if info, err := os.Stat(file); err != nil || info.IsDir() || seen[file] {
+				continue
+			}
+			seen[file] = true
+			files = append(files, file)
+		}
+	}
+
+	return files, nil
+}
+
+// loadIncludes reads the routes of every file matched by the include
+// patterns. Relative patterns are resolved against dir.
+func loadIncludes(patterns []string, dir string, global *Config) ([]Route, error) {
+	files, err := includedFiles(patterns, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var routes []Route
+	for _, file := range files {
+		settings, err := readSettings(file)
+		if err != nil {
+			return nil, err
+		}
+		if err := checkUnknownKeys(settings, reflect.TypeOf(includeFile{}), file); err != nil {
+			return nil, err
+		}
+
+		raw, ok := lookupKey(settings, "routes")
+		if !ok {
+			continue
+		}
+		included, err := decodeRoutes(raw, global, file)
+		if err != nil {
+			return nil, err
+		}
+		routes = append(routes, included...)
+	}
+
+	return routes, nil
+}
+
+// findRouteConflicts reports routes defined more than once across files
+func findRouteConflicts(routes []Route) error {
+	var conflicts []RouteConflict
+
+	for i, route := range routes {
+		for _, earlier := range routes[:i] {
+			if !earlier.Overlaps(route) {
+				continue
+			}
+			// Duplicates within a single file are reported by validate
+			if earlier.Source != route.Source {
+				conflicts = append(conflicts, RouteConflict{Path: route.Path, First: earlier.Source, Second: route.Source, Index: route.SourceIndex})
+			}
+			break
+		}
+	}
+
+	if len(conflicts) > 0 {
+		return &RouteConflictError{Conflicts: conflicts}
+	}
+	return nil
+}
+
+// applyOverlayRoutes replaces routes answering the same requests and appends
+// new ones
+func applyOverlayRoutes(routes, overlay []Route) []Route {
+	for _, route := range overlay {
+		replaced := false
+		for i := range routes {
+			if routes[i].Overlaps(route) {
+				routes[i] = route
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			routes = append(routes, route)
+		}
+	}
+	return routes
+}
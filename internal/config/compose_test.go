@@ -0,0 +1,245 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+// writeFiles creates files below dir, keyed by slash separated path
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		file := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+}
+
+func TestLoadConfigIncludes(t *testing.T) {
+	viper.Reset()
+
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"config.yaml": `cors:
+  allow_origins: ["https://app.example.com"]
+include:
+  - routes.d/*.yaml
+routes:
+  - path: "/base"
+    type: "dummy"
+`,
+		"routes.d/a.yaml": `routes:
+  - path: "/a"
+    type: "json"
+    json_content: '{"a": 1}'
+`,
+		"routes.d/b.yaml": `routes:
+  - path: "/b"
+    type: "dummy"
+    cors:
+      allow_credentials: false
+`,
+	})
+	viper.SetConfigFile(filepath.Join(dir, "config.yaml"))
+
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("Expected config to load, got error: %v", err)
+	}
+
+	var paths []string
+	for _, route := range cfg.Routes {
+		paths = append(paths, route.Path)
+	}
+	if strings.Join(paths, ",") != "/base,/a,/b" {
+		t.Fatalf("Expected routes /base,/a,/b, got %v", paths)
+	}
+
+	if cfg.Routes[1].Source != filepath.Join(dir, "routes.d/a.yaml") || cfg.Routes[1].SourceIndex != 0 {
+		t.Errorf("Unexpected source for /a: %s[%d]", cfg.Routes[1].Source, cfg.Routes[1].SourceIndex)
+	}
+
+	// Included route cors blocks merge onto the global settings
+	cors := cfg.Routes[2].CORS
+	if cors == nil || cors.AllowCredentials || len(cors.AllowOrigins) != 1 || cors.AllowOrigins[0] != "https://app.example.com" {
+		t.Errorf("Expected partial cors merged onto global settings, got %+v", cors)
+	}
+}
+
+func TestLoadConfigIncludeConflict(t *testing.T) {
+	viper.Reset()
+
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"config.yaml": `include: ["extra.yaml"]
+routes:
+  - path: "/same"
+    type: "dummy"
+`,
+		"extra.yaml": `routes:
+  - path: "/other"
+    type: "dummy"
+  - path: "/same"
+    type: "dummy"
+`,
+	})
+	viper.SetConfigFile(filepath.Join(dir, "config.yaml"))
+
+	_, err := LoadConfig()
+	var conflicts *RouteConflictError
+	if !errors.As(err, &conflicts) {
+		t.Fatalf("Expected RouteConflictError, got %v", err)
+	}
+
+	c := conflicts.Conflicts[0]
+	if c.Path != "/same" || c.First != filepath.Join(dir, "config.yaml") || c.Second != filepath.Join(dir, "extra.yaml") {
+		t.Errorf("Unexpected conflict: %+v", c)
+	}
+	if !strings.Contains(err.Error(), "config.yaml") || !strings.Contains(err.Error(), "extra.yaml") {
+		t.Errorf("Expected both files in error, got %q", err.Error())
+	}
+
+	problems := conflicts.ValidationErrors()
+	if len(problems) != 1 || problems[0].File != c.Second || problems[0].Line != 4 {
+		t.Errorf("Expected problem on line 4 of extra.yaml, got %+v", problems)
+	}
+}
+
+func TestLoadConfigMissingInclude(t *testing.T) {
+	viper.Reset()
+
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"config.yaml": `include: ["missing.yaml", "routes.d/*.yaml"]`,
+	})
+	viper.SetConfigFile(filepath.Join(dir, "config.yaml"))
+
+	if _, err := LoadConfig(); err == nil || !strings.Contains(err.Error(), "missing.yaml") {
+		t.Errorf("Expected error about missing.yaml, got %v", err)
+	}
+}
+
+func TestLoadConfigIncludeUnknownKeys(t *testing.T) {
+	viper.Reset()
+
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"config.yaml": `include: ["extra.yaml"]`,
+		"extra.yaml":  "port: 9000\n",
+	})
+	viper.SetConfigFile(filepath.Join(dir, "config.yaml"))
+
+	_, err := LoadConfig()
+	var unknown *UnknownKeysError
+	if !errors.As(err, &unknown) {
+		t.Fatalf("Expected UnknownKeysError, got %v", err)
+	}
+	if unknown.Keys[0].File != filepath.Join(dir, "extra.yaml") || unknown.Keys[0].Field != "port" {
+		t.Errorf("Unexpected unknown key: %+v", unknown.Keys[0])
+	}
+}
+
+func TestLoadConfigEnvironmentOverlay(t *testing.T) {
+	viper.Reset()
+
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"config.yaml": `port: 8081
+cors:
+  allow_origins: ["http://localhost:3000"]
+  max_age: 60
+routes:
+  - path: "/a"
+    type: "dummy"
+  - path: "/b"
+    type: "json"
+    json_content: '{"env": "base"}'
+`,
+		"config.staging.yaml": `port: 9090
+cors:
+  allow_origins: ["https://staging.example.com"]
+routes:
+  - path: "/b"
+    type: "json"
+    json_content: '{"env": "staging"}'
+  - path: "/c"
+    type: "dummy"
+`,
+	})
+	viper.SetConfigFile(filepath.Join(dir, "config.yaml"))
+	viper.Set("env", "staging")
+
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("Expected config to load, got error: %v", err)
+	}
+
+	if cfg.Port != 9090 {
+		t.Errorf("Expected overlay port 9090, got %d", cfg.Port)
+	}
+	if cfg.CORS.AllowOrigins[0] != "https://staging.example.com" || cfg.CORS.MaxAge != 60 {
+		t.Errorf("Expected overlay cors merged onto base, got %+v", cfg.CORS)
+	}
+
+	if len(cfg.Routes) != 3 {
+		t.Fatalf("Expected 3 routes, got %+v", cfg.Routes)
+	}
+	if cfg.Routes[1].JSONContent != `{"env": "staging"}` || cfg.Routes[1].Source != filepath.Join(dir, "config.staging.yaml") {
+		t.Errorf("Expected overlay to replace /b, got %+v", cfg.Routes[1])
+	}
+	if cfg.Routes[2].Path != "/c" {
+		t.Errorf("Expected overlay to append /c, got %s", cfg.Routes[2].Path)
+	}
+}
+
+func TestLoadConfigMissingOverlay(t *testing.T) {
+	viper.Reset()
+
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"config.yaml": "port: 8081\n"})
+	viper.SetConfigFile(filepath.Join(dir, "config.yaml"))
+	viper.Set("env", "production")
+
+	if _, err := LoadConfig(); err == nil || !strings.Contains(err.Error(), "config.production.yaml") {
+		t.Errorf("Expected error about config.production.yaml, got %v", err)
+	}
+}
+
+func TestValidateIncludedRoutePositions(t *testing.T) {
+	viper.Reset()
+
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"config.yaml": `include: ["extra.yaml"]`,
+		"extra.yaml": `routes:
+  - path: "/ok"
+    type: "dummy"
+  - path: "/broken"
+    type: "statik"
+`,
+	})
+	file := filepath.Join(dir, "config.yaml")
+	viper.SetConfigFile(file)
+
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("Expected config to load, got error: %v", err)
+	}
+
+	problems := Validate(cfg, file)
+	if len(problems) != 1 {
+		t.Fatalf("Expected 1 problem, got %v", problems)
+	}
+	if problems[0].File != filepath.Join(dir, "extra.yaml") || problems[0].Field != "routes[1].type" || problems[0].Line != 5 {
+		t.Errorf("Expected problem at extra.yaml:5 routes[1].type, got %+v", problems[0])
+	}
+}
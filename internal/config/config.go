@@ -2,25 +2,189 @@ package config
 
 import (
 	"fmt"
+	"mime"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+
 	"github.com/spf13/viper"
 )
 
 // Config holds all configuration for the server
 type Config struct {
-	Port   int      `mapstructure:"port"`
-	Routes []Route  `mapstructure:"routes"`
-	CORS   CORSConfig `mapstructure:"cors"`
-	Version string  `mapstructure:"version"`
+	Port    int           `mapstructure:"port"`
+	Routes  []Route       `mapstructure:"routes"`
+	CORS    CORSConfig    `mapstructure:"cors"`
+	Version string        `mapstructure:"version"`
+	OIDC    OIDCConfig    `mapstructure:"oidc"`
+	Include []string      `mapstructure:"include"` // Files or globs contributing routes
+	OpenAPI OpenAPIConfig `mapstructure:"openapi"`
+	HAR     HARConfig     `mapstructure:"har"` // Recording of the traffic handled
+
+	Compression CompressionConfig `mapstructure:"compression"` // Content-Encoding negotiation
+
+	MimeTypes map[string]string `mapstructure:"mime_types"` // Content types by file extension, without the dot
+}
+
+// SSEEvent is a server-sent event of an sse route
+type SSEEvent struct {
+	Event string `mapstructure:"event"` // Event type, "message" when empty
+	ID    string `mapstructure:"id"`
+	Data  string `mapstructure:"data"`  // Sent as one data line per line
+	Retry int    `mapstructure:"retry"` // Reconnection time in milliseconds
+	Delay int    `mapstructure:"delay"` // Milliseconds to wait before sending the event
+}
+
+// StreamChunk is a part of the body of a stream route
+type StreamChunk struct {
+	Data  string `mapstructure:"data"`
+	Delay int    `mapstructure:"delay"` // Milliseconds to wait before sending
 }
 
+// NDJSONTypes are the content types of newline-delimited JSON streams,
+// whose chunks are JSON values ending with a line break
+var NDJSONTypes = []string{"application/x-ndjson", "application/ndjson", "application/jsonl", "application/x-jsonlines"}
+
+// IsNDJSON reports whether a content type is newline-delimited JSON
+func IsNDJSON(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	for _, t := range NDJSONTypes {
+		if mediaType == t {
+			return true
+		}
+	}
+	return false
+}
+
+// GraphQLResolver is the response of a graphql route to an operation.
+// Fields the operation selects that data leaves out are filled with fake
+// values.
+type GraphQLResolver struct {
+	Data   string   `mapstructure:"data"`   // JSON object with the operation's result
+	Errors []string `mapstructure:"errors"` // Messages of the errors reported with it
+}
+
+// GRPCMethod is the response of a grpc route to a method of its services
+type GRPCMethod struct {
+	Method    string            `mapstructure:"method"`    // Full method name, e.g. acme.v1.Greeter/SayHello
+	Responses []string          `mapstructure:"responses"` // Messages in protobuf JSON, one for unary methods
+	Code      string            `mapstructure:"code"`      // Status code name or number, ok when empty
+	Message   string            `mapstructure:"message"`   // Status message sent with the code
+	Trailers  map[string]string `mapstructure:"trailers"`  // Metadata sent with the status
+}
+
+// GRPCCodes are the gRPC status code names, indexed by code
+var GRPCCodes = []string{
+	"ok", "canceled", "unknown", "invalid_argument", "deadline_exceeded", "not_found",
+	"already_exists", "permission_denied", "resource_exhausted", "failed_precondition",
+	"aborted", "out_of_range", "unimplemented", "internal", "unavailable", "data_loss",
+	"unauthenticated",
+}
+
+// ParseGRPCCode returns the code of a status name, such as not_found or
+// NOT_FOUND, or of a number. Empty names are ok.
+func ParseGRPCCode(name string) (int, bool) {
+	if name == "" {
+		return 0, true
+	}
+	if code, err := strconv.Atoi(name); err == nil {
+		return code, code >= 0 && code < len(GRPCCodes)
+	}
+	for code, n := range GRPCCodes {
+		if strings.EqualFold(n, name) {
+			return code, true
+		}
+	}
+	return 0, false
+}
+
+// WebSocketMessage is a scripted message of a websocket route, sent on
+// connect, or in reply to inbound messages matching a pattern
+type WebSocketMessage struct {
+	Match string `mapstructure:"match"` // Regular expression for inbound text messages; empty sends on connect
+	Send  string `mapstructure:"send"`  // Text message sent
+	Delay int    `mapstructure:"delay"` // Milliseconds to wait before sending
+	Close int    `mapstructure:"close"` // Close the connection with this status code after sending
+}
+
+// CompressionConfig controls the compression of responses
+type CompressionConfig struct {
+	Enabled       bool     `mapstructure:"enabled"`       // Compress responses on the fly
+	MinSize       int      `mapstructure:"min_size"`      // Smaller responses are sent as is
+	Encodings     []string `mapstructure:"encodings"`     // Offered encodings, in order of preference
+	Precompressed bool     `mapstructure:"precompressed"` // Serve .br, .zst and .gz siblings of static files
+}
+
+// Encodings lists the supported content encodings
+var Encodings = []string{"br", "zstd", "gzip", "deflate"}
+
+// AdminPrefix is the path the admin endpoints are served under
+const AdminPrefix = "/__admin/"
+
 // Route represents a single route configuration
 type Route struct {
-	Path        string     `mapstructure:"path"`
-	Type        string     `mapstructure:"type"`        // "static", "json", or "dummy"
-	FilePath    string     `mapstructure:"file_path"`   // For static files
-	JSONContent string     `mapstructure:"json_content"` // For JSON blob responses
-	ContentType string     `mapstructure:"content_type"`
-	CORS        *CORSConfig `mapstructure:"cors"`
+	Path           string                     `mapstructure:"path"`
+	Type           string                     `mapstructure:"type"`           // "static", "static_dir", "json", "sse", "websocket", "stream", "long_poll", "graphql", "grpc", or "dummy"
+	FilePath       string                     `mapstructure:"file_path"`      // For static files
+	Dir            string                     `mapstructure:"dir"`            // Directory served by static_dir routes
+	IndexFiles     []string                   `mapstructure:"index_files"`    // Served for directory requests, index.html when empty
+	Listing        bool                       `mapstructure:"listing"`        // List directories without an index file
+	SPAFallback    bool                       `mapstructure:"spa_fallback"`   // Serve the root index file for unknown paths
+	Events         []SSEEvent                 `mapstructure:"events"`         // Streamed by sse routes
+	Loop           bool                       `mapstructure:"loop"`           // Start over after the last event
+	Messages       []WebSocketMessage         `mapstructure:"messages"`       // Scripted messages of websocket routes
+	Subprotocols   []string                   `mapstructure:"subprotocols"`   // WebSocket subprotocols, in order of preference
+	Chunks         []StreamChunk              `mapstructure:"chunks"`         // Body of stream routes, flushed chunk by chunk
+	Timeout        int                        `mapstructure:"timeout"`        // Milliseconds long_poll routes hold requests
+	TimeoutStatus  int                        `mapstructure:"timeout_status"` // Status of long polls that time out
+	Trigger        string                     `mapstructure:"trigger"`        // Name of the admin trigger releasing long polls
+	Schema         string                     `mapstructure:"schema"`         // GraphQL SDL file of graphql routes
+	Resolvers      map[string]GraphQLResolver `mapstructure:"resolvers"`      // Responses of graphql routes by operation name
+	DescriptorSet  string                     `mapstructure:"descriptor_set"` // Protobuf FileDescriptorSet of grpc routes
+	RPCs           []GRPCMethod               `mapstructure:"rpcs"`           // Responses of grpc routes by method
+	JSONContent    string                     `mapstructure:"json_content"`   // For JSON blob responses
+	ContentType    string                     `mapstructure:"content_type"`
+	Methods        []string                   `mapstructure:"methods"`       // Methods answered, the type's default when empty
+	Status         int                        `mapstructure:"status"`        // Response status of json and dummy routes
+	Headers        map[string]string          `mapstructure:"headers"`       // Extra response headers
+	CacheControl   string                     `mapstructure:"cache_control"` // Cache-Control header of the responses
+	Compression    *CompressionConfig         `mapstructure:"compression"`   // Replaces the global compression settings
+	CORS           *CORSConfig                `mapstructure:"cors"`
+	JWT            *JWTConfig                 `mapstructure:"jwt"`             // Require a bearer JWT
+	RequireHeaders *RequireHeadersConfig      `mapstructure:"require_headers"` // Require partner headers
+	Session        *SessionConfig             `mapstructure:"session"`         // Set, require, read or clear the session cookie
+
+	Source      string `mapstructure:"-"` // File the route was loaded from
+	SourceIndex int    `mapstructure:"-"` // Index of the route in Source
+}
+
+// Overlaps reports whether two routes answer the same requests: they share a
+// path and a method, or one of them answers its type's default methods
+func (r Route) Overlaps(other Route) bool {
+	if r.Path != other.Path {
+		return false
+	}
+	if len(r.Methods) == 0 || len(other.Methods) == 0 {
+		return true
+	}
+	for _, m := range r.Methods {
+		for _, o := range other.Methods {
+			if strings.EqualFold(m, o) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// IsFileMethod reports whether files can be served for a method; static and
+// static_dir routes only answer GET and HEAD
+func IsFileMethod(method string) bool {
+	return strings.EqualFold(method, "GET") || strings.EqualFold(method, "HEAD")
 }
 
 // CORSConfig holds CORS configuration
@@ -28,10 +192,109 @@ type CORSConfig struct {
 	AllowOrigins     []string `mapstructure:"allow_origins"`
 	AllowMethods     []string `mapstructure:"allow_methods"`
 	AllowHeaders     []string `mapstructure:"allow_headers"`
+	ExposeHeaders    []string `mapstructure:"expose_headers"` // Response headers scripts may read
 	AllowCredentials bool     `mapstructure:"allow_credentials"`
 	MaxAge           int      `mapstructure:"max_age"`
 }
 
+// JWTConfig holds bearer token validation settings for a route
+type JWTConfig struct {
+	Secret        string   `mapstructure:"secret"`          // HMAC shared secret
+	PublicKeyFile string   `mapstructure:"public_key_file"` // PEM encoded RSA, ECDSA or Ed25519 public key
+	JWKSFile      string   `mapstructure:"jwks_file"`       // Local JSON Web Key Set
+	UseOIDC       bool     `mapstructure:"use_oidc"`        // Trust tokens from the built-in OIDC provider
+	Algorithms    []string `mapstructure:"algorithms"`      // Inferred from the key type when empty
+	Issuer        string   `mapstructure:"issuer"`
+	Audience      string   `mapstructure:"audience"`
+	Leeway        int      `mapstructure:"leeway"` // Clock skew allowed for exp/nbf, in seconds
+	Realm         string   `mapstructure:"realm"`
+
+	Claims map[string]string `mapstructure:"claims"` // Required claim values
+}
+
+// RequireHeadersConfig holds the header guards of a route
+type RequireHeadersConfig struct {
+	Headers       []HeaderRequirement `mapstructure:"headers"`
+	APIKey        *APIKeyConfig       `mapstructure:"api_key"`
+	MissingStatus int                 `mapstructure:"missing_status"` // Defaults to 400
+	InvalidStatus int                 `mapstructure:"invalid_status"` // Defaults to 403
+	Body          string              `mapstructure:"body"`           // Response body on mismatch
+}
+
+// HeaderRequirement describes a single required header. Status codes and
+// body fall back to the enclosing RequireHeadersConfig when unset.
+type HeaderRequirement struct {
+	Name          string   `mapstructure:"name"`
+	Values        []string `mapstructure:"values"`  // Allowed values, any value when empty
+	Pattern       string   `mapstructure:"pattern"` // Regular expression the value must match
+	MissingStatus int      `mapstructure:"missing_status"`
+	InvalidStatus int      `mapstructure:"invalid_status"`
+	Body          string   `mapstructure:"body"`
+}
+
+// APIKeyConfig validates a header against keys listed in a local file
+type APIKeyConfig struct {
+	Header        string `mapstructure:"header"`
+	File          string `mapstructure:"file"`           // One key per line, # starts a comment
+	MissingStatus int    `mapstructure:"missing_status"` // Defaults to 401
+	InvalidStatus int    `mapstructure:"invalid_status"` // Defaults to 403
+	Body          string `mapstructure:"body"`
+}
+
+// SessionConfig describes how a route interacts with the session cookie
+type SessionConfig struct {
+	Action     string            `mapstructure:"action"`      // "set", "require", "read" or "clear"
+	CookieName string            `mapstructure:"cookie_name"` // Defaults to mock_session
+	Values     map[string]string `mapstructure:"values"`      // Stored on set, must match on require/read
+	SameSite   string            `mapstructure:"same_site"`   // "lax", "strict" or "none"
+	Secure     bool              `mapstructure:"secure"`
+	HTTPOnly   *bool             `mapstructure:"http_only"` // Defaults to true
+	Domain     string            `mapstructure:"domain"`
+	Path       string            `mapstructure:"path"`    // Defaults to /
+	MaxAge     int               `mapstructure:"max_age"` // In seconds, session cookie when zero
+}
+
+// OIDCConfig holds configuration for the mock OAuth2 / OpenID Connect provider
+type OIDCConfig struct {
+	Enabled         bool         `mapstructure:"enabled"`
+	Issuer          string       `mapstructure:"issuer"`            // Defaults to http://localhost:<port><path_prefix>
+	PathPrefix      string       `mapstructure:"path_prefix"`       // Mount point for the provider endpoints
+	SigningKeyFile  string       `mapstructure:"signing_key_file"`  // PEM encoded RSA key, generated when empty
+	AccessTokenTTL  int          `mapstructure:"access_token_ttl"`  // In seconds
+	RefreshTokenTTL int          `mapstructure:"refresh_token_ttl"` // In seconds
+	Clients         []OIDCClient `mapstructure:"clients"`
+	Users           []OIDCUser   `mapstructure:"users"`
+}
+
+// OIDCClient represents an OAuth2 client registered with the mock provider
+type OIDCClient struct {
+	ClientID     string   `mapstructure:"client_id"`
+	ClientSecret string   `mapstructure:"client_secret"` // Empty for public clients
+	RedirectURIs []string `mapstructure:"redirect_uris"` // Any redirect URI is accepted when empty
+}
+
+// OIDCUser represents a user the mock provider can log in
+type OIDCUser struct {
+	Subject  string                 `mapstructure:"subject"`
+	Username string                 `mapstructure:"username"` // Matched against login_hint
+	Claims   map[string]interface{} `mapstructure:"claims"`
+}
+
+// OpenAPIConfig holds the OpenAPI document routes are generated from and
+// requests are checked against
+type OpenAPIConfig struct {
+	Spec              string `mapstructure:"spec"`               // OpenAPI 3 document, YAML or JSON
+	Validate          string `mapstructure:"validate"`           // "off", "warn" or "enforce"
+	ValidateResponses bool   `mapstructure:"validate_responses"` // Check responses too when validating
+}
+
+// HARConfig controls the recording of handled requests, exported as HTTP
+// Archive (HAR) 1.2 from the admin endpoint
+type HARConfig struct {
+	Out        string `mapstructure:"out"`         // File written on shutdown
+	MaxEntries int    `mapstructure:"max_entries"` // Oldest entries are dropped beyond this, 0 keeps all
+}
+
 // DefaultConfig returns the default configuration
 func DefaultConfig() *Config {
 	return &Config{
@@ -50,52 +313,138 @@ func DefaultConfig() *Config {
 			AllowCredentials: true,
 			MaxAge:           86400,
 		},
-		Version: "1.0.0",
+		Version: CurrentVersion,
+		HAR: HARConfig{
+			MaxEntries: 1000,
+		},
+		Compression: CompressionConfig{
+			MinSize:   1024,
+			Encodings: append([]string(nil), Encodings...),
+		},
 	}
 }
 
-// LoadConfig loads the configuration from file and environment variables
+// LoadConfig loads the configuration. Settings are applied in order of
+// precedence: command-line flags, MOCK_CORS_ environment variables, the
+// environment overlay (config.<env>.yaml, selected with MOCK_CORS_ENV), the
+// configuration file with its includes, and finally the defaults.
 func LoadConfig() (*Config, error) {
 	config := DefaultConfig()
 
-	viper.SetConfigName("config")
-	viper.SetConfigType("yaml")
-	viper.AddConfigPath(".")
-	viper.AddConfigPath("$HOME/.dummy_http_passkeys")
-	viper.AddConfigPath("/etc/dummy_http_passkeys")
+	file := FindConfigFile()
+	if file != "" {
+		// Record the file for callers such as the validate command
+		viper.SetConfigFile(file)
+	}
+	if err := loadFiles(config, file, viper.GetString("env")); err != nil {
+		return nil, err
+	}
 
-	// Environment variables
-	viper.SetEnvPrefix("MOCK_CORS")
-	viper.AutomaticEnv()
+	return config, nil
+}
 
-	// Read config file if it exists
-	if err := viper.ReadInConfig(); err != nil {
-		if _, ok := err.(viper.ConfigFileNotFoundError); !ok {
-			return nil, fmt.Errorf("error reading config file: %w", err)
-		}
+// FindConfigFile returns the file set with --config or MOCK_CORS_CONFIG, or
+// searches the default locations. It returns an empty path when there is no
+// configuration file.
+func FindConfigFile() string {
+	setupEnv()
+	if file := viper.ConfigFileUsed(); file != "" {
+		return file
 	}
+	if file := viper.GetString("config"); file != "" {
+		return file
+	}
+	return searchConfigFile()
+}
 
-	// Override with environment variables if they exist
-	if viper.IsSet("port") {
-		config.Port = viper.GetInt("port")
+// loadFiles merges a configuration file, its includes and the overlay of env
+// onto config, followed by the environment and flag overrides. Without a file
+// only the overrides and their includes apply.
+func loadFiles(config *Config, file, env string) error {
+	settings := make(map[string]interface{})
+	if file != "" {
+		var err error
+		if settings, err = readSettings(file); err != nil {
+			return err
+		}
+		// Reject keys that do not map to any setting instead of silently dropping them
+		if err := checkUnknownKeys(settings, reflect.TypeOf(Config{}), file); err != nil {
+			return err
+		}
 	}
-	if viper.IsSet("version") {
-		config.Version = viper.GetString("version")
+
+	// The overlay is merged key by key, except for routes which replace or
+	// extend the base routes by path
+	var overlay string
+	var overlayRoutes interface{}
+	if env != "" {
+		if file == "" {
+			return fmt.Errorf("environment %q: no configuration file to overlay", env)
+		}
+		overlay = overlayFile(file, env)
+		overlaySettings, err := readSettings(overlay)
+		if err != nil {
+			return fmt.Errorf("environment %q: %w", env, err)
+		}
+		if err := checkUnknownKeys(overlaySettings, reflect.TypeOf(Config{}), overlay); err != nil {
+			return err
+		}
+		overlayRoutes = overlaySettings["routes"]
+		delete(overlaySettings, "routes")
+		deepMerge(settings, overlaySettings)
 	}
 
-	// Unmarshal the rest of the config (routes, CORS, etc.)
+	baseRoutes, hasRoutes := settings["routes"]
+	delete(settings, "routes")
+
+	// Decode strictly; anything findUnknownKeys missed still fails here
 	var tempConfig Config
-	if err := viper.Unmarshal(&tempConfig); err != nil {
-		return nil, fmt.Errorf("unable to decode config: %w", err)
+	if err := decodeStrict(settings, &tempConfig); err != nil {
+		return fmt.Errorf("unable to decode config: %w", err)
+	}
+
+	// Merge the settings present in the file field by field onto the defaults,
+	// so a partial cors block only overrides the fields it sets
+	mergeSettings(reflect.ValueOf(config).Elem(), reflect.ValueOf(&tempConfig).Elem(), settings)
+
+	// Overrides come before the routes, so route cors blocks and includes
+	// build on the overridden settings
+	if err := applyOverrides(config); err != nil {
+		return err
 	}
 
-	// Merge non-zero values from tempConfig
-	if len(tempConfig.Routes) > 0 {
-		config.Routes = tempConfig.Routes
+	// Route cors and compression blocks are partial overrides of the global
+	// settings as well
+	var routes []Route
+	var err error
+	if hasRoutes {
+		if routes, err = decodeRoutes(baseRoutes, config, file); err != nil {
+			return err
+		}
 	}
-	if tempConfig.CORS.AllowOrigins != nil {
-		config.CORS = tempConfig.CORS
+
+	if len(config.Include) > 0 {
+		included, err := loadIncludes(config.Include, filepath.Dir(file), config)
+		if err != nil {
+			return err
+		}
+		routes = append(routes, included...)
+		if err := findRouteConflicts(routes); err != nil {
+			return err
+		}
 	}
 
-	return config, nil
+	if hasRoutes || len(config.Include) > 0 {
+		config.Routes = routes
+	}
+
+	if overlayRoutes != nil {
+		replacements, err := decodeRoutes(overlayRoutes, config, overlay)
+		if err != nil {
+			return err
+		}
+		config.Routes = applyOverlayRoutes(config.Routes, replacements)
+	}
+
+	return nil
 }
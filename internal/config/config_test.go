@@ -1,9 +1,12 @@
 package config
 
 import (
+	"errors"
 	"os"
+	"path/filepath"
 	"testing"
 
+	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
 )
 
@@ -15,8 +18,8 @@ func TestDefaultConfig(t *testing.T) {
 		t.Errorf("Expected default port 8081, got %d", cfg.Port)
 	}
 
-	if cfg.Version != "1.0.0" {
-		t.Errorf("Expected version 1.0.0, got %s", cfg.Version)
+	if cfg.Version != CurrentVersion {
+		t.Errorf("Expected version %s, got %s", CurrentVersion, cfg.Version)
 	}
 
 	// Test default route
@@ -94,6 +97,131 @@ func TestLoadConfigWithEnvironmentVariables(t *testing.T) {
 	}
 }
 
+func TestLoadConfigIgnoresUnsetFlags(t *testing.T) {
+	viper.Reset()
+
+	// An unset flag bound to viper must not override the default
+	flags := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	flags.Int("port", 0, "port to run the server on")
+	viper.BindPFlag("port", flags.Lookup("port"))
+
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if cfg.Port != 8081 {
+		t.Errorf("Expected default port 8081, got %d", cfg.Port)
+	}
+}
+
+func TestLoadConfigPartialCORS(t *testing.T) {
+	viper.Reset()
+
+	file := filepath.Join(t.TempDir(), "config.yaml")
+	content := `cors:
+  max_age: 60
+routes:
+  - path: "/restricted"
+    type: "dummy"
+    cors:
+      allow_origins: ["https://example.com"]
+`
+	if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+	viper.SetConfigFile(file)
+
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	defaults := DefaultConfig()
+	if cfg.CORS.MaxAge != 60 {
+		t.Errorf("Expected max_age 60, got %d", cfg.CORS.MaxAge)
+	}
+	if len(cfg.CORS.AllowHeaders) != len(defaults.CORS.AllowHeaders) {
+		t.Errorf("Expected default allow_headers to be kept, got %v", cfg.CORS.AllowHeaders)
+	}
+
+	routeCORS := cfg.Routes[0].CORS
+	if routeCORS == nil || len(routeCORS.AllowOrigins) != 1 || routeCORS.AllowOrigins[0] != "https://example.com" {
+		t.Fatalf("Expected route allow_origins override, got %+v", routeCORS)
+	}
+	if routeCORS.MaxAge != 60 || len(routeCORS.AllowMethods) != len(defaults.CORS.AllowMethods) {
+		t.Errorf("Expected route cors to inherit global settings, got %+v", routeCORS)
+	}
+}
+
+func TestLoadConfigPartialCompression(t *testing.T) {
+	viper.Reset()
+
+	file := filepath.Join(t.TempDir(), "config.yaml")
+	content := `compression:
+  enabled: true
+  min_size: 256
+routes:
+  - path: "/assets/"
+    type: "static_dir"
+    dir: "."
+    compression:
+      precompressed: true
+  - path: "/raw"
+    type: "dummy"
+    compression:
+      enabled: false
+`
+	if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+	viper.SetConfigFile(file)
+
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if !cfg.Compression.Enabled || cfg.Compression.MinSize != 256 || len(cfg.Compression.Encodings) != len(Encodings) {
+		t.Errorf("Expected global compression merged onto the defaults, got %+v", cfg.Compression)
+	}
+	assets := cfg.Routes[0].Compression
+	if assets == nil || !assets.Enabled || !assets.Precompressed || assets.MinSize != 256 {
+		t.Errorf("Expected route compression to inherit global settings, got %+v", assets)
+	}
+	if raw := cfg.Routes[1].Compression; raw == nil || raw.Enabled || raw.MinSize != 256 {
+		t.Errorf("Expected compression disabled for the route, got %+v", raw)
+	}
+}
+
+func TestLoadConfigRejectsUnknownKeys(t *testing.T) {
+	viper.Reset()
+
+	file := filepath.Join(t.TempDir(), "config.yaml")
+	content := `routes:
+  - path: "/typo"
+    type: "json"
+    jsn_content: '{"a": 1}'
+`
+	if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+	viper.SetConfigFile(file)
+
+	_, err := LoadConfig()
+	var unknown *UnknownKeysError
+	if !errors.As(err, &unknown) {
+		t.Fatalf("Expected UnknownKeysError, got %v", err)
+	}
+	if len(unknown.Keys) != 1 || unknown.Keys[0].Field != "routes[0].jsn_content" || unknown.Keys[0].Suggestion != "json_content" {
+		t.Errorf("Unexpected unknown keys: %+v", unknown.Keys)
+	}
+
+	problems := unknown.ValidationErrors(file)
+	if len(problems) != 1 || problems[0].Line != 4 {
+		t.Errorf("Expected problem on line 4, got %+v", problems)
+	}
+}
+
 func TestRouteTypes(t *testing.T) {
 	tests := []struct {
 		name        string
@@ -169,6 +297,71 @@ func TestRouteTypes(t *testing.T) {
 	}
 }
 
+func TestParseGRPCCode(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected int
+		valid    bool
+	}{
+		{"", 0, true},
+		{"not_found", 5, true},
+		{"NOT_FOUND", 5, true},
+		{"16", 16, true},
+		{"17", 0, false},
+		{"-1", 0, false},
+		{"notfound", 0, false},
+	}
+
+	for _, tt := range tests {
+		code, ok := ParseGRPCCode(tt.name)
+		if ok != tt.valid || (ok && code != tt.expected) {
+			t.Errorf("ParseGRPCCode(%q) = %d, %v; expected %d, %v", tt.name, code, ok, tt.expected, tt.valid)
+		}
+	}
+}
+
+func TestRouteOverlaps(t *testing.T) {
+	tests := []struct {
+		name     string
+		a, b     Route
+		expected bool
+	}{
+		{name: "different paths", a: Route{Path: "/a"}, b: Route{Path: "/b"}, expected: false},
+		{name: "default methods", a: Route{Path: "/a"}, b: Route{Path: "/a", Methods: []string{"GET"}}, expected: true},
+		{name: "shared method", a: Route{Path: "/a", Methods: []string{"GET", "POST"}}, b: Route{Path: "/a", Methods: []string{"post"}}, expected: true},
+		{name: "different methods", a: Route{Path: "/a", Methods: []string{"GET"}}, b: Route{Path: "/a", Methods: []string{"DELETE"}}, expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.a.Overlaps(tt.b); got != tt.expected {
+				t.Errorf("Expected %v, got %v", tt.expected, got)
+			}
+			if got := tt.b.Overlaps(tt.a); got != tt.expected {
+				t.Errorf("Expected symmetric result %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestLoadConfigOpenAPISpecPath(t *testing.T) {
+	viper.Reset()
+
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"config.yaml": "openapi:\n  spec: specs/api.yaml\n"})
+	viper.SetConfigFile(filepath.Join(dir, "config.yaml"))
+
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("Expected config to load, got error: %v", err)
+	}
+	// Like file_path and the other file settings, the spec is relative to
+	// the working directory
+	if cfg.OpenAPI.Spec != "specs/api.yaml" {
+		t.Errorf("Expected spec to be kept as written, got %s", cfg.OpenAPI.Spec)
+	}
+}
+
 func TestCORSConfig(t *testing.T) {
 	cors := CORSConfig{
 		AllowOrigins:     []string{"https://example.com", "https://test.com"},
@@ -0,0 +1,236 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// UnknownKey is a configuration key that does not match any setting
+type UnknownKey struct {
+	Field      string // Dotted path of the key, e.g. routes[1].jsn_content
+	Suggestion string // Closest known key, empty when nothing is close
+	File       string // File the key was read from
+}
+
+// UnknownKeysError reports configuration keys that would otherwise be silently ignored
+type UnknownKeysError struct {
+	Keys []UnknownKey
+}
+
+// Error lists every unknown key with its suggestion
+func (e *UnknownKeysError) Error() string {
+	var b strings.Builder
+	b.WriteString("unknown configuration keys:")
+	for _, key := range e.Keys {
+		b.WriteString("\n  ")
+		if key.File != "" {
+			b.WriteString(key.File)
+			b.WriteString(": ")
+		}
+		b.WriteString(key.Field)
+		b.WriteString(": ")
+		b.WriteString(key.message())
+	}
+	return b.String()
+}
+
+// ValidationErrors converts the unknown keys into validation errors
+// annotated with their position in the file they were read from, or in file
+// when that is unknown
+func (e *UnknownKeysError) ValidationErrors(file string) []ValidationError {
+	var errs []ValidationError
+	validators := make(map[string]*validator)
+	for _, key := range e.Keys {
+		source := key.File
+		if source == "" {
+			source = file
+		}
+		v, ok := validators[source]
+		if !ok {
+			v = &validator{file: source, positions: loadPositions(source)}
+			validators[source] = v
+		}
+		v.errors = nil
+		v.add(key.Field, "%s", key.message())
+		errs = append(errs, v.errors...)
+	}
+	return errs
+}
+
+// message describes a single unknown key
+func (k UnknownKey) message() string {
+	if k.Suggestion != "" {
+		return fmt.Sprintf("unknown key (did you mean %q?)", k.Suggestion)
+	}
+	return "unknown key"
+}
+
+// findUnknownKeys walks decoded settings alongside the Go type they decode
+// into and collects keys without a matching field
+func findUnknownKeys(settings interface{}, t reflect.Type, field string) []UnknownKey {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	var unknown []UnknownKey
+	switch t.Kind() {
+	case reflect.Struct:
+		values, ok := toStringMap(settings)
+		if !ok {
+			return nil
+		}
+
+		known := make(map[string]reflect.Type)
+		var candidates []string
+		for _, f := range configFields(t) {
+			known[f.Key] = f.Type
+			candidates = append(candidates, f.Key)
+		}
+
+		keys := make([]string, 0, len(values))
+		for key := range values {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			child := key
+			if field != "" {
+				child = field + "." + key
+			}
+			fieldType, ok := known[strings.ToLower(key)]
+			if !ok {
+				unknown = append(unknown, UnknownKey{Field: child, Suggestion: suggestKey(key, candidates)})
+				continue
+			}
+			unknown = append(unknown, findUnknownKeys(values[key], fieldType, child)...)
+		}
+
+	case reflect.Slice, reflect.Array:
+		items, ok := settings.([]interface{})
+		if !ok {
+			return nil
+		}
+		for i, item := range items {
+			unknown = append(unknown, findUnknownKeys(item, t.Elem(), field+"["+strconv.Itoa(i)+"]")...)
+		}
+
+	case reflect.Map:
+		values, ok := toStringMap(settings)
+		if !ok {
+			return nil
+		}
+		for key, value := range values {
+			unknown = append(unknown, findUnknownKeys(value, t.Elem(), field+"."+key)...)
+		}
+	}
+
+	return unknown
+}
+
+// mergeSettings copies the fields of src into dst, but only those present in
+// settings, so partially configured blocks keep the defaults of their other
+// fields. Nested structs are merged recursively; slices, maps and pointers are
+// replaced as a whole.
+func mergeSettings(dst, src reflect.Value, settings map[string]interface{}) {
+	t := dst.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		key, _, _ := strings.Cut(f.Tag.Get("mapstructure"), ",")
+		if key == "" {
+			key = strings.ToLower(f.Name)
+		}
+
+		value, present := lookupKey(settings, key)
+		if !present {
+			continue
+		}
+
+		if f.Type.Kind() == reflect.Struct {
+			if nested, ok := toStringMap(value); ok {
+				mergeSettings(dst.Field(i), src.Field(i), nested)
+				continue
+			}
+		}
+		dst.Field(i).Set(src.Field(i))
+	}
+}
+
+// lookupKey finds a key in settings, ignoring case
+func lookupKey(settings map[string]interface{}, key string) (interface{}, bool) {
+	if value, ok := settings[key]; ok {
+		return value, true
+	}
+	for k, value := range settings {
+		if strings.EqualFold(k, key) {
+			return value, true
+		}
+	}
+	return nil, false
+}
+
+// toStringMap converts the map types produced by the config decoders
+func toStringMap(value interface{}) (map[string]interface{}, bool) {
+	switch m := value.(type) {
+	case map[string]interface{}:
+		return m, true
+	case map[interface{}]interface{}:
+		converted := make(map[string]interface{}, len(m))
+		for k, v := range m {
+			converted[fmt.Sprint(k)] = v
+		}
+		return converted, true
+	}
+	return nil, false
+}
+
+// suggestKey returns the candidate closest to key, if it is close enough to
+// be a plausible typo
+func suggestKey(key string, candidates []string) string {
+	key = strings.ToLower(key)
+	normalized := strings.NewReplacer("_", "", "-", "").Replace(key)
+
+	best, bestDistance := "", -1
+	for _, candidate := range candidates {
+		// Missing or extra separators are the most common mistake
+		if strings.ReplaceAll(candidate, "_", "") == normalized {
+			return candidate
+		}
+		d := levenshtein(key, candidate)
+		if bestDistance < 0 || d < bestDistance {
+			best, bestDistance = candidate, d
+		}
+	}
+
+	if bestDistance >= 0 && bestDistance <= max(2, len(best)/3) {
+		return best
+	}
+	return ""
+}
+
+// levenshtein computes the edit distance between two strings
+func levenshtein(a, b string) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(b)]
+}
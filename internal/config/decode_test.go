@@ -0,0 +1,80 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSuggestKey(t *testing.T) {
+	candidates := []string{"path", "type", "file_path", "json_content", "content_type", "cors"}
+
+	tests := []struct {
+		key      string
+		expected string
+	}{
+		{"jsn_content", "json_content"},
+		{"filepath", "file_path"},
+		{"file-path", "file_path"},
+		{"contenttype", "content_type"},
+		{"tpye", "type"},
+		{"completely_unrelated", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			if got := suggestKey(tt.key, candidates); got != tt.expected {
+				t.Errorf("Expected suggestion %q for %s, got %q", tt.expected, tt.key, got)
+			}
+		})
+	}
+}
+
+func TestFindUnknownKeys(t *testing.T) {
+	settings := map[string]interface{}{
+		"port": 8081,
+		"cors": map[string]interface{}{"max_age": 10, "allow_origin": []interface{}{"*"}},
+		"routes": []interface{}{
+			map[string]interface{}{"path": "/a", "json_content": "{}"},
+			map[string]interface{}{"path": "/b", "jsn_content": "{}"},
+		},
+		"oidc": map[string]interface{}{
+			"users": []interface{}{
+				// Claims are free-form and never reported
+				map[string]interface{}{"subject": "u", "claims": map[string]interface{}{"anything": true}},
+			},
+		},
+	}
+
+	unknown := findUnknownKeys(settings, reflect.TypeOf(Config{}), "")
+
+	expected := []UnknownKey{
+		{Field: "cors.allow_origin", Suggestion: "allow_origins"},
+		{Field: "routes[1].jsn_content", Suggestion: "json_content"},
+	}
+	if !reflect.DeepEqual(unknown, expected) {
+		t.Errorf("Expected unknown keys %v, got %v", expected, unknown)
+	}
+}
+
+func TestMergeSettings(t *testing.T) {
+	dst := DefaultConfig()
+	src := Config{CORS: CORSConfig{MaxAge: 60}}
+
+	settings := map[string]interface{}{
+		"cors": map[string]interface{}{"max_age": 60},
+	}
+	mergeSettings(reflect.ValueOf(dst).Elem(), reflect.ValueOf(&src).Elem(), settings)
+
+	if dst.CORS.MaxAge != 60 {
+		t.Errorf("Expected max_age 60, got %d", dst.CORS.MaxAge)
+	}
+	if len(dst.CORS.AllowOrigins) != 1 || dst.CORS.AllowOrigins[0] != "*" {
+		t.Errorf("Expected default allow_origins to be kept, got %v", dst.CORS.AllowOrigins)
+	}
+	if !dst.CORS.AllowCredentials {
+		t.Error("Expected default allow_credentials to be kept")
+	}
+	if len(dst.Routes) != 1 {
+		t.Errorf("Expected default routes to be kept, got %d", len(dst.Routes))
+	}
+}
@@ -0,0 +1,85 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"sort"
+
+	"gopkg.in/yaml.v3"
+)
+
+// EncodeRoutes renders routes as a YAML file that can be included from a
+// configuration. Fields are written in declaration order and unset fields
+// are left out.
+func EncodeRoutes(routes []Route) ([]byte, error) {
+	root := &yaml.Node{Kind: yaml.MappingNode}
+	setMappingValue(root, "routes", encodeNode(reflect.ValueOf(routes)))
+
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(root); err != nil {
+		return nil, fmt.Errorf("unable to encode routes: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// encodeNode converts a configuration value to a YAML node keyed by the
+// mapstructure tags, or nil for a zero value
+func encodeNode(v reflect.Value) *yaml.Node {
+	if !v.IsValid() || v.IsZero() {
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		return encodeNode(v.Elem())
+
+	case reflect.Struct:
+		node := &yaml.Node{Kind: yaml.MappingNode}
+		for _, f := range configFields(v.Type()) {
+			if child := encodeNode(v.Field(f.Index)); child != nil {
+				setMappingValue(node, f.Key, child)
+			}
+		}
+		if len(node.Content) == 0 {
+			return nil
+		}
+		return node
+
+	case reflect.Map:
+		node := &yaml.Node{Kind: yaml.MappingNode}
+		keys := v.MapKeys()
+		sort.Slice(keys, func(i, j int) bool { return fmt.Sprint(keys[i]) < fmt.Sprint(keys[j]) })
+		for _, key := range keys {
+			child := encodeNode(v.MapIndex(key))
+			if child == nil {
+				child = &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: ""}
+			}
+			setMappingValue(node, fmt.Sprint(key), child)
+		}
+		return node
+
+	case reflect.Slice, reflect.Array:
+		// Lists of scalars, such as methods, are written inline
+		node := &yaml.Node{Kind: yaml.SequenceNode, Style: yaml.FlowStyle}
+		for i := 0; i < v.Len(); i++ {
+			child := encodeNode(v.Index(i))
+			if child == nil {
+				child = &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!null", Value: "null"}
+			}
+			if child.Kind != yaml.ScalarNode {
+				node.Style = 0
+			}
+			node.Content = append(node.Content, child)
+		}
+		return node
+	}
+
+	node := &yaml.Node{}
+	if err := node.Encode(v.Interface()); err != nil {
+		return nil
+	}
+	return node
+}
@@ -0,0 +1,59 @@
+package config
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestEncodeRoutes(t *testing.T) {
+	routes := []Route{
+		{
+			Path:        "/pets/{id}",
+			Type:        "json",
+			JSONContent: "{\n  \"id\": 1\n}",
+			ContentType: "application/json",
+			Methods:     []string{"GET"},
+			Status:      200,
+			Headers:     map[string]string{"X-Total": "3"},
+		},
+		{Path: "/pets/{id}", Type: "json", Methods: []string{"DELETE"}, Status: 204, Source: "ignored.yaml"},
+	}
+
+	data, err := EncodeRoutes(routes)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	out := string(data)
+	for _, expected := range []string{"  - path: /pets/{id}", "methods: [GET]", "X-Total: \"3\""} {
+		if !strings.Contains(out, expected) {
+			t.Errorf("Expected output to contain %q, got:\n%s", expected, out)
+		}
+	}
+	// Unset and internal fields are left out
+	for _, unexpected := range []string{"file_path", "cors", "source"} {
+		if strings.Contains(out, unexpected) {
+			t.Errorf("Expected output without %q, got:\n%s", unexpected, out)
+		}
+	}
+
+	// The file can be included as is
+	viper.Reset()
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"config.yaml": "include: [routes.yaml]\n",
+		"routes.yaml": out,
+	})
+	viper.SetConfigFile(filepath.Join(dir, "config.yaml"))
+
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("Expected encoded routes to load, got error: %v", err)
+	}
+	if len(cfg.Routes) != 2 || cfg.Routes[0].JSONContent != routes[0].JSONContent || cfg.Routes[1].Status != 204 {
+		t.Errorf("Unexpected routes after round trip: %+v", cfg.Routes)
+	}
+}
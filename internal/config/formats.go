@@ -0,0 +1,144 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"github.com/hashicorp/hcl"
+	"github.com/spf13/viper"
+)
+
+// Formats lists the supported configuration file extensions. Files with any
+// other extension, or none, are read as YAML.
+var Formats = []string{"yaml", "yml", "json", "toml", "hcl"}
+
+// searchPaths are the directories searched for config.<ext> when no file is
+// set explicitly
+var searchPaths = []string{".", "$HOME/.dummy_http_passkeys", "/etc/dummy_http_passkeys"}
+
+// configFormat returns the format of a configuration file from its extension
+func configFormat(file string) string {
+	ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(file), "."))
+	for _, format := range Formats {
+		if ext == format {
+			return format
+		}
+	}
+	return "yaml"
+}
+
+// searchConfigFile returns the first config.<ext> found in the search paths,
+// or an empty path
+func searchConfigFile() string {
+	for _, dir := range searchPaths {
+		for _, format := range Formats {
+			file := filepath.Join(os.ExpandEnv(dir), "config."+format)
+			if info, err := os.Stat(file); err == nil && !info.IsDir() {
+				return file
+			}
+		}
+	}
+	return ""
+}
+
+// decodeFile reads a configuration file of any supported format into a
+// settings map with lowercase keys, the way viper reports them
+func decodeFile(file string) (map[string]interface{}, error) {
+	format := configFormat(file)
+	if format == "hcl" {
+		return decodeHCL(file)
+	}
+
+	v := viper.New()
+	v.SetConfigFile(file)
+	v.SetConfigType(format)
+	if err := v.ReadInConfig(); err != nil {
+		return nil, err
+	}
+	return v.AllSettings(), nil
+}
+
+// decodeHCL reads an HCL file. Viper no longer ships an HCL codec.
+func decodeHCL(file string) (map[string]interface{}, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var settings map[string]interface{}
+	if err := hcl.Unmarshal(data, &settings); err != nil {
+		return nil, err
+	}
+	normalized, _ := toStringMap(normalizeHCL(settings, reflect.TypeOf(Config{})))
+	return normalized, nil
+}
+
+// normalizeHCL reshapes decoded HCL to match the other formats. HCL decodes
+// every block, even a single one, as a list of maps; blocks are unwrapped
+// where the configuration expects an object, and kept as lists where it
+// expects a list of objects, as with repeated routes blocks.
+func normalizeHCL(value interface{}, t reflect.Type) interface{} {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	if blocks, ok := value.([]map[string]interface{}); ok {
+		items := make([]interface{}, len(blocks))
+		for i, block := range blocks {
+			items[i] = block
+		}
+		value = items
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		if items, ok := value.([]interface{}); ok && len(items) == 1 {
+			value = items[0]
+		}
+		values, ok := toStringMap(value)
+		if !ok {
+			return value
+		}
+
+		fields := make(map[string]reflect.Type)
+		for _, f := range configFields(t) {
+			fields[f.Key] = f.Type
+		}
+		normalized := make(map[string]interface{}, len(values))
+		for key, v := range values {
+			key = strings.ToLower(key)
+			if fieldType, ok := fields[key]; ok {
+				v = normalizeHCL(v, fieldType)
+			}
+			normalized[key] = v
+		}
+		return normalized
+
+	case reflect.Map:
+		if items, ok := value.([]interface{}); ok && len(items) == 1 {
+			value = items[0]
+		}
+		values, ok := toStringMap(value)
+		if !ok {
+			return value
+		}
+		for key, v := range values {
+			values[key] = normalizeHCL(v, t.Elem())
+		}
+		return values
+
+	case reflect.Slice, reflect.Array:
+		items, ok := value.([]interface{})
+		if !ok {
+			return value
+		}
+		for i, item := range items {
+			items[i] = normalizeHCL(item, t.Elem())
+		}
+		return items
+	}
+
+	return value
+}
@@ -0,0 +1,178 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestConfigFormat(t *testing.T) {
+	tests := map[string]string{
+		"config.yaml":         "yaml",
+		"config.YML":          "yml",
+		"mock.json":           "json",
+		"mock.toml":           "toml",
+		"mock.hcl":            "hcl",
+		"mock-config":         "yaml",
+		"settings.conf":       "yaml",
+		"config.staging.json": "json",
+	}
+	for file, expected := range tests {
+		if got := configFormat(file); got != expected {
+			t.Errorf("configFormat(%q) = %q, expected %q", file, got, expected)
+		}
+	}
+}
+
+func TestLoadConfigFormats(t *testing.T) {
+	files := map[string]string{
+		"config.yaml": `port: 9001
+cors:
+  allow_origins: ["https://app.example.com"]
+routes:
+  - path: "/a"
+    type: "json"
+    json_content: '{"a": 1}'
+    cors:
+      allow_credentials: false
+  - path: "/b"
+    type: "dummy"
+`,
+		"config.json": `{
+  "port": 9001,
+  "cors": {"allow_origins": ["https://app.example.com"]},
+  "routes": [
+    {"path": "/a", "type": "json", "json_content": "{\"a\": 1}", "cors": {"allow_credentials": false}},
+    {"path": "/b", "type": "dummy"}
+  ]
+}
+`,
+		"config.toml": `port = 9001
+
+[cors]
+allow_origins = ["https://app.example.com"]
+
+[[routes]]
+path = "/a"
+type = "json"
+json_content = '{"a": 1}'
+
+[routes.cors]
+allow_credentials = false
+
+[[routes]]
+path = "/b"
+type = "dummy"
+`,
+		"config.hcl": `port = 9001
+
+cors {
+  allow_origins = ["https://app.example.com"]
+}
+
+routes {
+  path         = "/a"
+  type         = "json"
+  json_content = "{\"a\": 1}"
+
+  cors {
+    allow_credentials = false
+  }
+}
+
+routes {
+  path = "/b"
+  type = "dummy"
+}
+`,
+		// Arbitrary names without a known extension are read as YAML
+		"mock-config": `port: 9001
+cors: {allow_origins: ["https://app.example.com"]}
+routes:
+  - {path: "/a", type: "json", json_content: '{"a": 1}', cors: {allow_credentials: false}}
+  - {path: "/b", type: "dummy"}
+`,
+	}
+
+	for name, content := range files {
+		t.Run(name, func(t *testing.T) {
+			viper.Reset()
+
+			file := filepath.Join(t.TempDir(), name)
+			if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+				t.Fatalf("Failed to write config: %v", err)
+			}
+			viper.SetConfigFile(file)
+
+			cfg, err := LoadConfig()
+			if err != nil {
+				t.Fatalf("Expected config to load, got error: %v", err)
+			}
+
+			if cfg.Port != 9001 {
+				t.Errorf("Expected port 9001, got %d", cfg.Port)
+			}
+			if len(cfg.Routes) != 2 || cfg.Routes[0].JSONContent != `{"a": 1}` || cfg.Routes[1].Path != "/b" {
+				t.Fatalf("Unexpected routes: %+v", cfg.Routes)
+			}
+
+			cors := cfg.Routes[0].CORS
+			if cors == nil || cors.AllowCredentials || cors.AllowOrigins[0] != "https://app.example.com" {
+				t.Errorf("Expected route cors merged onto global settings, got %+v", cors)
+			}
+			// Unset fields keep their defaults
+			if len(cfg.CORS.AllowMethods) != 3 {
+				t.Errorf("Expected default methods, got %v", cfg.CORS.AllowMethods)
+			}
+		})
+	}
+}
+
+func TestLoadConfigHCLSingleRoute(t *testing.T) {
+	viper.Reset()
+
+	// A single block still decodes as a list of routes
+	file := filepath.Join(t.TempDir(), "config.hcl")
+	content := `routes {
+  path = "/only"
+  type = "dummy"
+}
+
+oidc {
+  enabled = true
+  users = [{ subject = "user-1", claims = { name = "Test User" } }]
+}
+`
+	if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+	viper.SetConfigFile(file)
+
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("Expected config to load, got error: %v", err)
+	}
+	if len(cfg.Routes) != 1 || cfg.Routes[0].Path != "/only" {
+		t.Errorf("Unexpected routes: %+v", cfg.Routes)
+	}
+	if !cfg.OIDC.Enabled || cfg.OIDC.Users[0].Claims["name"] != "Test User" {
+		t.Errorf("Unexpected oidc settings: %+v", cfg.OIDC)
+	}
+}
+
+func TestSearchConfigFile(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "config.toml"), []byte("port = 1\n"), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	saved := searchPaths
+	searchPaths = []string{filepath.Join(dir, "missing"), dir}
+	defer func() { searchPaths = saved }()
+
+	if got := searchConfigFile(); got != filepath.Join(dir, "config.toml") {
+		t.Errorf("Expected config.toml to be found, got %q", got)
+	}
+}
@@ -0,0 +1,190 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// variablePattern matches the name and modifier of a variable reference
+var variablePattern = regexp.MustCompile(`(?s)^([A-Za-z_][A-Za-z0-9_]*)(?:(:?[-?])(.*))?$`)
+
+// interpolateSettings expands references in every string of decoded
+// settings. Relative file references are resolved against dir.
+func interpolateSettings(value interface{}, dir, field string) (interface{}, error) {
+	switch v := value.(type) {
+	case string:
+		expanded, err := interpolate(v, dir)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", field, err)
+		}
+		return expanded, nil
+
+	case []interface{}:
+		for i, item := range v {
+			expanded, err := interpolateSettings(item, dir, field+"["+strconv.Itoa(i)+"]")
+			if err != nil {
+				return nil, err
+			}
+			v[i] = expanded
+		}
+		return v, nil
+
+	case []string:
+		for i, item := range v {
+			expanded, err := interpolate(item, dir)
+			if err != nil {
+				return nil, fmt.Errorf("%s[%d]: %w", field, i, err)
+			}
+			v[i] = expanded
+		}
+		return v, nil
+	}
+
+	values, ok := toStringMap(value)
+	if !ok {
+		return value, nil
+	}
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys) // Report the first error deterministically
+
+	for _, key := range keys {
+		child := key
+		if field != "" {
+			child = field + "." + key
+		}
+		expanded, err := interpolateSettings(values[key], dir, child)
+		if err != nil {
+			return nil, err
+		}
+		values[key] = expanded
+	}
+	return values, nil
+}
+
+// interpolate expands the references in a single value:
+//
+//	${VAR}           value of VAR, empty (with a warning) when unset
+//	${VAR:-default}  default when VAR is unset or empty
+//	${VAR-default}   default when VAR is unset
+//	${VAR:?message}  error when VAR is unset or empty
+//	${VAR?message}   error when VAR is unset
+//	${file:path}     contents of path, without the trailing newline
+//	$$               a literal $
+//
+// Braces inside a reference nest, so defaults may hold JSON or further
+// references, which are expanded only when the default is used.
+func interpolate(value, dir string) (string, error) {
+	if !strings.Contains(value, "$") {
+		return value, nil
+	}
+
+	var b strings.Builder
+	var firstErr error
+	for i := 0; i < len(value); i++ {
+		if value[i] != '$' || i+1 == len(value) {
+			b.WriteByte(value[i])
+			continue
+		}
+		switch value[i+1] {
+		case '$':
+			b.WriteByte('$')
+			i++
+		case '{':
+			end := closingBrace(value, i+2)
+			if end < 0 {
+				// Unterminated references are kept as written
+				b.WriteString(value[i:])
+				return b.String(), firstErr
+			}
+			result, err := resolveReference(value[i+2:end], dir)
+			if err != nil && firstErr == nil {
+				firstErr = err
+			}
+			b.WriteString(result)
+			i = end
+		default:
+			b.WriteByte('$')
+		}
+	}
+	return b.String(), firstErr
+}
+
+// closingBrace returns the index of the brace closing a reference whose
+// inside starts at start, or -1 when there is none
+func closingBrace(value string, start int) int {
+	depth := 0
+	for i := start; i < len(value); i++ {
+		switch value[i] {
+		case '{':
+			depth++
+		case '}':
+			if depth == 0 {
+				return i
+			}
+			depth--
+		}
+	}
+	return -1
+}
+
+// resolveReference resolves the inside of a ${...} reference
+func resolveReference(ref, dir string) (string, error) {
+	if path, ok := strings.CutPrefix(ref, "file:"); ok {
+		return readReference(path, dir)
+	}
+
+	m := variablePattern.FindStringSubmatch(ref)
+	if m == nil {
+		return "", fmt.Errorf("invalid reference ${%s}", ref)
+	}
+	name, modifier, arg := m[1], m[2], m[3]
+
+	value, set := os.LookupEnv(name)
+	// The colon forms also treat an empty variable as unset
+	if strings.HasPrefix(modifier, ":") && value == "" {
+		set = false
+	}
+
+	switch {
+	case set:
+		return value, nil
+	case strings.HasSuffix(modifier, "-"):
+		return interpolate(arg, dir)
+	case strings.HasSuffix(modifier, "?"):
+		if arg == "" {
+			arg = "required variable is not set"
+		}
+		message, err := interpolate(arg, dir)
+		if err != nil {
+			return "", err
+		}
+		return "", fmt.Errorf("%s: %s", name, message)
+	default:
+		fmt.Fprintf(os.Stderr, "Warning: %s is not set, using an empty string\n", name)
+		return "", nil
+	}
+}
+
+// readReference loads the value of a ${file:path} reference
+func readReference(path, dir string) (string, error) {
+	if path == "" {
+		return "", fmt.Errorf("invalid reference ${file:}: path is required")
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(dir, path)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("unable to read referenced file: %w", err)
+	}
+	value := strings.TrimSuffix(string(data), "\n")
+	return strings.TrimSuffix(value, "\r"), nil
+}
@@ -0,0 +1,122 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestInterpolate(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "token"), []byte("s3cret\n"), 0600); err != nil {
+		t.Fatalf("Failed to write token: %v", err)
+	}
+
+	t.Setenv("MOCK_HOST", "api.example.com")
+	t.Setenv("MOCK_EMPTY", "")
+
+	tests := []struct {
+		name     string
+		value    string
+		expected string
+		errText  string
+	}{
+		{name: "plain value", value: "no references", expected: "no references"},
+		{name: "variable", value: "https://${MOCK_HOST}/v1", expected: "https://api.example.com/v1"},
+		{name: "unset variable", value: "[${MOCK_UNSET}]", expected: "[]"},
+		{name: "default when unset", value: "${MOCK_UNSET:-8081}", expected: "8081"},
+		{name: "default when empty", value: "${MOCK_EMPTY:-fallback}", expected: "fallback"},
+		{name: "dash keeps empty", value: "[${MOCK_EMPTY-fallback}]", expected: "[]"},
+		{name: "default with colon", value: "${MOCK_UNSET:-http://localhost:3000}", expected: "http://localhost:3000"},
+		{name: "required set", value: "${MOCK_HOST:?host is required}", expected: "api.example.com"},
+		{name: "required unset", value: "${MOCK_UNSET:?host is required}", errText: "MOCK_UNSET: host is required"},
+		{name: "required empty", value: "${MOCK_EMPTY:?}", errText: "MOCK_EMPTY: required variable is not set"},
+		{name: "file reference", value: "Bearer ${file:token}", expected: "Bearer s3cret"},
+		{name: "missing file", value: "${file:missing}", errText: "unable to read referenced file"},
+		{name: "escaped dollar", value: "$${MOCK_HOST} costs $$5", expected: "${MOCK_HOST} costs $5"},
+		{name: "lone dollar", value: "costs $5", expected: "costs $5"},
+		{name: "invalid name", value: "${1BAD}", errText: "invalid reference"},
+		{name: "default with braces", value: `${MOCK_UNSET:-{"a":{"b":1}}}`, expected: `{"a":{"b":1}}`},
+		{name: "set ignores braced default", value: `${MOCK_HOST:-{"a":1}}/v1`, expected: "api.example.com/v1"},
+		{name: "nested default", value: "${MOCK_UNSET:-https://${MOCK_HOST}}", expected: "https://api.example.com"},
+		{name: "nested default unset", value: "${MOCK_UNSET:-${MOCK_EMPTY:-8081}}", expected: "8081"},
+		{name: "nested message", value: "${MOCK_UNSET:?set it, e.g. to ${MOCK_HOST}}", errText: "MOCK_UNSET: set it, e.g. to api.example.com"},
+		{name: "unterminated reference", value: "${MOCK_HOST", expected: "${MOCK_HOST"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := interpolate(tt.value, dir)
+			if tt.errText != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.errText) {
+					t.Fatalf("Expected error containing %q, got %v", tt.errText, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if got != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestInterpolateSettingsReportsField(t *testing.T) {
+	settings := map[string]interface{}{
+		"routes": []interface{}{
+			map[string]interface{}{"path": "/ok"},
+			map[interface{}]interface{}{"path": "${MOCK_UNSET:?path is required}"},
+		},
+	}
+
+	_, err := interpolateSettings(settings, ".", "")
+	if err == nil || !strings.HasPrefix(err.Error(), "routes[1].path: ") {
+		t.Errorf("Expected error for routes[1].path, got %v", err)
+	}
+}
+
+func TestLoadConfigInterpolation(t *testing.T) {
+	viper.Reset()
+
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"config.yaml": `port: ${MOCK_TEST_PORT:-8081}
+cors:
+  allow_origins: ["${MOCK_TEST_ORIGIN}"]
+include: ["${MOCK_TEST_ROUTES:-routes.d}/*.yaml"]
+routes:
+  - path: "/token"
+    type: "json"
+    json_content: '{"token": "${file:secrets/token}"}'
+`,
+		"secrets/token":   "abc123\n",
+		"routes.d/a.yaml": "routes:\n  - path: \"/${MOCK_TEST_PREFIX:-api}/a\"\n    type: dummy\n",
+	})
+	viper.SetConfigFile(filepath.Join(dir, "config.yaml"))
+
+	t.Setenv("MOCK_TEST_PORT", "9100")
+	t.Setenv("MOCK_TEST_ORIGIN", "https://dev.example.com")
+
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("Expected config to load, got error: %v", err)
+	}
+
+	if cfg.Port != 9100 {
+		t.Errorf("Expected interpolated port 9100, got %d", cfg.Port)
+	}
+	if cfg.CORS.AllowOrigins[0] != "https://dev.example.com" {
+		t.Errorf("Expected interpolated origin, got %v", cfg.CORS.AllowOrigins)
+	}
+	if cfg.Routes[0].JSONContent != `{"token": "abc123"}` {
+		t.Errorf("Expected file reference to be loaded, got %s", cfg.Routes[0].JSONContent)
+	}
+	if len(cfg.Routes) != 2 || cfg.Routes[1].Path != "/api/a" {
+		t.Errorf("Expected interpolated include and path, got %+v", cfg.Routes)
+	}
+}
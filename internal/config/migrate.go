@@ -0,0 +1,416 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// CurrentVersion is the configuration schema version written by migrate
+const CurrentVersion = "1.1.0"
+
+// Versions lists every configuration schema version, oldest first. Files
+// without a version are treated as the oldest.
+var Versions = []string{"1.0.0", "1.1.0"}
+
+// migration upgrades a configuration document to version
+type migration struct {
+	version string
+	apply   func(root *yaml.Node) []Deprecation
+}
+
+// migrations are applied in order to documents older than their version
+var migrations = []migration{
+	{version: "1.1.0", apply: migrateV1_1},
+}
+
+// Deprecation describes a setting rewritten by a migration
+type Deprecation struct {
+	File    string
+	Field   string
+	Message string
+}
+
+// String formats the deprecation as file: field: message
+func (d Deprecation) String() string {
+	return ValidationError{File: d.File, Field: d.Field, Message: d.Message}.Error()
+}
+
+// versionIndex returns the position of version in Versions
+func versionIndex(version string) (int, error) {
+	if version == "" {
+		return 0, nil
+	}
+	for i, v := range Versions {
+		if v == version {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("unsupported configuration version %q (supported: %s)", version, strings.Join(Versions, ", "))
+}
+
+// migrateNode applies the migrations newer than from to a document. The
+// version key is updated when present, or added when setVersion is true.
+func migrateNode(root *yaml.Node, from string, setVersion bool) ([]Deprecation, error) {
+	index, err := versionIndex(from)
+	if err != nil {
+		return nil, err
+	}
+	if root.Kind != yaml.MappingNode {
+		return nil, nil
+	}
+
+	var deprecations []Deprecation
+	for _, m := range migrations {
+		if i, _ := versionIndex(m.version); i > index {
+			deprecations = append(deprecations, m.apply(root)...)
+		}
+	}
+
+	if version := mappingValue(root, "version"); version != nil {
+		version.Value, version.Tag, version.Style = CurrentVersion, "!!str", yaml.DoubleQuotedStyle
+	} else if setVersion {
+		// Prepend, so the version is the first thing in the file
+		key := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: "version"}
+		value := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: CurrentVersion, Style: yaml.DoubleQuotedStyle}
+		root.Content = append([]*yaml.Node{key, value}, root.Content...)
+	}
+
+	return deprecations, nil
+}
+
+// migrateSettings migrates decoded settings in memory and returns the
+// deprecations found. Files without a version are migrated from the oldest
+// version, which is harmless since migrations only rewrite deprecated forms.
+func migrateSettings(settings map[string]interface{}) ([]Deprecation, error) {
+	from := ""
+	version, hasVersion := lookupKey(settings, "version")
+	if hasVersion {
+		from = fmt.Sprint(version)
+	}
+
+	var root yaml.Node
+	if err := root.Encode(settings); err != nil {
+		return nil, err
+	}
+	deprecations, err := migrateNode(&root, from, false)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(deprecations) > 0 {
+		migrated := make(map[string]interface{})
+		if err := root.Decode(&migrated); err != nil {
+			return nil, err
+		}
+		for key := range settings {
+			delete(settings, key)
+		}
+		for key, value := range migrated {
+			settings[key] = value
+		}
+	}
+	if hasVersion {
+		settings["version"] = CurrentVersion
+	}
+	return deprecations, nil
+}
+
+// warnDeprecations prints the deprecations found while loading a file
+func warnDeprecations(file string, deprecations []Deprecation) {
+	for _, d := range deprecations {
+		d.File = file
+		fmt.Fprintf(os.Stderr, "Warning: %s\n", d)
+	}
+	if len(deprecations) > 0 {
+		fmt.Fprintf(os.Stderr, "Warning: %s uses deprecated settings; run mock-cors-server migrate to update it\n", file)
+	}
+}
+
+// migrateV1_1 makes route types explicit and turns comma separated strings
+// into lists
+func migrateV1_1(root *yaml.Node) []Deprecation {
+	var deprecations []Deprecation
+
+	if routes := mappingValue(root, "routes"); routes != nil && routes.Kind == yaml.SequenceNode {
+		for i, route := range routes.Content {
+			if route.Kind != yaml.MappingNode {
+				continue
+			}
+			field := fmt.Sprintf("routes[%d].type", i)
+			typ := mappingValue(route, "type")
+			switch {
+			case typ == nil:
+				setMappingValue(route, "type", &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: "dummy", Style: yaml.DoubleQuotedStyle})
+			case typ.Kind == yaml.ScalarNode && typ.Value == "":
+				typ.Value, typ.Tag = "dummy", "!!str"
+			default:
+				continue
+			}
+			deprecations = append(deprecations, Deprecation{Field: field, Message: `routes without a type are deprecated; set to "dummy"`})
+		}
+	}
+
+	walkNode(root, reflect.TypeOf(Config{}), "", func(node *yaml.Node, t reflect.Type, field string) {
+		if t.Kind() != reflect.Slice || t.Elem().Kind() != reflect.String || node.Kind != yaml.ScalarNode || node.Tag == "!!null" {
+			return
+		}
+		// A reference may expand to a comma separated list, which is still
+		// split when decoding
+		if strings.Contains(node.Value, "${") {
+			return
+		}
+		items := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq", Style: yaml.FlowStyle}
+		for _, item := range strings.Split(node.Value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items.Content = append(items.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: item, Style: yaml.DoubleQuotedStyle})
+			}
+		}
+		items.HeadComment, items.LineComment, items.FootComment = node.HeadComment, node.LineComment, node.FootComment
+		*node = *items
+		deprecations = append(deprecations, Deprecation{Field: field, Message: "comma separated lists are deprecated; converted to a list"})
+	})
+
+	return deprecations
+}
+
+// walkNode calls visit for every value of a document alongside the Go type
+// it decodes into
+func walkNode(node *yaml.Node, t reflect.Type, field string, visit func(node *yaml.Node, t reflect.Type, field string)) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	visit(node, t, field)
+
+	switch {
+	case t.Kind() == reflect.Struct && node.Kind == yaml.MappingNode:
+		fields := make(map[string]reflect.Type)
+		for _, f := range configFields(t) {
+			fields[f.Key] = f.Type
+		}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key := strings.ToLower(node.Content[i].Value)
+			if fieldType, ok := fields[key]; ok {
+				child := key
+				if field != "" {
+					child = field + "." + key
+				}
+				walkNode(node.Content[i+1], fieldType, child, visit)
+			}
+		}
+	case t.Kind() == reflect.Slice && node.Kind == yaml.SequenceNode:
+		for i, item := range node.Content {
+			walkNode(item, t.Elem(), field+"["+strconv.Itoa(i)+"]", visit)
+		}
+	}
+}
+
+// mappingValue returns the value of a key in a mapping node, ignoring case
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if strings.EqualFold(node.Content[i].Value, key) {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// setMappingValue sets a key in a mapping node, appending it when missing
+func setMappingValue(node *yaml.Node, key string, value *yaml.Node) {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if strings.EqualFold(node.Content[i].Value, key) {
+			node.Content[i+1] = value
+			return
+		}
+	}
+	node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}, value)
+}
+
+// MigratedFile is a configuration file rewritten to the current version
+type MigratedFile struct {
+	File         string
+	Data         []byte // Migrated content, in the format of File
+	Deprecations []Deprecation
+	Manual       bool // The format cannot be rewritten; Data is empty and the changes are made by hand
+}
+
+// MigrateFiles migrates a configuration file, the files it includes and,
+// when env is set, its environment overlay. Files that are already current
+// are left out. References such as ${VAR} are kept as they are.
+func MigrateFiles(file, env string) ([]MigratedFile, error) {
+	files := []string{file}
+	if env != "" {
+		files = append(files, overlayFile(file, env))
+	}
+
+	settings, err := decodeFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("error reading config file %s: %w", file, err)
+	}
+	var patterns []string
+	if include, ok := lookupKey(settings, "include"); ok {
+		// Include patterns may contain references
+		if include, err = interpolateSettings(include, filepath.Dir(file), "include"); err != nil {
+			return nil, fmt.Errorf("error reading config file %s: %w", file, err)
+		}
+		if err := decodeStrict(include, &patterns); err != nil {
+			return nil, fmt.Errorf("invalid include in %s: %w", file, err)
+		}
+	}
+	included, err := includedFiles(patterns, filepath.Dir(file))
+	if err != nil {
+		return nil, err
+	}
+	files = append(files, included...)
+
+	var migrated []MigratedFile
+	for i, path := range files {
+		// Only the main file gets a version; included files may not carry one
+		m, err := migrateFile(path, i == 0)
+		if err != nil {
+			return nil, err
+		}
+		if m != nil {
+			migrated = append(migrated, *m)
+		}
+	}
+	return migrated, nil
+}
+
+// migrateFile migrates a single file, returning nil when nothing changed
+func migrateFile(file string, setVersion bool) (*MigratedFile, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	format := configFormat(file)
+	var root yaml.Node
+	switch format {
+	case "yaml", "yml", "json":
+		// JSON is YAML, and parsing as YAML keeps comments and key order
+		if err := yaml.Unmarshal(data, &root); err != nil {
+			return nil, fmt.Errorf("error reading config file %s: %w", file, err)
+		}
+	default:
+		settings, err := decodeFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("error reading config file %s: %w", file, err)
+		}
+		if err := root.Encode(settings); err != nil {
+			return nil, err
+		}
+	}
+
+	doc := &root
+	if doc.Kind == yaml.DocumentNode && len(doc.Content) > 0 {
+		doc = doc.Content[0]
+	}
+	from := ""
+	if version := mappingValue(doc, "version"); version != nil {
+		from = version.Value
+	}
+	if from == CurrentVersion {
+		return nil, nil
+	}
+
+	deprecations, err := migrateNode(doc, from, setVersion)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	if len(deprecations) == 0 && from == "" && !setVersion {
+		return nil, nil
+	}
+	for i := range deprecations {
+		deprecations[i].File = file
+	}
+
+	out := &MigratedFile{File: file, Deprecations: deprecations}
+	switch format {
+	case "yaml", "yml":
+		var buf bytes.Buffer
+		enc := yaml.NewEncoder(&buf)
+		enc.SetIndent(2)
+		if err := enc.Encode(&root); err != nil {
+			return nil, err
+		}
+		out.Data = buf.Bytes()
+	case "json":
+		var buf bytes.Buffer
+		if err := writeJSON(&buf, doc, ""); err != nil {
+			return nil, err
+		}
+		buf.WriteString("\n")
+		out.Data = buf.Bytes()
+	case "toml":
+		var settings map[string]interface{}
+		if err := doc.Decode(&settings); err != nil {
+			return nil, err
+		}
+		if out.Data, err = toml.Marshal(settings); err != nil {
+			return nil, err
+		}
+	default:
+		out.Manual = true
+	}
+	return out, nil
+}
+
+// writeJSON encodes a YAML node as indented JSON, keeping the key order
+func writeJSON(buf *bytes.Buffer, node *yaml.Node, indent string) error {
+	switch node.Kind {
+	case yaml.DocumentNode:
+		if len(node.Content) == 0 {
+			buf.WriteString("null")
+			return nil
+		}
+		return writeJSON(buf, node.Content[0], indent)
+	case yaml.AliasNode:
+		return writeJSON(buf, node.Alias, indent)
+	case yaml.MappingNode, yaml.SequenceNode:
+		open, close, step := "[", "]", 1
+		if node.Kind == yaml.MappingNode {
+			open, close, step = "{", "}", 2
+		}
+		if len(node.Content) == 0 {
+			buf.WriteString(open + close)
+			return nil
+		}
+		buf.WriteString(open)
+		for i := 0; i < len(node.Content); i += step {
+			if i > 0 {
+				buf.WriteString(",")
+			}
+			buf.WriteString("\n" + indent + "  ")
+			if step == 2 {
+				key, _ := json.Marshal(node.Content[i].Value)
+				buf.Write(key)
+				buf.WriteString(": ")
+			}
+			if err := writeJSON(buf, node.Content[i+step-1], indent+"  "); err != nil {
+				return err
+			}
+		}
+		buf.WriteString("\n" + indent + close)
+		return nil
+	}
+
+	var value interface{}
+	if err := node.Decode(&value); err != nil {
+		return err
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	buf.Write(data)
+	return nil
+}
@@ -0,0 +1,187 @@
+package config
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestMigrateSettings(t *testing.T) {
+	settings := map[string]interface{}{
+		"version": "1.0.0",
+		"cors":    map[string]interface{}{"allow_origins": "https://a.example.com, https://b.example.com"},
+		"routes": []interface{}{
+			map[string]interface{}{"path": "/untyped"},
+			map[string]interface{}{"path": "/json", "type": "json", "json_content": "{}"},
+			map[string]interface{}{"path": "/ref", "type": "dummy", "cors": map[string]interface{}{"allow_headers": "${HEADERS}"}},
+		},
+	}
+
+	deprecations, err := migrateSettings(settings)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(deprecations) != 2 {
+		t.Fatalf("Expected 2 deprecations, got %v", deprecations)
+	}
+	if deprecations[0].Field != "routes[0].type" || deprecations[1].Field != "cors.allow_origins" {
+		t.Errorf("Unexpected deprecations: %v", deprecations)
+	}
+
+	if settings["version"] != CurrentVersion {
+		t.Errorf("Expected version %s, got %v", CurrentVersion, settings["version"])
+	}
+
+	var cfg Config
+	if err := decodeStrict(settings, &cfg); err != nil {
+		t.Fatalf("Expected migrated settings to decode, got %v", err)
+	}
+	if cfg.Routes[0].Type != "dummy" {
+		t.Errorf("Expected explicit dummy type, got %q", cfg.Routes[0].Type)
+	}
+	if len(cfg.CORS.AllowOrigins) != 2 || cfg.CORS.AllowOrigins[1] != "https://b.example.com" {
+		t.Errorf("Expected origins list, got %v", cfg.CORS.AllowOrigins)
+	}
+	// References are left for the decoder to split
+	if cfg.Routes[2].CORS.AllowHeaders[0] != "${HEADERS}" {
+		t.Errorf("Expected reference to be kept, got %v", cfg.Routes[2].CORS.AllowHeaders)
+	}
+}
+
+func TestMigrateSettingsCurrentVersion(t *testing.T) {
+	settings := map[string]interface{}{
+		"version": CurrentVersion,
+		"routes":  []interface{}{map[string]interface{}{"path": "/untyped"}},
+	}
+
+	deprecations, err := migrateSettings(settings)
+	if err != nil || len(deprecations) != 0 {
+		t.Errorf("Expected current files to be left alone, got %v, %v", deprecations, err)
+	}
+}
+
+func TestMigrateSettingsUnknownVersion(t *testing.T) {
+	_, err := migrateSettings(map[string]interface{}{"version": "9.0.0"})
+	if err == nil || !strings.Contains(err.Error(), "unsupported configuration version") {
+		t.Errorf("Expected unsupported version error, got %v", err)
+	}
+}
+
+func TestLoadConfigMigratesOldFiles(t *testing.T) {
+	viper.Reset()
+
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"config.yaml": `version: "1.0.0"
+cors:
+  allow_methods: "GET, POST"
+routes:
+  - path: "/begin"
+`,
+	})
+	viper.SetConfigFile(filepath.Join(dir, "config.yaml"))
+
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("Expected config to load, got error: %v", err)
+	}
+	if cfg.Version != CurrentVersion {
+		t.Errorf("Expected version %s, got %s", CurrentVersion, cfg.Version)
+	}
+	if cfg.Routes[0].Type != "dummy" {
+		t.Errorf("Expected migrated dummy type, got %q", cfg.Routes[0].Type)
+	}
+	if len(cfg.CORS.AllowMethods) != 2 || cfg.CORS.AllowMethods[1] != "POST" {
+		t.Errorf("Expected methods list, got %v", cfg.CORS.AllowMethods)
+	}
+}
+
+func TestMigrateFiles(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"config.yaml": `# Shared mock server config
+port: 8081
+include: ["routes.d/*"]
+cors:
+  allow_origins: "https://a.example.com,https://b.example.com" # Frontends
+routes:
+  # Passkeys begin
+  - path: "/begin"
+`,
+		"routes.d/a.json": `{
+  "routes": [
+    {"path": "/json", "cors": {"allow_headers": "A, B"}}
+  ]
+}
+`,
+		"routes.d/b.yaml":     "routes:\n  - path: /current\n    type: dummy\n",
+		"config.staging.toml": "[[routes]]\npath = \"/staging\"\n",
+	})
+	file := filepath.Join(dir, "config.yaml")
+
+	migrated, err := MigrateFiles(file, "staging")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(migrated) != 3 {
+		t.Fatalf("Expected 3 migrated files, got %d", len(migrated))
+	}
+
+	// YAML keeps comments and gains a version
+	yamlOut := string(migrated[0].Data)
+	for _, expected := range []string{
+		`version: "1.1.0"`,
+		"# Shared mock server config",
+		`allow_origins: ["https://a.example.com", "https://b.example.com"] # Frontends`,
+		"# Passkeys begin",
+		`type: "dummy"`,
+	} {
+		if !strings.Contains(yamlOut, expected) {
+			t.Errorf("Expected migrated YAML to contain %q, got:\n%s", expected, yamlOut)
+		}
+	}
+
+	// The overlay keeps its format and gets no version
+	if migrated[1].File != filepath.Join(dir, "config.staging.toml") || !strings.Contains(string(migrated[1].Data), "type = 'dummy'") {
+		t.Errorf("Unexpected overlay migration: %s\n%s", migrated[1].File, migrated[1].Data)
+	}
+
+	// Included JSON stays valid JSON without a version
+	var doc map[string]interface{}
+	if err := json.Unmarshal(migrated[2].Data, &doc); err != nil {
+		t.Fatalf("Expected valid JSON, got %v:\n%s", err, migrated[2].Data)
+	}
+	if _, ok := doc["version"]; ok {
+		t.Error("Expected included file to stay without a version")
+	}
+	route := doc["routes"].([]interface{})[0].(map[string]interface{})
+	if route["type"] != "dummy" || len(route["cors"].(map[string]interface{})["allow_headers"].([]interface{})) != 2 {
+		t.Errorf("Unexpected migrated route: %v", route)
+	}
+
+	// Migrated files load without further deprecations
+	for _, m := range migrated {
+		if err := os.WriteFile(m.File, m.Data, 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", m.File, err)
+		}
+	}
+	again, err := MigrateFiles(file, "staging")
+	if err != nil || len(again) != 0 {
+		t.Errorf("Expected nothing left to migrate, got %d files, %v", len(again), err)
+	}
+}
+
+func TestMigrateFilesHCL(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"config.hcl": "routes {\n  path = \"/a\"\n}\n"})
+
+	// HCL files cannot be rewritten, the changes are returned to be made by hand
+	migrated, err := MigrateFiles(filepath.Join(dir, "config.hcl"), "")
+	if err != nil || len(migrated) != 1 || !migrated[0].Manual || migrated[0].Data != nil {
+		t.Errorf("Expected a manual migration, got %+v, %v", migrated, err)
+	}
+}
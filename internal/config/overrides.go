@@ -0,0 +1,93 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// EnvPrefix is the prefix of every environment variable read by the server
+const EnvPrefix = "MOCK_CORS"
+
+// Override is a setting that can be set with an environment variable or a
+// command-line flag, taking precedence over the configuration files
+type Override struct {
+	Key         string       // Dotted configuration key, e.g. cors.allow_origins
+	Env         string       // Environment variable, e.g. MOCK_CORS_CORS_ALLOW_ORIGINS
+	Flag        string       // Command-line flag, e.g. cors-allow-origins
+	Type        reflect.Type // Go type of the setting
+	Description string
+}
+
+// Overrides lists every global setting that can be overridden. Lists of
+// structs such as routes and oidc.clients can only be set in files.
+func Overrides() []Override {
+	return collectOverrides(reflect.TypeOf(Config{}), "")
+}
+
+// collectOverrides walks the scalar and string list fields of a struct
+func collectOverrides(t reflect.Type, prefix string) []Override {
+	var overrides []Override
+	for _, field := range configFields(t) {
+		key := prefix + field.Key
+		switch kind := field.Type.Kind(); {
+		case kind == reflect.Struct:
+			overrides = append(overrides, collectOverrides(field.Type, key+".")...)
+		case kind == reflect.Slice && field.Type.Elem().Kind() != reflect.String,
+			kind == reflect.Map, kind == reflect.Ptr, kind == reflect.Interface:
+			continue
+		default:
+			overrides = append(overrides, Override{
+				Key:         key,
+				Env:         EnvPrefix + "_" + strings.ToUpper(strings.ReplaceAll(key, ".", "_")),
+				Flag:        strings.NewReplacer(".", "-", "_", "-").Replace(key),
+				Type:        field.Type,
+				Description: descriptions[t.Name()+"."+field.Key],
+			})
+		}
+	}
+	return overrides
+}
+
+// setupEnv makes the global viper instance read MOCK_CORS_ variables, with
+// dots in nested keys replaced by underscores
+func setupEnv() {
+	viper.SetEnvPrefix(EnvPrefix)
+	viper.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
+	viper.AutomaticEnv()
+}
+
+// applyOverrides sets every setting given as an environment variable or a
+// changed flag. The global viper instance never reads the configuration
+// file, so IsSet only reports those sources.
+func applyOverrides(config *Config) error {
+	for _, override := range Overrides() {
+		if !viper.IsSet(override.Key) {
+			continue
+		}
+		field := lookupField(reflect.ValueOf(config).Elem(), strings.Split(override.Key, "."))
+		field.Set(reflect.Zero(field.Type())) // Lists are replaced, not merged
+		if err := decodeStrict(viper.Get(override.Key), field.Addr().Interface()); err != nil {
+			return fmt.Errorf("invalid value for %s: %w", override.Key, err)
+		}
+	}
+	return nil
+}
+
+// lookupField finds a nested struct field by its mapstructure keys
+func lookupField(v reflect.Value, path []string) reflect.Value {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		key, _, _ := strings.Cut(t.Field(i).Tag.Get("mapstructure"), ",")
+		if key != path[0] {
+			continue
+		}
+		if len(path) == 1 {
+			return v.Field(i)
+		}
+		return lookupField(v.Field(i), path[1:])
+	}
+	panic("unknown configuration key " + strings.Join(path, "."))
+}
@@ -0,0 +1,159 @@
+package config
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+func TestOverrides(t *testing.T) {
+	byKey := make(map[string]Override)
+	for _, override := range Overrides() {
+		byKey[override.Key] = override
+	}
+
+	allowOrigins, ok := byKey["cors.allow_origins"]
+	if !ok {
+		t.Fatal("Expected cors.allow_origins to be overridable")
+	}
+	if allowOrigins.Env != "MOCK_CORS_CORS_ALLOW_ORIGINS" || allowOrigins.Flag != "cors-allow-origins" {
+		t.Errorf("Unexpected names: %+v", allowOrigins)
+	}
+
+	// Every field of CORSConfig is covered
+	for _, field := range configFields(reflect.TypeOf(CORSConfig{})) {
+		if _, ok := byKey["cors."+field.Key]; !ok {
+			t.Errorf("Expected cors.%s to be overridable", field.Key)
+		}
+	}
+
+	for _, key := range []string{"port", "version", "oidc.enabled", "oidc.signing_key_file"} {
+		if _, ok := byKey[key]; !ok {
+			t.Errorf("Expected %s to be overridable", key)
+		}
+	}
+	for _, key := range []string{"routes", "oidc.clients", "oidc.users"} {
+		if _, ok := byKey[key]; ok {
+			t.Errorf("Expected %s to be file only", key)
+		}
+	}
+}
+
+func TestLoadConfigNestedEnvironmentVariables(t *testing.T) {
+	viper.Reset()
+
+	t.Setenv("MOCK_CORS_CORS_ALLOW_ORIGINS", "https://a.example.com,https://b.example.com")
+	t.Setenv("MOCK_CORS_CORS_ALLOW_CREDENTIALS", "false")
+	t.Setenv("MOCK_CORS_CORS_MAX_AGE", "60")
+	t.Setenv("MOCK_CORS_OIDC_ENABLED", "true")
+
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if len(cfg.CORS.AllowOrigins) != 2 || cfg.CORS.AllowOrigins[1] != "https://b.example.com" {
+		t.Errorf("Expected origins from env, got %v", cfg.CORS.AllowOrigins)
+	}
+	if cfg.CORS.AllowCredentials {
+		t.Error("Expected allow_credentials false from env")
+	}
+	if cfg.CORS.MaxAge != 60 {
+		t.Errorf("Expected max_age 60 from env, got %d", cfg.CORS.MaxAge)
+	}
+	if !cfg.OIDC.Enabled {
+		t.Error("Expected oidc.enabled from env")
+	}
+	// Untouched settings keep their defaults
+	if len(cfg.CORS.AllowMethods) != 3 {
+		t.Errorf("Expected default methods, got %v", cfg.CORS.AllowMethods)
+	}
+}
+
+func TestLoadConfigPrecedence(t *testing.T) {
+	viper.Reset()
+
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"config.yaml": `port: 8000
+cors:
+  allow_origins: ["https://file.example.com"]
+  allow_methods: ["GET"]
+  max_age: 10
+routes:
+  - path: "/partial"
+    type: "dummy"
+    cors:
+      allow_credentials: false
+`,
+	})
+	viper.SetConfigFile(filepath.Join(dir, "config.yaml"))
+
+	t.Setenv("MOCK_CORS_PORT", "9000")
+	t.Setenv("MOCK_CORS_CORS_ALLOW_ORIGINS", "https://env.example.com")
+	t.Setenv("MOCK_CORS_CORS_MAX_AGE", "20")
+
+	flags := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	flags.Int("cors-max-age", 0, "")
+	flags.Int("port", 0, "")
+	viper.BindPFlag("cors.max_age", flags.Lookup("cors-max-age"))
+	viper.BindPFlag("port", flags.Lookup("port"))
+	if err := flags.Parse([]string{"--cors-max-age", "30"}); err != nil {
+		t.Fatalf("Failed to parse flags: %v", err)
+	}
+
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if cfg.Port != 9000 {
+		t.Errorf("Expected env port over file and unset flag, got %d", cfg.Port)
+	}
+	if cfg.CORS.MaxAge != 30 {
+		t.Errorf("Expected flag max_age over env, got %d", cfg.CORS.MaxAge)
+	}
+	if len(cfg.CORS.AllowOrigins) != 1 || cfg.CORS.AllowOrigins[0] != "https://env.example.com" {
+		t.Errorf("Expected env origins over file, got %v", cfg.CORS.AllowOrigins)
+	}
+	if len(cfg.CORS.AllowMethods) != 1 || cfg.CORS.AllowMethods[0] != "GET" {
+		t.Errorf("Expected file methods over defaults, got %v", cfg.CORS.AllowMethods)
+	}
+
+	// Route cors blocks build on the overridden global settings
+	cors := cfg.Routes[0].CORS
+	if cors.AllowOrigins[0] != "https://env.example.com" || cors.AllowCredentials {
+		t.Errorf("Expected route cors merged onto overridden settings, got %+v", cors)
+	}
+}
+
+func TestLoadConfigFromEnvironmentFile(t *testing.T) {
+	viper.Reset()
+
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"custom.yaml": "port: 7000\n"})
+	t.Setenv("MOCK_CORS_CONFIG", filepath.Join(dir, "custom.yaml"))
+
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if cfg.Port != 7000 {
+		t.Errorf("Expected port from MOCK_CORS_CONFIG file, got %d", cfg.Port)
+	}
+	if viper.ConfigFileUsed() != filepath.Join(dir, "custom.yaml") {
+		t.Errorf("Expected config file to be recorded, got %q", viper.ConfigFileUsed())
+	}
+}
+
+func TestLoadConfigInvalidOverride(t *testing.T) {
+	viper.Reset()
+	t.Setenv("MOCK_CORS_CORS_MAX_AGE", "forever")
+
+	if _, err := LoadConfig(); err == nil {
+		t.Error("Expected error for non-numeric max_age")
+	}
+}
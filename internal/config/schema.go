@@ -0,0 +1,256 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+)
+
+// SchemaID is the identifier of the generated configuration schema
+const SchemaID = "https://github.com/developmeh/mock-cors-server/config.schema.json"
+
+// descriptions documents configuration fields, keyed by Go type and mapstructure key
+var descriptions = map[string]string{
+	"Config.port":        "Port the server listens on.",
+	"Config.routes":      "Routes served by the mock server.",
+	"Config.cors":        "Global CORS settings, used by every route without its own cors block.",
+	"Config.version":     "Configuration schema version. Older versions are migrated when loaded; run mock-cors-server migrate to update the file.",
+	"Config.oidc":        "Built-in mock OAuth2 / OpenID Connect provider.",
+	"Config.openapi":     "Generate routes from an OpenAPI 3 document.",
+	"Config.har":         "Recording of the requests handled, exported as HAR 1.2 from /__admin/har.",
+	"Config.mime_types":  "Content types of static and static_dir files by extension, without the leading dot, e.g. wasm: application/wasm. Adds to and overrides the built-in types.",
+	"Config.compression": "Compress responses for clients sending Accept-Encoding.",
+	"Config.include":     "Files or glob patterns, relative to this file, whose routes are added to the routes of this file. Included files may only contain routes.",
+
+	"Route.path":            "URL path of the route. Routes may share a path when their methods differ.",
+	"Route.type":            "How the route responds: dummy returns the hardcoded passkeys response, static serves file_path, static_dir serves the files of dir below path, json returns json_content, sse streams events, websocket upgrades to a scripted WebSocket conversation, stream sends chunks with delays, long_poll holds requests until a timeout or an admin trigger, graphql answers queries against schema, grpc answers gRPC-Web and Connect calls to the services of descriptor_set.",
+	"Route.file_path":       "File served by static routes. The content type is detected from the extension unless content_type is set.",
+	"Route.dir":             "Directory served by static_dir routes. The path must end with / and maps to the root of the directory.",
+	"Route.index_files":     "Files served for requests of a directory, tried in order. Defaults to index.html.",
+	"Route.listing":         "List the files of directories without an index file.",
+	"Route.spa_fallback":    "Serve the index file of dir for unknown paths, so client-side routes of single-page applications load.",
+	"Route.events":          "Server-sent events streamed by sse routes, in order.",
+	"Route.loop":            "Start over with the first event after the last one instead of keeping the stream idle. At least one event needs a delay.",
+	"Route.messages":        "Scripted messages of websocket routes: sent on connect, or in reply to the first pattern an inbound message matches.",
+	"Route.subprotocols":    "WebSocket subprotocols the route speaks, in order of preference. The first one the client offers is selected.",
+	"Route.chunks":          "Body of stream routes, flushed chunk by chunk. Chunks of NDJSON content types are single-line JSON values; the line break is added when missing.",
+	"Route.timeout":         "Milliseconds long_poll routes hold requests before answering with timeout_status. Defaults to 30000.",
+	"Route.timeout_status":  "Status of long polls that time out. Defaults to 204.",
+	"Route.trigger":         "Name of the trigger releasing the requests held by a long_poll route: POST /__admin/triggers/{name}. The posted body replaces json_content.",
+	"Route.schema":          "GraphQL schema (SDL) file of graphql routes. Queries are validated against it and introspection is answered from it.",
+	"Route.resolvers":       "Responses of graphql routes by operation name. Operation names are matched case-insensitively; operations without a resolver get fake data matching the schema.",
+	"Route.descriptor_set":  "Protobuf FileDescriptorSet of grpc routes, as written by buf build -o api.binpb or protoc --include_imports --descriptor_set_out=api.binpb. Every service in it is served below the route's path.",
+	"Route.rpcs":            "Responses of grpc routes by method. Methods without an entry answer with an empty message.",
+	"Route.json_content":    "JSON document returned by json routes, and by long_poll routes when triggered.",
+	"Route.content_type":    "Content-Type of the response. Defaults to application/json, text/plain for stream routes, or is detected from the file extension for static and static_dir routes.",
+	"Route.methods":         "HTTP methods the route answers. Routes may share a path when their methods differ. Defaults to POST for json and dummy routes, GET and HEAD for static, static_dir, sse and stream routes, and GET for websocket and long_poll routes, and GET and POST for graphql and grpc routes. static and static_dir routes only answer GET and HEAD.",
+	"Route.status":          "Response status of json, dummy, sse, stream, graphql and triggered long_poll routes. Defaults to 200; json routes without json_content respond with an empty body when set. A status other than 101 makes websocket routes reject the handshake.",
+	"Route.headers":         "Extra headers added to every response of the route.",
+	"Route.cache_control":   "Cache-Control header of the responses, such as no-cache or public, max-age=31536000, immutable. Static and static_dir responses also carry an ETag and Last-Modified, answering conditional requests with 304.",
+	"Route.compression":     "Compression settings for this route, replacing the global settings field by field.",
+	"Route.cors":            "CORS settings for this route, replacing the global settings.",
+	"Route.jwt":             "Require a bearer JWT on every non-preflight request.",
+	"Route.require_headers": "Require partner headers such as site-token or client-id on every non-preflight request.",
+	"Route.session":         "Set, require, read or clear the session cookie.",
+
+	"OpenAPIConfig.spec":               "OpenAPI 3 document (YAML or JSON), relative to the working directory. A route is generated for every operation not already defined in routes.",
+	"OpenAPIConfig.validate":           "Check requests for operations of the spec against it: off, warn logs violations, enforce answers them with 400.",
+	"OpenAPIConfig.validate_responses": "Also check responses when validate is warn or enforce; enforce answers violations with 500.",
+
+	"HARConfig.out":         "HAR file the recorded requests are written to when the server shuts down.",
+	"HARConfig.max_entries": "Number of requests kept; the oldest are dropped beyond it. 0 keeps every request.",
+
+	"SSEEvent.event": "Event type, dispatched to addEventListener. Defaults to message in the browser.",
+	"SSEEvent.id":    "Event ID. Reconnecting clients send the last one in Last-Event-ID and resume after it.",
+	"SSEEvent.data":  "Event data. Every line becomes a data field.",
+	"SSEEvent.retry": "Reconnection time the client should use, in milliseconds.",
+	"SSEEvent.delay": "Milliseconds to wait before sending the event.",
+
+	"StreamChunk.data":  "Part of the body, sent as is.",
+	"StreamChunk.delay": "Milliseconds to wait before sending the chunk.",
+
+	"GraphQLResolver.data":   "JSON object with the result of the operation, keyed by field name or alias. Selected fields it leaves out get fake values; fields it has that are not selected are dropped.",
+	"GraphQLResolver.errors": "Messages of errors returned with the result. Without data, data is null.",
+
+	"GRPCMethod.method":    "Full name of the method, such as acme.v1.Greeter/SayHello.",
+	"GRPCMethod.responses": "Response messages in protobuf JSON. Unary methods take at most one and answer with an empty message without it; server streaming methods send them all.",
+	"GRPCMethod.code":      "Status code, by name such as not_found or by number. Defaults to ok.",
+	"GRPCMethod.message":   "Status message sent with code.",
+	"GRPCMethod.trailers":  "Metadata sent with the status, as gRPC-Web trailers, Connect end-of-stream metadata or Trailer- headers of Connect unary responses.",
+
+	"WebSocketMessage.match": "Regular expression matched against inbound text messages. Messages without match are sent on connect.",
+	"WebSocketMessage.send":  "Text message sent.",
+	"WebSocketMessage.delay": "Milliseconds to wait before sending.",
+	"WebSocketMessage.close": "Close the connection with this status code (1000-4999) after sending, e.g. 1000 for a normal closure.",
+
+	"CompressionConfig.enabled":       "Compress responses on the fly with the best encoding the client accepts.",
+	"CompressionConfig.min_size":      "Responses smaller than this many bytes are sent uncompressed. Defaults to 1024.",
+	"CompressionConfig.encodings":     "Encodings offered, in order of preference: br, zstd, gzip and deflate.",
+	"CompressionConfig.precompressed": "Serve the .br, .zst or .gz sibling of a static file, e.g. app.js.br for app.js, when the client accepts its encoding.",
+
+	"CORSConfig.allow_origins":     "Origins allowed to make cross-origin requests. \"*\" allows any origin; the request origin is always echoed back.",
+	"CORSConfig.allow_methods":     "Methods listed in Access-Control-Allow-Methods.",
+	"CORSConfig.allow_headers":     "Request headers listed in Access-Control-Allow-Headers.",
+	"CORSConfig.expose_headers":    "Response headers scripts may read, listed in Access-Control-Expose-Headers. grpc routes always expose grpc-status and grpc-message.",
+	"CORSConfig.allow_credentials": "Send Access-Control-Allow-Credentials: true so browsers include cookies and authorization headers.",
+	"CORSConfig.max_age":           "Seconds browsers may cache preflight responses (Access-Control-Max-Age).",
+
+	"JWTConfig.secret":          "HMAC shared secret (HS256, HS384, HS512).",
+	"JWTConfig.public_key_file": "PEM encoded RSA, ECDSA or Ed25519 public key.",
+	"JWTConfig.jwks_file":       "Local JSON Web Key Set file. Keys are matched by kid.",
+	"JWTConfig.use_oidc":        "Trust tokens issued by the built-in OIDC provider.",
+	"JWTConfig.algorithms":      "Accepted signing algorithms. Inferred from the configured keys when empty.",
+	"JWTConfig.issuer":          "Required iss claim.",
+	"JWTConfig.audience":        "Required aud claim.",
+	"JWTConfig.leeway":          "Clock skew allowed when checking exp and nbf, in seconds.",
+	"JWTConfig.realm":           "Realm advertised in the WWW-Authenticate challenge.",
+	"JWTConfig.claims":          "Claim values tokens must carry, e.g. role: admin. String claims match whole or by one of their space-separated words, as scope does, array claims by one of their elements. Other tokens get a 403 insufficient_scope error.",
+
+	"RequireHeadersConfig.headers":        "Headers every request must carry.",
+	"RequireHeadersConfig.api_key":        "Validate a header against keys listed in a local file.",
+	"RequireHeadersConfig.missing_status": "Status returned when a required header is missing. Defaults to 400.",
+	"RequireHeadersConfig.invalid_status": "Status returned when a header value is rejected. Defaults to 403.",
+	"RequireHeadersConfig.body":           "Response body returned on mismatch instead of the JSON error description.",
+
+	"HeaderRequirement.name":           "Header name (case-insensitive).",
+	"HeaderRequirement.values":         "Allowed values. Any value is accepted when empty.",
+	"HeaderRequirement.pattern":        "Regular expression the value must match.",
+	"HeaderRequirement.missing_status": "Overrides require_headers.missing_status for this header.",
+	"HeaderRequirement.invalid_status": "Overrides require_headers.invalid_status for this header.",
+	"HeaderRequirement.body":           "Overrides require_headers.body for this header.",
+
+	"APIKeyConfig.header":         "Header carrying the API key.",
+	"APIKeyConfig.file":           "File with one key per line. Blank lines and lines starting with # are ignored.",
+	"APIKeyConfig.missing_status": "Status returned when the key is missing. Defaults to 401.",
+	"APIKeyConfig.invalid_status": "Status returned when the key is unknown. Defaults to 403.",
+	"APIKeyConfig.body":           "Response body returned on failure instead of the JSON error description. Defaults to require_headers.body.",
+
+	"SessionConfig.action":      "set creates a session, require rejects requests without one, read responds with the stored values, clear removes it.",
+	"SessionConfig.cookie_name": "Name of the session cookie. Defaults to mock_session.",
+	"SessionConfig.values":      "Values stored on set, and required to match on require and read.",
+	"SessionConfig.same_site":   "SameSite attribute of the cookie. none requires secure.",
+	"SessionConfig.secure":      "Set the Secure attribute.",
+	"SessionConfig.http_only":   "Set the HttpOnly attribute. Defaults to true.",
+	"SessionConfig.domain":      "Domain attribute of the cookie.",
+	"SessionConfig.path":        "Path attribute of the cookie. Defaults to /.",
+	"SessionConfig.max_age":     "Max-Age of the cookie in seconds. A session cookie when zero.",
+
+	"OIDCConfig.enabled":           "Serve the mock identity provider.",
+	"OIDCConfig.issuer":            "Issuer identifier. Defaults to http://localhost:<port><path_prefix>.",
+	"OIDCConfig.path_prefix":       "Path the provider endpoints are mounted under.",
+	"OIDCConfig.signing_key_file":  "PEM encoded RSA private key used to sign tokens. Generated at startup when empty.",
+	"OIDCConfig.access_token_ttl":  "Access and ID token lifetime in seconds. Defaults to 3600.",
+	"OIDCConfig.refresh_token_ttl": "Refresh token lifetime in seconds. Defaults to 86400.",
+	"OIDCConfig.clients":           "Registered OAuth2 clients.",
+	"OIDCConfig.users":             "Users the provider can log in. The first user is used unless login_hint selects another.",
+
+	"OIDCClient.client_id":     "Client identifier.",
+	"OIDCClient.client_secret": "Client secret. Public clients have none and must use PKCE.",
+	"OIDCClient.redirect_uris": "Allowed redirect URIs. Any URI is accepted when empty.",
+
+	"OIDCUser.subject":  "Subject identifier (sub claim).",
+	"OIDCUser.username": "Name matched against the login_hint parameter.",
+	"OIDCUser.claims":   "Additional claims included in ID tokens and userinfo responses.",
+}
+
+// enums lists the allowed values of enumerated fields
+var enums = map[string][]string{
+	"Config.version":          Versions,
+	"Route.type":              RouteTypes,
+	"SessionConfig.action":    {"set", "require", "read", "clear"},
+	"OpenAPIConfig.validate":  {"off", "warn", "enforce"},
+	"SessionConfig.same_site": {"lax", "strict", "none"},
+}
+
+// Schema returns a JSON Schema (draft 2020-12) describing the configuration file
+func Schema() map[string]interface{} {
+	defs := make(map[string]interface{})
+	root := structSchema(reflect.TypeOf(Config{}), defs)
+	root["$schema"] = "https://json-schema.org/draft/2020-12/schema"
+	root["$id"] = SchemaID
+	root["title"] = "mock-cors-server configuration"
+	root["$defs"] = defs
+	return root
+}
+
+// structSchema describes a struct as an object that rejects unknown keys
+func structSchema(t reflect.Type, defs map[string]interface{}) map[string]interface{} {
+	properties := make(map[string]interface{})
+	for _, field := range configFields(t) {
+		prop := typeSchema(field.Type, defs)
+
+		key := t.Name() + "." + field.Key
+		if description, ok := descriptions[key]; ok {
+			prop["description"] = description
+		}
+		if values, ok := enums[key]; ok {
+			prop["enum"] = values
+		}
+
+		properties[field.Key] = prop
+	}
+
+	return map[string]interface{}{
+		"type":                 "object",
+		"properties":           properties,
+		"additionalProperties": false,
+	}
+}
+
+// typeSchema describes a Go type, registering named structs under $defs
+func typeSchema(t reflect.Type, defs map[string]interface{}) map[string]interface{} {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		if _, ok := defs[t.Name()]; !ok {
+			defs[t.Name()] = nil // Reserve the name to stop recursion
+			defs[t.Name()] = structSchema(t, defs)
+		}
+		return map[string]interface{}{"$ref": "#/$defs/" + t.Name()}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": typeSchema(t.Elem(), defs)}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": typeSchema(t.Elem(), defs)}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	default:
+		return map[string]interface{}{}
+	}
+}
+
+// configField is a struct field exposed in the configuration file
+type configField struct {
+	Key   string
+	Type  reflect.Type
+	Index int // Position in the struct, for reflect.Value.Field
+}
+
+// configFields lists the fields of a struct by their mapstructure key,
+// skipping fields tagged "-"
+func configFields(t reflect.Type) []configField {
+	var fields []configField
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		key, _, _ := strings.Cut(f.Tag.Get("mapstructure"), ",")
+		if key == "-" {
+			continue
+		}
+		if key == "" {
+			key = strings.ToLower(f.Name)
+		}
+		fields = append(fields, configField{Key: key, Type: f.Type, Index: i})
+	}
+	return fields
+}
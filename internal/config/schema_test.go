@@ -0,0 +1,71 @@
+package config
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestSchema(t *testing.T) {
+	schema := Schema()
+
+	// The schema must survive a JSON round trip
+	data, err := json.Marshal(schema)
+	if err != nil {
+		t.Fatalf("Expected schema to encode, got error: %v", err)
+	}
+	var decoded map[string]interface{}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Expected schema to decode, got error: %v", err)
+	}
+
+	if decoded["additionalProperties"] != false {
+		t.Error("Expected unknown top-level keys to be rejected")
+	}
+
+	defs := decoded["$defs"].(map[string]interface{})
+	route, ok := defs["Route"].(map[string]interface{})
+	if !ok {
+		t.Fatal("Expected Route definition in $defs")
+	}
+	props := route["properties"].(map[string]interface{})
+
+	for _, key := range []string{"path", "type", "file_path", "json_content", "content_type", "cors"} {
+		if _, ok := props[key]; !ok {
+			t.Errorf("Expected Route property %s", key)
+		}
+	}
+
+	routeType := props["type"].(map[string]interface{})
+	if enum, ok := routeType["enum"].([]interface{}); !ok || len(enum) != len(RouteTypes) {
+		t.Errorf("Expected type enum %v, got %v", RouteTypes, routeType["enum"])
+	}
+
+	cors := props["cors"].(map[string]interface{})
+	if cors["$ref"] != "#/$defs/CORSConfig" {
+		t.Errorf("Expected route cors to reference CORSConfig, got %v", cors["$ref"])
+	}
+}
+
+func TestSchemaDescribesEveryField(t *testing.T) {
+	// Every configuration field should be documented for editors
+	seen := make(map[reflect.Type]bool)
+	var check func(t reflect.Type)
+	check = func(typ reflect.Type) {
+		for typ.Kind() == reflect.Ptr || typ.Kind() == reflect.Slice || typ.Kind() == reflect.Map {
+			typ = typ.Elem()
+		}
+		if typ.Kind() != reflect.Struct || seen[typ] {
+			return
+		}
+		seen[typ] = true
+
+		for _, field := range configFields(typ) {
+			if _, ok := descriptions[typ.Name()+"."+field.Key]; !ok {
+				t.Errorf("Missing schema description for %s.%s", typ.Name(), field.Key)
+			}
+			check(field.Type)
+		}
+	}
+	check(reflect.TypeOf(Config{}))
+}
@@ -0,0 +1,603 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ValidationError describes a problem found in a configuration
+type ValidationError struct {
+	File    string
+	Line    int
+	Column  int
+	Field   string // Dotted path of the offending setting, e.g. routes[2].type
+	Message string
+}
+
+// Error formats the problem as file:line:column: field: message
+func (e ValidationError) Error() string {
+	var b strings.Builder
+	if e.File != "" {
+		b.WriteString(e.File)
+		if e.Line > 0 {
+			fmt.Fprintf(&b, ":%d:%d", e.Line, e.Column)
+		}
+		b.WriteString(": ")
+	}
+	if e.Field != "" {
+		b.WriteString(e.Field)
+		b.WriteString(": ")
+	}
+	b.WriteString(e.Message)
+	return b.String()
+}
+
+// RouteTypes lists the supported route types
+var RouteTypes = []string{"dummy", "static", "static_dir", "json", "sse", "websocket", "stream", "long_poll", "graphql", "grpc"}
+
+// Validate checks a configuration for problems that would otherwise only
+// surface at runtime, or make the server panic at startup. When file is not
+// empty, errors are annotated with positions from that file.
+func Validate(cfg *Config, file string) []ValidationError {
+	v := &validator{file: file}
+	if file != "" {
+		v.positions = loadPositions(file)
+	}
+
+	if cfg.Port < 0 || cfg.Port > 65535 {
+		v.add("port", "port %d is out of range", cfg.Port)
+	}
+
+	v.validateCORS("cors", &cfg.CORS)
+
+	switch strings.ToLower(cfg.OpenAPI.Validate) {
+	case "", "off":
+	case "warn", "enforce":
+		if cfg.OpenAPI.Spec == "" {
+			v.add("openapi.validate", "validation requires openapi.spec")
+		}
+	default:
+		v.add("openapi.validate", "unknown validation mode %q (expected off, warn or enforce)", cfg.OpenAPI.Validate)
+	}
+
+	v.validateCompression("compression", &cfg.Compression)
+
+	for ext, contentType := range cfg.MimeTypes {
+		if ext == "" || strings.ContainsAny(ext, "/\\ ") {
+			v.add("mime_types", "invalid extension %q", ext)
+		}
+		if _, _, err := mime.ParseMediaType(contentType); err != nil {
+			v.add("mime_types."+ext, "invalid content type %q: %v", contentType, err)
+		}
+	}
+
+	if cfg.HAR.MaxEntries < 0 {
+		v.add("har.max_entries", "max_entries must not be negative")
+	}
+
+	// The OIDC provider endpoints share the mux with the routes
+	reserved := make(map[string]bool)
+	if cfg.OIDC.Enabled {
+		prefix := strings.TrimSuffix(cfg.OIDC.PathPrefix, "/")
+		for _, endpoint := range []string{"/.well-known/openid-configuration", "/authorize", "/token", "/userinfo", "/jwks.json"} {
+			reserved[prefix+endpoint] = true
+		}
+	}
+
+	sources := map[string]*validator{file: v}
+	for i, route := range cfg.Routes {
+		field := fmt.Sprintf("routes[%d]", i)
+
+		// Routes from included and overlay files are reported against their own file
+		rv := v
+		if file != "" && route.Source != "" && route.Source != file {
+			field = fmt.Sprintf("routes[%d]", route.SourceIndex)
+			if rv = sources[route.Source]; rv == nil {
+				rv = &validator{file: route.Source, positions: loadPositions(route.Source)}
+				sources[route.Source] = rv
+			}
+			rv.errors = nil
+		}
+
+		if route.Path == "" {
+			rv.add(field+".path", "path is required")
+		} else if reserved[route.Path] {
+			rv.add(field+".path", "path %q is already served by the OIDC provider", route.Path)
+		} else if strings.HasPrefix(route.Path, AdminPrefix) {
+			rv.add(field+".path", "path %q is reserved for the admin endpoints", route.Path)
+		} else if first := firstOverlap(cfg.Routes[:i], route); first >= 0 {
+			rv.add(field+".path", "duplicate path %q (first defined in routes[%d]); give the routes different methods", route.Path, first)
+		} else if err := checkPattern(route.Path); err != nil {
+			rv.add(field+".path", "invalid path %q: %v", route.Path, err)
+		}
+
+		rv.validateRoute(field, &route)
+		if rv != v {
+			v.errors = append(v.errors, rv.errors...)
+		}
+	}
+
+	if cfg.OIDC.Enabled {
+		for i, client := range cfg.OIDC.Clients {
+			if client.ClientID == "" {
+				v.add(fmt.Sprintf("oidc.clients[%d].client_id", i), "client_id is required")
+			}
+		}
+		for i, user := range cfg.OIDC.Users {
+			if user.Subject == "" {
+				v.add(fmt.Sprintf("oidc.users[%d].subject", i), "subject is required")
+			}
+		}
+		v.checkFile("oidc.signing_key_file", cfg.OIDC.SigningKeyFile)
+	}
+
+	return v.errors
+}
+
+// validator accumulates validation errors
+type validator struct {
+	file      string
+	positions map[string]position
+	errors    []ValidationError
+}
+
+// position is a line and column in the configuration file
+type position struct {
+	line, column int
+}
+
+// add records an error for a field, using the closest known position
+func (v *validator) add(field, format string, args ...interface{}) {
+	err := ValidationError{
+		File:    v.file,
+		Field:   field,
+		Message: fmt.Sprintf(format, args...),
+	}
+
+	// Fall back to the parent when a field is missing from the file
+	for f := field; f != ""; f = parentField(f) {
+		if pos, ok := v.positions[f]; ok {
+			err.Line, err.Column = pos.line, pos.column
+			break
+		}
+	}
+
+	v.errors = append(v.errors, err)
+}
+
+// validateRoute checks the type specific settings of a route
+func (v *validator) validateRoute(field string, route *Route) {
+	switch route.Type {
+	case "", "dummy":
+	case "static":
+		if route.FilePath == "" {
+			v.add(field+".file_path", "file_path is required for static routes")
+		} else {
+			v.checkFile(field+".file_path", route.FilePath)
+		}
+	case "static_dir":
+		if route.Dir == "" {
+			v.add(field+".dir", "dir is required for static_dir routes")
+		} else if info, err := os.Stat(route.Dir); err != nil {
+			v.add(field+".dir", "directory %s is not readable: %v", route.Dir, err)
+		} else if !info.IsDir() {
+			v.add(field+".dir", "%s is not a directory", route.Dir)
+		}
+		if route.Path != "" && !strings.HasSuffix(route.Path, "/") {
+			v.add(field+".path", "static_dir routes need a path ending in /, such as %q", route.Path+"/")
+		}
+		for i, name := range route.IndexFiles {
+			if name == "" || strings.ContainsAny(name, `/\`) {
+				v.add(fmt.Sprintf("%s.index_files[%d]", field, i), "invalid index file name %q", name)
+			}
+		}
+	case "sse":
+		if len(route.Events) == 0 {
+			v.add(field+".events", "events are required for sse routes")
+		}
+		looping := false
+		for i, event := range route.Events {
+			ef := fmt.Sprintf("%s.events[%d]", field, i)
+			if event.Event == "" && event.ID == "" && event.Data == "" && event.Retry == 0 {
+				v.add(ef, "event needs data, event, id or retry")
+			}
+			if strings.ContainsAny(event.Event, "\r\n") {
+				v.add(ef+".event", "event must be a single line")
+			}
+			if strings.ContainsAny(event.ID, "\r\n\x00") {
+				v.add(ef+".id", "id must be a single line without NUL characters")
+			}
+			if event.Retry < 0 {
+				v.add(ef+".retry", "retry must not be negative")
+			}
+			if event.Delay < 0 {
+				v.add(ef+".delay", "delay must not be negative")
+			}
+			looping = looping || event.Delay > 0
+		}
+		if route.Loop && len(route.Events) > 0 && !looping {
+			v.add(field+".loop", "looping streams need a delay on at least one event")
+		}
+	case "stream":
+		if len(route.Chunks) == 0 {
+			v.add(field+".chunks", "chunks are required for stream routes")
+		}
+		ndjson := IsNDJSON(route.ContentType)
+		for i, chunk := range route.Chunks {
+			cf := fmt.Sprintf("%s.chunks[%d]", field, i)
+			if chunk.Delay < 0 {
+				v.add(cf+".delay", "delay must not be negative")
+			}
+			// Every chunk of an NDJSON stream is one JSON value on a line of its own
+			if ndjson {
+				line := strings.TrimSuffix(strings.TrimSuffix(chunk.Data, "\n"), "\r")
+				if strings.ContainsAny(line, "\r\n") || !json.Valid([]byte(line)) {
+					v.add(cf+".data", "chunks of %s streams must be single-line JSON values", route.ContentType)
+				}
+			}
+		}
+	case "long_poll":
+		if route.Timeout < 0 {
+			v.add(field+".timeout", "timeout must not be negative")
+		}
+		v.checkStatus(field+".timeout_status", route.TimeoutStatus)
+		if route.Trigger != "" && !triggerName.MatchString(route.Trigger) {
+			v.add(field+".trigger", "invalid trigger name %q (letters, digits, '.', '_' and '-')", route.Trigger)
+		}
+		if route.JSONContent != "" && isJSONContentType(route.ContentType) && !json.Valid([]byte(route.JSONContent)) {
+			var target interface{}
+			err := json.Unmarshal([]byte(route.JSONContent), &target)
+			v.add(field+".json_content", "json_content is not valid JSON: %v", err)
+		}
+	case "graphql":
+		if route.Schema == "" {
+			v.add(field+".schema", "schema is required for graphql routes")
+		} else {
+			v.checkFile(field+".schema", route.Schema)
+		}
+		names := make([]string, 0, len(route.Resolvers))
+		for name := range route.Resolvers {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			resolver := route.Resolvers[name]
+			rf := field + ".resolvers." + name
+			if !graphQLName.MatchString(name) {
+				v.add(rf, "invalid operation name %q", name)
+			}
+			if resolver.Data == "" && len(resolver.Errors) == 0 {
+				v.add(rf, "resolver needs data or errors")
+			}
+			if resolver.Data != "" {
+				var data map[string]interface{}
+				if err := json.Unmarshal([]byte(resolver.Data), &data); err != nil {
+					v.add(rf+".data", "data must be a JSON object: %v", err)
+				}
+			}
+		}
+	case "grpc":
+		if route.DescriptorSet == "" {
+			v.add(field+".descriptor_set", "descriptor_set is required for grpc routes")
+		} else {
+			v.checkFile(field+".descriptor_set", route.DescriptorSet)
+		}
+		if route.Path != "" && !strings.HasSuffix(route.Path, "/") {
+			v.add(field+".path", "grpc routes need a path ending in /, such as %q", route.Path+"/")
+		}
+		seen := make(map[string]int)
+		for i, rpc := range route.RPCs {
+			rf := fmt.Sprintf("%s.rpcs[%d]", field, i)
+			if !grpcMethodName.MatchString(rpc.Method) {
+				v.add(rf+".method", "invalid method %q (expected package.Service/Method)", rpc.Method)
+			} else if first, ok := seen[rpc.Method]; ok {
+				v.add(rf+".method", "duplicate method %q (first defined in rpcs[%d])", rpc.Method, first)
+			} else {
+				seen[rpc.Method] = i
+			}
+			for j, response := range rpc.Responses {
+				var message map[string]interface{}
+				if err := json.Unmarshal([]byte(response), &message); err != nil {
+					v.add(fmt.Sprintf("%s.responses[%d]", rf, j), "response must be a JSON object: %v", err)
+				}
+			}
+			if _, ok := ParseGRPCCode(rpc.Code); !ok {
+				v.add(rf+".code", "unknown status code %q (expected 0-16 or one of: %s)", rpc.Code, strings.Join(GRPCCodes, ", "))
+			}
+			for name := range rpc.Trailers {
+				if !validToken(name) || strings.HasPrefix(strings.ToLower(name), "grpc-") {
+					v.add(rf+".trailers", "invalid trailer name %q", name)
+				}
+			}
+		}
+	case "websocket":
+		for i, message := range route.Messages {
+			mf := fmt.Sprintf("%s.messages[%d]", field, i)
+			if message.Send == "" && message.Close == 0 {
+				v.add(mf, "message needs send or close")
+			}
+			if message.Match != "" {
+				if _, err := regexp.Compile(message.Match); err != nil {
+					v.add(mf+".match", "invalid pattern: %v", err)
+				}
+			}
+			if message.Delay < 0 {
+				v.add(mf+".delay", "delay must not be negative")
+			}
+			if message.Close != 0 && !validCloseCode(message.Close) {
+				v.add(mf+".close", "invalid close code %d (expected 1000-1003, 1007-1014 or 3000-4999)", message.Close)
+			}
+		}
+		for i, protocol := range route.Subprotocols {
+			if !validToken(protocol) {
+				v.add(fmt.Sprintf("%s.subprotocols[%d]", field, i), "invalid subprotocol %q", protocol)
+			}
+		}
+	case "json":
+		if route.JSONContent == "" {
+			// An explicit status may come without a body, as with 204 No Content
+			if route.Status == 0 {
+				v.add(field+".json_content", "json_content is required for json routes without a status")
+			}
+		} else if isJSONContentType(route.ContentType) && !json.Valid([]byte(route.JSONContent)) {
+			var target interface{}
+			err := json.Unmarshal([]byte(route.JSONContent), &target)
+			v.add(field+".json_content", "json_content is not valid JSON: %v", err)
+		}
+	default:
+		v.add(field+".type", "unknown route type %q (expected one of: %s)", route.Type, strings.Join(RouteTypes, ", "))
+	}
+
+	for i, method := range route.Methods {
+		if !validToken(method) {
+			v.add(fmt.Sprintf("%s.methods[%d]", field, i), "invalid method %q", method)
+		} else if (route.Type == "static" || route.Type == "static_dir") && !IsFileMethod(method) {
+			v.add(fmt.Sprintf("%s.methods[%d]", field, i), "%s routes only answer GET and HEAD, not %s", route.Type, method)
+		}
+	}
+	v.checkStatus(field+".status", route.Status)
+	for name := range route.Headers {
+		if !validToken(name) {
+			v.add(field+".headers", "invalid header name %q", name)
+		}
+	}
+
+	if route.ContentType != "" {
+		if _, _, err := mime.ParseMediaType(route.ContentType); err != nil {
+			v.add(field+".content_type", "invalid content type %q: %v", route.ContentType, err)
+		}
+	}
+
+	if route.CORS != nil {
+		v.validateCORS(field+".cors", route.CORS)
+	}
+	if route.Compression != nil {
+		v.validateCompression(field+".compression", route.Compression)
+	}
+
+	if route.JWT != nil {
+		jwt := route.JWT
+		if jwt.Secret == "" && jwt.PublicKeyFile == "" && jwt.JWKSFile == "" && !jwt.UseOIDC {
+			v.add(field+".jwt", "no verification key configured (set secret, public_key_file, jwks_file or use_oidc)")
+		}
+		v.checkFile(field+".jwt.public_key_file", jwt.PublicKeyFile)
+		v.checkFile(field+".jwt.jwks_file", jwt.JWKSFile)
+	}
+
+	if route.RequireHeaders != nil {
+		rh := route.RequireHeaders
+		for i, h := range rh.Headers {
+			hf := fmt.Sprintf("%s.require_headers.headers[%d]", field, i)
+			if h.Name == "" {
+				v.add(hf+".name", "name is required")
+			}
+			if h.Pattern != "" {
+				if _, err := regexp.Compile(h.Pattern); err != nil {
+					v.add(hf+".pattern", "invalid pattern: %v", err)
+				}
+			}
+			v.checkStatus(hf+".missing_status", h.MissingStatus)
+			v.checkStatus(hf+".invalid_status", h.InvalidStatus)
+		}
+		v.checkStatus(field+".require_headers.missing_status", rh.MissingStatus)
+		v.checkStatus(field+".require_headers.invalid_status", rh.InvalidStatus)
+		if rh.APIKey != nil {
+			if rh.APIKey.Header == "" {
+				v.add(field+".require_headers.api_key.header", "header is required")
+			}
+			if rh.APIKey.File == "" {
+				v.add(field+".require_headers.api_key.file", "file is required")
+			} else {
+				v.checkFile(field+".require_headers.api_key.file", rh.APIKey.File)
+			}
+		}
+	}
+
+	if route.Session != nil {
+		switch strings.ToLower(route.Session.Action) {
+		case "set", "require", "read", "clear":
+		default:
+			v.add(field+".session.action", "unknown session action %q (expected set, require, read or clear)", route.Session.Action)
+		}
+		switch strings.ToLower(route.Session.SameSite) {
+		case "", "lax", "strict", "none":
+		default:
+			v.add(field+".session.same_site", "unknown same_site value %q (expected lax, strict or none)", route.Session.SameSite)
+		}
+	}
+}
+
+// validateCORS checks a CORS block
+func (v *validator) validateCORS(field string, cors *CORSConfig) {
+	for i, method := range cors.AllowMethods {
+		if method == "" || strings.ContainsAny(method, " \t,") {
+			v.add(fmt.Sprintf("%s.allow_methods[%d]", field, i), "invalid method %q", method)
+		}
+	}
+	for i, header := range cors.ExposeHeaders {
+		if header != "*" && !validToken(header) {
+			v.add(fmt.Sprintf("%s.expose_headers[%d]", field, i), "invalid header name %q", header)
+		}
+	}
+	if cors.MaxAge < 0 {
+		v.add(field+".max_age", "max_age must not be negative")
+	}
+}
+
+// validateCompression checks a compression block
+func (v *validator) validateCompression(field string, compression *CompressionConfig) {
+	if compression.MinSize < 0 {
+		v.add(field+".min_size", "min_size must not be negative")
+	}
+	known := make(map[string]bool)
+	for _, encoding := range Encodings {
+		known[encoding] = true
+	}
+	for i, encoding := range compression.Encodings {
+		if !known[strings.ToLower(encoding)] {
+			v.add(fmt.Sprintf("%s.encodings[%d]", field, i), "unknown encoding %q (expected one of: %s)", encoding, strings.Join(Encodings, ", "))
+		}
+	}
+}
+
+// checkFile reports a referenced file that does not exist
+func (v *validator) checkFile(field, path string) {
+	if path == "" {
+		return
+	}
+	if _, err := os.Stat(path); err != nil {
+		v.add(field, "file %s is not readable: %v", path, err)
+	}
+}
+
+// checkStatus reports a configured HTTP status outside the valid range
+func (v *validator) checkStatus(field string, status int) {
+	if status != 0 && (status < 100 || status > 599) {
+		v.add(field, "invalid HTTP status %d", status)
+	}
+}
+
+// firstOverlap returns the index of the first route answering the same
+// requests as route, or -1
+func firstOverlap(routes []Route, route Route) int {
+	for i, other := range routes {
+		if other.Overlaps(route) {
+			return i
+		}
+	}
+	return -1
+}
+
+// isJSONContentType reports whether a content type, empty meaning the
+// default application/json, carries JSON
+func isJSONContentType(contentType string) bool {
+	if contentType == "" {
+		return true
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	return err == nil && (mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"))
+}
+
+// validToken reports whether s is a valid HTTP token, as used in methods and
+// header names
+func validToken(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		if c <= ' ' || c >= 0x7f || strings.ContainsRune("\"(),/:;<=>?@[\\]{}", c) {
+			return false
+		}
+	}
+	return true
+}
+
+// triggerName matches the names of long poll triggers, which are part of
+// the admin trigger URL
+var triggerName = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
+
+// graphQLName matches GraphQL names, such as operation names
+var graphQLName = regexp.MustCompile(`^[_A-Za-z][_0-9A-Za-z]*$`)
+
+// grpcMethodName matches full gRPC method names, such as
+// acme.v1.Greeter/SayHello
+var grpcMethodName = regexp.MustCompile(`^[_A-Za-z][_0-9A-Za-z]*(\.[_A-Za-z][_0-9A-Za-z]*)*/[_A-Za-z][_0-9A-Za-z]*$`)
+
+// validCloseCode reports whether a WebSocket close code may be sent by an
+// endpoint; 1004-1006 and 1015 are reserved for reporting
+func validCloseCode(code int) bool {
+	return (code >= 1000 && code <= 1003) || (code >= 1007 && code <= 1014) || (code >= 3000 && code <= 4999)
+}
+
+// checkPattern reports paths that http.ServeMux refuses to register
+func checkPattern(pattern string) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+	http.NewServeMux().HandleFunc(pattern, func(http.ResponseWriter, *http.Request) {})
+	return nil
+}
+
+// parentField strips the last component of a dotted field path
+func parentField(field string) string {
+	if i := strings.LastIndexAny(field, ".["); i > 0 {
+		return field[:i]
+	}
+	return ""
+}
+
+// loadPositions maps the dotted field paths of a YAML (or JSON) file to
+// their positions. Files in other formats, or that cannot be parsed, yield
+// no positions.
+func loadPositions(file string) map[string]position {
+	positions := make(map[string]position)
+	if format := configFormat(file); format != "yaml" && format != "yml" && format != "json" {
+		return positions
+	}
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return positions
+	}
+
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil || len(root.Content) == 0 {
+		return positions
+	}
+
+	var walk func(node *yaml.Node, field string)
+	walk = func(node *yaml.Node, field string) {
+		switch node.Kind {
+		case yaml.MappingNode:
+			for i := 0; i+1 < len(node.Content); i += 2 {
+				key, value := node.Content[i], node.Content[i+1]
+				child := key.Value
+				if field != "" {
+					child = field + "." + key.Value
+				}
+				positions[child] = position{key.Line, key.Column}
+				walk(value, child)
+			}
+		case yaml.SequenceNode:
+			for i, item := range node.Content {
+				child := field + "[" + strconv.Itoa(i) + "]"
+				positions[child] = position{item.Line, item.Column}
+				walk(item, child)
+			}
+		}
+	}
+	walk(root.Content[0], "")
+
+	return positions
+}
@@ -0,0 +1,432 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name          string
+		routes        []Route
+		expectedField string
+		expectedText  string
+	}{
+		{
+			name:   "valid routes",
+			routes: []Route{{Path: "/a", Type: "dummy"}, {Path: "/b", Type: "json", JSONContent: `{"ok": true}`}},
+		},
+		{
+			name:          "unknown type",
+			routes:        []Route{{Path: "/a", Type: "statik"}},
+			expectedField: "routes[0].type",
+			expectedText:  "unknown route type",
+		},
+		{
+			name:          "static without file path",
+			routes:        []Route{{Path: "/a", Type: "static"}},
+			expectedField: "routes[0].file_path",
+			expectedText:  "file_path is required",
+		},
+		{
+			name:          "static with missing file",
+			routes:        []Route{{Path: "/a", Type: "static", FilePath: "/non/existing/file.html"}},
+			expectedField: "routes[0].file_path",
+			expectedText:  "not readable",
+		},
+		{
+			name:   "static dir",
+			routes: []Route{{Path: "/assets/", Type: "static_dir", Dir: ".", IndexFiles: []string{"index.htm"}}},
+		},
+		{
+			name:          "static dir without dir",
+			routes:        []Route{{Path: "/assets/", Type: "static_dir"}},
+			expectedField: "routes[0].dir",
+			expectedText:  "dir is required",
+		},
+		{
+			name:          "static dir pointing at a file",
+			routes:        []Route{{Path: "/assets/", Type: "static_dir", Dir: "validate.go"}},
+			expectedField: "routes[0].dir",
+			expectedText:  "not a directory",
+		},
+		{
+			name:          "static dir path without trailing slash",
+			routes:        []Route{{Path: "/assets", Type: "static_dir", Dir: "."}},
+			expectedField: "routes[0].path",
+			expectedText:  "ending in /",
+		},
+		{
+			name:          "static dir index file with separator",
+			routes:        []Route{{Path: "/assets/", Type: "static_dir", Dir: ".", IndexFiles: []string{"../index.html"}}},
+			expectedField: "routes[0].index_files[0]",
+			expectedText:  "invalid index file name",
+		},
+		{
+			name:   "sse",
+			routes: []Route{{Path: "/events", Type: "sse", Events: []SSEEvent{{Data: "a"}, {ID: "2", Data: "b", Delay: 1000}}, Loop: true}},
+		},
+		{
+			name:          "sse without events",
+			routes:        []Route{{Path: "/events", Type: "sse"}},
+			expectedField: "routes[0].events",
+			expectedText:  "events are required",
+		},
+		{
+			name:          "sse empty event",
+			routes:        []Route{{Path: "/events", Type: "sse", Events: []SSEEvent{{Delay: 10}}}},
+			expectedField: "routes[0].events[0]",
+			expectedText:  "needs data",
+		},
+		{
+			name:          "sse multi-line id",
+			routes:        []Route{{Path: "/events", Type: "sse", Events: []SSEEvent{{ID: "1\n2", Data: "a"}}}},
+			expectedField: "routes[0].events[0].id",
+			expectedText:  "single line",
+		},
+		{
+			name:          "sse loop without delay",
+			routes:        []Route{{Path: "/events", Type: "sse", Events: []SSEEvent{{Data: "a"}}, Loop: true}},
+			expectedField: "routes[0].loop",
+			expectedText:  "need a delay",
+		},
+		{
+			name:   "stream",
+			routes: []Route{{Path: "/tokens", Type: "stream", ContentType: "application/x-ndjson", Chunks: []StreamChunk{{Data: `{"token": "a"}`}, {Data: "{\"done\": true}\n", Delay: 100}}}},
+		},
+		{
+			name:          "stream without chunks",
+			routes:        []Route{{Path: "/tokens", Type: "stream"}},
+			expectedField: "routes[0].chunks",
+			expectedText:  "chunks are required",
+		},
+		{
+			name:          "stream negative delay",
+			routes:        []Route{{Path: "/tokens", Type: "stream", Chunks: []StreamChunk{{Data: "a", Delay: -1}}}},
+			expectedField: "routes[0].chunks[0].delay",
+			expectedText:  "must not be negative",
+		},
+		{
+			name:          "ndjson chunk spanning lines",
+			routes:        []Route{{Path: "/tokens", Type: "stream", ContentType: "application/x-ndjson", Chunks: []StreamChunk{{Data: "{\"a\": 1}\n{\"b\": 2}"}}}},
+			expectedField: "routes[0].chunks[0].data",
+			expectedText:  "single-line JSON values",
+		},
+		{
+			name:   "long poll",
+			routes: []Route{{Path: "/poll", Type: "long_poll", Trigger: "orders.v1", Timeout: 1000, TimeoutStatus: 304, JSONContent: `{"orders": []}`}},
+		},
+		{
+			name:          "long poll invalid trigger",
+			routes:        []Route{{Path: "/poll", Type: "long_poll", Trigger: "orders/new"}},
+			expectedField: "routes[0].trigger",
+			expectedText:  "invalid trigger name",
+		},
+		{
+			name:          "long poll negative timeout",
+			routes:        []Route{{Path: "/poll", Type: "long_poll", Timeout: -5}},
+			expectedField: "routes[0].timeout",
+			expectedText:  "must not be negative",
+		},
+		{
+			name:          "long poll invalid timeout status",
+			routes:        []Route{{Path: "/poll", Type: "long_poll", TimeoutStatus: 99}},
+			expectedField: "routes[0].timeout_status",
+		},
+		{
+			name:   "graphql",
+			routes: []Route{{Path: "/graphql", Type: "graphql", Schema: "validate.go", Resolvers: map[string]GraphQLResolver{"GetViewer": {Data: `{"me": null}`}, "Forbidden": {Errors: []string{"Not authorized"}}}}},
+		},
+		{
+			name:          "graphql without schema",
+			routes:        []Route{{Path: "/graphql", Type: "graphql"}},
+			expectedField: "routes[0].schema",
+			expectedText:  "schema is required",
+		},
+		{
+			name:          "graphql invalid operation name",
+			routes:        []Route{{Path: "/graphql", Type: "graphql", Schema: "validate.go", Resolvers: map[string]GraphQLResolver{"get-viewer": {Data: "{}"}}}},
+			expectedField: "routes[0].resolvers.get-viewer",
+			expectedText:  "invalid operation name",
+		},
+		{
+			name:          "graphql resolver without data or errors",
+			routes:        []Route{{Path: "/graphql", Type: "graphql", Schema: "validate.go", Resolvers: map[string]GraphQLResolver{"GetViewer": {}}}},
+			expectedField: "routes[0].resolvers.GetViewer",
+			expectedText:  "needs data or errors",
+		},
+		{
+			name:          "graphql resolver data not an object",
+			routes:        []Route{{Path: "/graphql", Type: "graphql", Schema: "validate.go", Resolvers: map[string]GraphQLResolver{"GetViewer": {Data: "[1]"}}}},
+			expectedField: "routes[0].resolvers.GetViewer.data",
+			expectedText:  "must be a JSON object",
+		},
+		{
+			name:   "grpc",
+			routes: []Route{{Path: "/", Type: "grpc", DescriptorSet: "validate.go", RPCs: []GRPCMethod{{Method: "acme.v1.Greeter/SayHello", Responses: []string{`{"message": "Hi"}`}, Trailers: map[string]string{"x-request-id": "1"}}, {Method: "acme.v1.Greeter/Fail", Code: "NOT_FOUND"}}}},
+		},
+		{
+			name:          "grpc without descriptor set",
+			routes:        []Route{{Path: "/", Type: "grpc"}},
+			expectedField: "routes[0].descriptor_set",
+			expectedText:  "descriptor_set is required",
+		},
+		{
+			name:          "grpc path without trailing slash",
+			routes:        []Route{{Path: "/rpc", Type: "grpc", DescriptorSet: "validate.go"}},
+			expectedField: "routes[0].path",
+			expectedText:  "path ending in /",
+		},
+		{
+			name:          "grpc invalid method",
+			routes:        []Route{{Path: "/", Type: "grpc", DescriptorSet: "validate.go", RPCs: []GRPCMethod{{Method: "/acme.v1.Greeter/SayHello"}}}},
+			expectedField: "routes[0].rpcs[0].method",
+			expectedText:  "expected package.Service/Method",
+		},
+		{
+			name:          "grpc duplicate method",
+			routes:        []Route{{Path: "/", Type: "grpc", DescriptorSet: "validate.go", RPCs: []GRPCMethod{{Method: "acme.v1.Greeter/SayHello"}, {Method: "acme.v1.Greeter/SayHello"}}}},
+			expectedField: "routes[0].rpcs[1].method",
+			expectedText:  "duplicate method",
+		},
+		{
+			name:          "grpc response not an object",
+			routes:        []Route{{Path: "/", Type: "grpc", DescriptorSet: "validate.go", RPCs: []GRPCMethod{{Method: "acme.v1.Greeter/SayHello", Responses: []string{"hi"}}}}},
+			expectedField: "routes[0].rpcs[0].responses[0]",
+			expectedText:  "must be a JSON object",
+		},
+		{
+			name:          "grpc unknown code",
+			routes:        []Route{{Path: "/", Type: "grpc", DescriptorSet: "validate.go", RPCs: []GRPCMethod{{Method: "acme.v1.Greeter/Fail", Code: "17"}}}},
+			expectedField: "routes[0].rpcs[0].code",
+			expectedText:  "unknown status code",
+		},
+		{
+			name:          "grpc reserved trailer",
+			routes:        []Route{{Path: "/", Type: "grpc", DescriptorSet: "validate.go", RPCs: []GRPCMethod{{Method: "acme.v1.Greeter/Fail", Trailers: map[string]string{"grpc-status": "0"}}}}},
+			expectedField: "routes[0].rpcs[0].trailers",
+			expectedText:  "invalid trailer name",
+		},
+		{
+			name:   "websocket",
+			routes: []Route{{Path: "/ws", Type: "websocket", Subprotocols: []string{"graphql-ws"}, Messages: []WebSocketMessage{{Send: "hi"}, {Match: "^bye$", Close: 1000}}}},
+		},
+		{
+			name:          "websocket message without send or close",
+			routes:        []Route{{Path: "/ws", Type: "websocket", Messages: []WebSocketMessage{{Match: "ping"}}}},
+			expectedField: "routes[0].messages[0]",
+			expectedText:  "needs send or close",
+		},
+		{
+			name:          "websocket invalid pattern",
+			routes:        []Route{{Path: "/ws", Type: "websocket", Messages: []WebSocketMessage{{Match: "(", Send: "a"}}}},
+			expectedField: "routes[0].messages[0].match",
+			expectedText:  "invalid pattern",
+		},
+		{
+			name:          "websocket reserved close code",
+			routes:        []Route{{Path: "/ws", Type: "websocket", Messages: []WebSocketMessage{{Close: 1006}}}},
+			expectedField: "routes[0].messages[0].close",
+			expectedText:  "invalid close code",
+		},
+		{
+			name:          "websocket invalid subprotocol",
+			routes:        []Route{{Path: "/ws", Type: "websocket", Subprotocols: []string{"chat v1"}}},
+			expectedField: "routes[0].subprotocols[0]",
+			expectedText:  "invalid subprotocol",
+		},
+		{
+			name:          "unparseable json content",
+			routes:        []Route{{Path: "/a", Type: "json", JSONContent: `{"a": }`}},
+			expectedField: "routes[0].json_content",
+			expectedText:  "not valid JSON",
+		},
+		{
+			name:          "duplicate path",
+			routes:        []Route{{Path: "/a", Type: "dummy"}, {Path: "/a", Type: "dummy"}},
+			expectedField: "routes[1].path",
+			expectedText:  "duplicate path",
+		},
+		{
+			name:   "same path with different methods",
+			routes: []Route{{Path: "/a", Type: "json", Methods: []string{"GET"}, Status: 204}, {Path: "/a", Type: "dummy", Methods: []string{"POST"}}},
+		},
+		{
+			name:          "same path with a shared method",
+			routes:        []Route{{Path: "/a", Type: "dummy", Methods: []string{"GET", "POST"}}, {Path: "/a", Type: "dummy", Methods: []string{"post"}}},
+			expectedField: "routes[1].path",
+			expectedText:  "give the routes different methods",
+		},
+		{
+			name:          "invalid method",
+			routes:        []Route{{Path: "/a", Type: "dummy", Methods: []string{"GET POST"}}},
+			expectedField: "routes[0].methods[0]",
+			expectedText:  "invalid method",
+		},
+		{
+			name:          "static route with a write method",
+			routes:        []Route{{Path: "/a", Type: "static", FilePath: "validate.go", Methods: []string{"GET", "POST"}}},
+			expectedField: "routes[0].methods[1]",
+			expectedText:  "static routes only answer GET and HEAD",
+		},
+		{
+			name:   "static route with head only",
+			routes: []Route{{Path: "/a", Type: "static", FilePath: "validate.go", Methods: []string{"head"}}},
+		},
+		{
+			name:          "invalid status",
+			routes:        []Route{{Path: "/a", Type: "dummy", Status: 99}},
+			expectedField: "routes[0].status",
+			expectedText:  "invalid HTTP status",
+		},
+		{
+			name:          "json without content or status",
+			routes:        []Route{{Path: "/a", Type: "json"}},
+			expectedField: "routes[0].json_content",
+			expectedText:  "json_content is required",
+		},
+		{
+			name:   "json with a non-JSON content type",
+			routes: []Route{{Path: "/a", Type: "json", JSONContent: "hello", ContentType: "text/plain"}},
+		},
+		{
+			name:          "invalid header name",
+			routes:        []Route{{Path: "/a", Type: "dummy", Headers: map[string]string{"X Bad": "1"}}},
+			expectedField: "routes[0].headers",
+			expectedText:  "invalid header name",
+		},
+		{
+			name:          "admin path",
+			routes:        []Route{{Path: "/__admin/har", Type: "dummy"}},
+			expectedField: "routes[0].path",
+			expectedText:  "reserved for the admin endpoints",
+		},
+		{
+			name:          "invalid content type",
+			routes:        []Route{{Path: "/a", Type: "dummy", ContentType: "application/json;;"}},
+			expectedField: "routes[0].content_type",
+			expectedText:  "invalid content type",
+		},
+		{
+			name:          "invalid exposed header",
+			routes:        []Route{{Path: "/a", Type: "dummy", CORS: &CORSConfig{ExposeHeaders: []string{"Grpc-Status", "X Total"}}}},
+			expectedField: "routes[0].cors.expose_headers[1]",
+			expectedText:  "invalid header name",
+		},
+		{
+			name:          "invalid header pattern",
+			routes:        []Route{{Path: "/a", RequireHeaders: &RequireHeadersConfig{Headers: []HeaderRequirement{{Name: "site-token", Pattern: "("}}}}},
+			expectedField: "routes[0].require_headers.headers[0].pattern",
+			expectedText:  "invalid pattern",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := DefaultConfig()
+			cfg.Routes = tt.routes
+
+			problems := Validate(cfg, "")
+			if tt.expectedField == "" {
+				if len(problems) != 0 {
+					t.Errorf("Expected no problems, got %v", problems)
+				}
+				return
+			}
+
+			if len(problems) != 1 {
+				t.Fatalf("Expected 1 problem, got %d: %v", len(problems), problems)
+			}
+			if problems[0].Field != tt.expectedField {
+				t.Errorf("Expected field %s, got %s", tt.expectedField, problems[0].Field)
+			}
+			if !strings.Contains(problems[0].Message, tt.expectedText) {
+				t.Errorf("Expected message containing %q, got %q", tt.expectedText, problems[0].Message)
+			}
+		})
+	}
+}
+
+func TestValidateOpenAPI(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.OpenAPI.Validate = "strict"
+	if problems := Validate(cfg, ""); len(problems) != 1 || !strings.Contains(problems[0].Message, "unknown validation mode") {
+		t.Errorf("Expected unknown mode problem, got %v", problems)
+	}
+
+	cfg.OpenAPI.Validate = "enforce"
+	if problems := Validate(cfg, ""); len(problems) != 1 || !strings.Contains(problems[0].Message, "requires openapi.spec") {
+		t.Errorf("Expected missing spec problem, got %v", problems)
+	}
+
+	cfg.OpenAPI.Spec = "api.yaml"
+	if problems := Validate(cfg, ""); len(problems) != 0 {
+		t.Errorf("Expected no problems, got %v", problems)
+	}
+}
+
+func TestValidateMimeTypes(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.MimeTypes = map[string]string{"wasm": "application/wasm", "bad": "not a type"}
+	if problems := Validate(cfg, ""); len(problems) != 1 || problems[0].Field != "mime_types.bad" {
+		t.Errorf("Expected invalid content type problem, got %v", problems)
+	}
+}
+
+func TestValidateCompression(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Compression.MinSize = -1
+	cfg.Routes[0].Compression = &CompressionConfig{Encodings: []string{"GZIP", "lzma"}}
+
+	problems := Validate(cfg, "")
+	if len(problems) != 2 {
+		t.Fatalf("Expected 2 problems, got %v", problems)
+	}
+	if problems[0].Field != "compression.min_size" || problems[1].Field != "routes[0].compression.encodings[1]" {
+		t.Errorf("Unexpected problems: %v", problems)
+	}
+}
+
+func TestValidateHAR(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.HAR.MaxEntries = -1
+	if problems := Validate(cfg, ""); len(problems) != 1 || problems[0].Field != "har.max_entries" {
+		t.Errorf("Expected max_entries problem, got %v", problems)
+	}
+}
+
+func TestValidatePositions(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "config.yaml")
+	content := `port: 8081
+routes:
+  - path: "/ok"
+    type: "dummy"
+  - path: "/broken"
+    type: "json"
+    json_content: '{"a": }'
+`
+	if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	cfg := DefaultConfig()
+	cfg.Routes = []Route{
+		{Path: "/ok", Type: "dummy"},
+		{Path: "/broken", Type: "json", JSONContent: `{"a": }`},
+	}
+
+	problems := Validate(cfg, file)
+	if len(problems) != 1 {
+		t.Fatalf("Expected 1 problem, got %d: %v", len(problems), problems)
+	}
+
+	if problems[0].Line != 7 || problems[0].Column != 5 {
+		t.Errorf("Expected position 7:5, got %d:%d", problems[0].Line, problems[0].Column)
+	}
+	if !strings.HasPrefix(problems[0].Error(), file+":7:5: routes[1].json_content: ") {
+		t.Errorf("Unexpected error format: %s", problems[0].Error())
+	}
+}
@@ -0,0 +1,68 @@
+package har
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEncodeDecode(t *testing.T) {
+	started := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	h := &HAR{Log: Log{
+		Version: Version,
+		Creator: Creator{Name: "mock-cors-server", Version: "dev"},
+		Entries: []Entry{{
+			StartedDateTime: started,
+			Time:            12.5,
+			Request:         Request{Method: "GET", URL: "http://localhost:8081/a", HTTPVersion: "HTTP/1.1", HeadersSize: -1},
+			Response: Response{
+				Status:  200,
+				Headers: []NameValue{{Name: "Content-Type", Value: "application/json"}},
+				Content: Content{Size: 2, MimeType: "application/json", Text: "{}"},
+			},
+			Timings: Timings{Blocked: -1, DNS: -1, Connect: -1, Wait: 12.5, SSL: -1},
+		}},
+	}}
+
+	var buf bytes.Buffer
+	if err := h.Encode(&buf); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	// Required fields are written even when empty
+	for _, expected := range []string{`"cache": {}`, `"redirectURL": ""`, `"startedDateTime": "2024-05-01T10:00:00Z"`} {
+		if !strings.Contains(buf.String(), expected) {
+			t.Errorf("Expected output to contain %s, got:\n%s", expected, buf.String())
+		}
+	}
+
+	decoded, err := Decode(&buf)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	entry := decoded.Log.Entries[0]
+	if !entry.StartedDateTime.Equal(started) || entry.Response.Content.Text != "{}" {
+		t.Errorf("Unexpected entry after round trip: %+v", entry)
+	}
+	if Header(entry.Response.Headers, "content-type") != "application/json" {
+		t.Errorf("Expected case-insensitive header lookup")
+	}
+}
+
+func TestDecodeInvalid(t *testing.T) {
+	if _, err := Decode(strings.NewReader(`{"entries": []}`)); err == nil {
+		t.Error("Expected an error for a document without a log")
+	}
+}
+
+func TestContentBody(t *testing.T) {
+	body, err := Content{Text: "aGk=", Encoding: "base64"}.Body()
+	if err != nil || string(body) != "hi" {
+		t.Errorf("Expected decoded base64 body, got %q, %v", body, err)
+	}
+
+	body, err = Content{Text: "plain"}.Body()
+	if err != nil || string(body) != "plain" {
+		t.Errorf("Expected text body, got %q, %v", body, err)
+	}
+}
@@ -0,0 +1,189 @@
+package importer
+
+import (
+	"fmt"
+	"mime"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/developmeh/mock-cors-server/internal/config"
+)
+
+// Capture is a recorded response to turn into a route. The body is kept
+// out of the route so it can be written to a file of its own.
+type Capture struct {
+	Route config.Route
+	Body  []byte
+}
+
+// skippedHeaders are response headers the server sets itself, or that no
+// longer apply to the stored body
+var skippedHeaders = map[string]bool{
+	"access-control-allow-credentials": true,
+	"access-control-allow-headers":     true,
+	"access-control-allow-methods":     true,
+	"access-control-allow-origin":      true,
+	"access-control-max-age":           true,
+	"connection":                       true,
+	"content-encoding":                 true,
+	"content-length":                   true,
+	"content-type":                     true,
+	"date":                             true,
+	"keep-alive":                       true,
+	"transfer-encoding":                true,
+}
+
+// unsafeName matches characters left out of body file names
+var unsafeName = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// setHeader adds a captured response header to a route, keeping the first
+// value of repeated headers
+func setHeader(route *config.Route, name, value string) {
+	if name == "" || strings.HasPrefix(name, ":") || skippedHeaders[strings.ToLower(name)] {
+		return
+	}
+	if route.Headers == nil {
+		route.Headers = make(map[string]string)
+	}
+	for existing := range route.Headers {
+		if strings.EqualFold(existing, name) {
+			return
+		}
+	}
+	route.Headers[name] = value
+}
+
+// routePath converts a captured URL path to a server pattern. A trailing
+// slash would match every path below it, so it is anchored with {$}.
+func routePath(path string) string {
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	if strings.HasSuffix(path, "/") {
+		path += "{$}"
+	}
+	return path
+}
+
+// collector keeps the first capture for each method and path
+type collector struct {
+	captures   []Capture
+	seen       map[string]bool
+	duplicates map[string]int
+	order      []string
+}
+
+// add records a capture, reporting whether it is the first for its route
+func (c *collector) add(capture Capture) bool {
+	if c.seen == nil {
+		c.seen = make(map[string]bool)
+		c.duplicates = make(map[string]int)
+	}
+
+	key := capture.Route.Methods[0] + " " + capture.Route.Path
+	if c.seen[key] {
+		if c.duplicates[key] == 0 {
+			c.order = append(c.order, key)
+		}
+		c.duplicates[key]++
+		return false
+	}
+	c.seen[key] = true
+	c.captures = append(c.captures, capture)
+	return true
+}
+
+// warnings describes the responses left out as duplicates
+func (c *collector) warnings() []string {
+	var warnings []string
+	for _, key := range c.order {
+		warnings = append(warnings, fmt.Sprintf("%s: kept the first response, skipped %d more", key, c.duplicates[key]))
+	}
+	return warnings
+}
+
+// WriteBodies writes the bodies of captures to files in dir and returns
+// their routes. Text bodies are served by json routes referencing the file
+// with ${file:...}, relative to base, the directory of the routes file.
+// Binary bodies are served by static routes with an absolute file_path, as
+// static files are looked up from wherever the server runs.
+func WriteBodies(captures []Capture, dir, base string) ([]config.Route, []string, error) {
+	var routes []config.Route
+	var warnings []string
+	used := make(map[string]bool)
+
+	for _, capture := range captures {
+		route := capture.Route
+		route.Type = "json"
+		if len(capture.Body) == 0 {
+			routes = append(routes, route)
+			continue
+		}
+
+		name := bodyFileName(route, used)
+		file := filepath.Join(dir, name)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, nil, fmt.Errorf("unable to create %s: %w", dir, err)
+		}
+		if err := os.WriteFile(file, capture.Body, 0644); err != nil {
+			return nil, nil, fmt.Errorf("unable to write body: %w", err)
+		}
+
+		if utf8.Valid(capture.Body) {
+			ref, err := filepath.Rel(base, file)
+			if err != nil {
+				ref, _ = filepath.Abs(file)
+			}
+			route.JSONContent = "${file:" + filepath.ToSlash(ref) + "}"
+		} else {
+			if route.Status != 200 || route.Methods[0] != "GET" {
+				warnings = append(warnings, fmt.Sprintf("%s %s: binary body served as a static file, answering GET with 200", route.Methods[0], route.Path))
+			}
+			route.Type = "static"
+			route.FilePath = file
+			if abs, err := filepath.Abs(file); err == nil {
+				route.FilePath = abs
+			}
+			route.Methods = nil
+			route.Status = 0
+		}
+		routes = append(routes, route)
+	}
+
+	return routes, warnings, nil
+}
+
+// bodyFileName names the body file of a route after its method and path,
+// with an extension matching its content type
+func bodyFileName(route config.Route, used map[string]bool) string {
+	base := strings.Trim(unsafeName.ReplaceAllString(route.Path, "_"), "_.")
+	if base == "" {
+		base = "root"
+	}
+	base = strings.ToLower(route.Methods[0]) + "_" + base
+
+	ext := ".body"
+	mediaType, _, _ := mime.ParseMediaType(route.ContentType)
+	switch {
+	case isJSON(mediaType):
+		ext = ".json"
+	case mediaType == "text/plain":
+		ext = ".txt"
+	case mediaType != "":
+		if exts, _ := mime.ExtensionsByType(mediaType); len(exts) > 0 {
+			ext = exts[0]
+		}
+	}
+
+	// Paths such as /logo.png already end with the extension
+	base = strings.TrimSuffix(base, ext)
+	name := base + ext
+	for i := 2; used[name]; i++ {
+		name = fmt.Sprintf("%s-%d%s", base, i, ext)
+	}
+	used[name] = true
+	return name
+}
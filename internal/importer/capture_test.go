@@ -0,0 +1,124 @@
+package importer
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/developmeh/mock-cors-server/internal/config"
+	"github.com/spf13/viper"
+)
+
+func TestWriteBodies(t *testing.T) {
+	base := t.TempDir()
+	dir := filepath.Join(base, "bodies")
+
+	captures := []Capture{
+		{Route: config.Route{Path: "/orders/{id}", Methods: []string{"GET"}, Status: 200, ContentType: "application/json"}, Body: []byte(`{"id": 1}`)},
+		{Route: config.Route{Path: "/orders/{id}", Methods: []string{"DELETE"}, Status: 204}},
+		{Route: config.Route{Path: "/logo.png", Methods: []string{"GET"}, Status: 200, ContentType: "image/png"}, Body: []byte{0x89, 'P', 'N', 'G', 0xff}},
+		{Route: config.Route{Path: "/orders/{id}", Methods: []string{"PUT"}, Status: 200, ContentType: "application/json"}, Body: []byte(`{}`)},
+	}
+
+	routes, warnings, err := WriteBodies(captures, dir, base)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(warnings) != 0 {
+		t.Errorf("Expected no warnings, got %v", warnings)
+	}
+
+	if routes[0].Type != "json" || routes[0].JSONContent != "${file:bodies/get_orders_id.json}" {
+		t.Errorf("Expected a file reference, got %+v", routes[0])
+	}
+	if data, err := os.ReadFile(filepath.Join(dir, "get_orders_id.json")); err != nil || string(data) != `{"id": 1}` {
+		t.Errorf("Expected body file, got %q, %v", data, err)
+	}
+
+	if routes[1].Type != "json" || routes[1].JSONContent != "" || routes[1].Status != 204 {
+		t.Errorf("Expected an empty json route, got %+v", routes[1])
+	}
+
+	// Binary bodies are served as static files
+	if routes[2].Type != "static" || routes[2].FilePath != filepath.Join(dir, "get_logo.png") || routes[2].Methods != nil {
+		t.Errorf("Expected a static route, got %+v", routes[2])
+	}
+
+	if routes[3].JSONContent != "${file:bodies/put_orders_id.json}" {
+		t.Errorf("Expected a body per method, got %+v", routes[3])
+	}
+
+	// The routes load, resolving the references relative to the routes file
+	data, err := config.EncodeRoutes(routes)
+	if err != nil {
+		t.Fatalf("Expected routes to encode, got %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(base, "routes.yaml"), data, 0644); err != nil {
+		t.Fatalf("Failed to write routes: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(base, "config.yaml"), []byte("include: [routes.yaml]\n"), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	viper.Reset()
+	viper.SetConfigFile(filepath.Join(base, "config.yaml"))
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		t.Fatalf("Expected config to load, got %v", err)
+	}
+	if cfg.Routes[0].JSONContent != `{"id": 1}` {
+		t.Errorf("Expected the body to be read back, got %s", cfg.Routes[0].JSONContent)
+	}
+	for _, problem := range config.Validate(cfg, "") {
+		t.Errorf("Unexpected problem: %v", problem)
+	}
+}
+
+func TestWriteBodiesRelativeOutput(t *testing.T) {
+	work := t.TempDir()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get working directory: %v", err)
+	}
+	if err := os.Chdir(work); err != nil {
+		t.Fatalf("Failed to change directory: %v", err)
+	}
+	defer os.Chdir(wd)
+
+	// As with import har -o routes.d/session.yaml
+	captures := []Capture{
+		{Route: config.Route{Path: "/data", Methods: []string{"GET"}, Status: 200, ContentType: "application/json"}, Body: []byte(`{}`)},
+		{Route: config.Route{Path: "/logo.png", Methods: []string{"GET"}, Status: 200, ContentType: "image/png"}, Body: []byte{0x89, 'P', 'N', 'G', 0xff}},
+	}
+	routes, _, err := WriteBodies(captures, filepath.Join("routes.d", "bodies"), "routes.d")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if routes[0].JSONContent != "${file:bodies/get_data.json}" {
+		t.Errorf("Expected a reference relative to the routes file, got %s", routes[0].JSONContent)
+	}
+	// The server may run from another directory than the importer
+	if !filepath.IsAbs(routes[1].FilePath) || !strings.HasSuffix(routes[1].FilePath, filepath.Join("routes.d", "bodies", "get_logo.png")) {
+		t.Errorf("Expected an absolute file_path, got %s", routes[1].FilePath)
+	}
+	if err := os.Chdir(wd); err != nil {
+		t.Fatalf("Failed to change directory: %v", err)
+	}
+	if _, err := os.Stat(routes[1].FilePath); err != nil {
+		t.Errorf("Expected the body to be found from another directory, got %v", err)
+	}
+}
+
+func TestWriteBodiesBinaryWarning(t *testing.T) {
+	base := t.TempDir()
+	captures := []Capture{
+		{Route: config.Route{Path: "/upload", Methods: []string{"POST"}, Status: 201, ContentType: "application/octet-stream"}, Body: []byte{0xff, 0xfe}},
+	}
+
+	_, warnings, err := WriteBodies(captures, base, base)
+	if err != nil || len(warnings) != 1 {
+		t.Errorf("Expected a warning for a binary POST response, got %v, %v", warnings, err)
+	}
+}
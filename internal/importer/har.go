@@ -0,0 +1,81 @@
+package importer
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/developmeh/mock-cors-server/internal/config"
+	"github.com/developmeh/mock-cors-server/internal/har"
+)
+
+// HAR creates a capture for every request of a HAR log, keeping the first
+// response for each method and path. Preflights are left out, since the
+// server answers them from its CORS settings, and so are WebSocket
+// connections, which need a scripted websocket route. When host is set, only
+// requests to that host are kept.
+func HAR(log *har.HAR, host string) ([]Capture, []string) {
+	var c collector
+	var warnings []string
+	hosts := make(map[string]int)
+
+	for i, entry := range log.Log.Entries {
+		u, err := url.Parse(entry.Request.URL)
+		if err != nil {
+			warnings = append(warnings, fmt.Sprintf("entries[%d]: invalid URL %q", i, entry.Request.URL))
+			continue
+		}
+		if host != "" && !strings.EqualFold(u.Host, host) && !strings.EqualFold(u.Hostname(), host) {
+			continue
+		}
+		method := strings.ToUpper(entry.Request.Method)
+		if method == http.MethodOptions || entry.Response.Status == 0 {
+			// Preflights, and requests that never got a response
+			continue
+		}
+		if entry.Response.Status == http.StatusSwitchingProtocols {
+			warnings = append(warnings, fmt.Sprintf("entries[%d]: WebSocket connection to %s not imported", i, u.Path))
+			continue
+		}
+
+		body, err := entry.Response.Content.Body()
+		if err != nil {
+			warnings = append(warnings, fmt.Sprintf("entries[%d]: invalid body encoding: %v", i, err))
+			continue
+		}
+
+		route := config.Route{
+			Path:        routePath(u.EscapedPath()),
+			Methods:     []string{method},
+			Status:      entry.Response.Status,
+			ContentType: entry.Response.Content.MimeType,
+		}
+		if route.ContentType == "" {
+			route.ContentType = har.Header(entry.Response.Headers, "Content-Type")
+		}
+		// Browsers record placeholders such as x-unknown for empty bodies
+		if !strings.Contains(route.ContentType, "/") {
+			route.ContentType = ""
+		}
+		for _, h := range entry.Response.Headers {
+			setHeader(&route, h.Name, h.Value)
+		}
+
+		if c.add(Capture{Route: route, Body: body}) {
+			hosts[u.Host]++
+		}
+	}
+
+	if host == "" && len(hosts) > 1 {
+		names := make([]string, 0, len(hosts))
+		for name := range hosts {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		warnings = append(warnings, fmt.Sprintf("requests to %d hosts were merged (%s); pick one with --host", len(hosts), strings.Join(names, ", ")))
+	}
+
+	return c.captures, append(warnings, c.warnings()...)
+}
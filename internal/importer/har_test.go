@@ -0,0 +1,64 @@
+package importer
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/developmeh/mock-cors-server/internal/har"
+)
+
+func TestHAR(t *testing.T) {
+	log, err := har.Read("testdata/session.har")
+	if err != nil {
+		t.Fatalf("Expected HAR to load, got %v", err)
+	}
+
+	captures, warnings := HAR(log, "")
+	var routes []string
+	for _, c := range captures {
+		routes = append(routes, c.Route.Methods[0]+" "+c.Route.Path)
+	}
+	// Preflights are left out, repeated requests keep their first response
+	expected := "GET /v1/cart,POST /v1/cart/items/{$},GET /logo.png,DELETE /v1/cart"
+	if strings.Join(routes, ",") != expected {
+		t.Fatalf("Expected routes %s, got %v", expected, routes)
+	}
+	if len(warnings) != 2 || !strings.Contains(warnings[0], "2 hosts") || !strings.Contains(warnings[1], "skipped 1 more") {
+		t.Errorf("Unexpected warnings: %v", warnings)
+	}
+
+	cart := captures[0]
+	if cart.Route.Status != 200 || string(cart.Body) != `{"items": [], "total": 0}` {
+		t.Errorf("Expected the first cart response, got %d %s", cart.Route.Status, cart.Body)
+	}
+	// Headers the server sets itself are dropped
+	if len(cart.Route.Headers) != 1 || cart.Route.Headers["x-request-id"] != "req-1" {
+		t.Errorf("Expected only x-request-id, got %v", cart.Route.Headers)
+	}
+
+	if string(captures[2].Body) != "\x89PNG" {
+		t.Errorf("Expected decoded base64 body, got %q", captures[2].Body)
+	}
+	if captures[3].Route.ContentType != "" || len(captures[3].Body) != 0 {
+		t.Errorf("Expected an empty 204 without content type, got %+v", captures[3])
+	}
+
+	t.Run("websocket", func(t *testing.T) {
+		log := &har.HAR{Log: har.Log{Entries: []har.Entry{{
+			Request:      har.Request{Method: "GET", URL: "https://api.example.com/live"},
+			Response:     har.Response{Status: 101},
+			ResourceType: "websocket",
+		}}}}
+		captures, warnings := HAR(log, "")
+		if len(captures) != 0 || len(warnings) != 1 || !strings.Contains(warnings[0], "WebSocket connection to /live") {
+			t.Errorf("Expected the connection to be skipped with a warning, got %+v, %v", captures, warnings)
+		}
+	})
+
+	t.Run("host filter", func(t *testing.T) {
+		captures, warnings := HAR(log, "cdn.example.com")
+		if len(captures) != 1 || captures[0].Route.Path != "/logo.png" || len(warnings) != 0 {
+			t.Errorf("Expected only the CDN request, got %+v, %v", captures, warnings)
+		}
+	})
+}
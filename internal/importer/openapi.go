@@ -0,0 +1,351 @@
+// Package importer converts API descriptions into mock server routes.
+package importer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/developmeh/mock-cors-server/internal/config"
+	"github.com/getkin/kin-openapi/openapi3"
+)
+
+// maxSchemaDepth bounds generated bodies for recursive schemas
+const maxSchemaDepth = 8
+
+// pathParam matches a path template parameter such as {id}
+var pathParam = regexp.MustCompile(`\{([^}]*)\}`)
+
+// LoadOpenAPI reads and validates an OpenAPI 3 spec in YAML or JSON.
+// References to other files are resolved relative to the spec.
+func LoadOpenAPI(file string) (*openapi3.T, error) {
+	loader := openapi3.NewLoader()
+	loader.IsExternalRefsAllowed = true
+
+	doc, err := loader.LoadFromFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load OpenAPI spec %s: %w", file, err)
+	}
+	if err := doc.Validate(context.Background()); err != nil {
+		return nil, fmt.Errorf("invalid OpenAPI spec %s: %w", file, err)
+	}
+	return doc, nil
+}
+
+// BasePath returns the path of the first server a spec lists, with
+// variables set to their defaults, e.g. /api/v1 for
+// https://{env}.example.com/api/v1. It is empty when the spec lists no
+// servers or the first one is served from the root.
+func BasePath(doc *openapi3.T) string {
+	if len(doc.Servers) == 0 {
+		return ""
+	}
+	base, err := doc.Servers[0].BasePath()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSuffix(base, "/")
+}
+
+// OpenAPIRoutes creates a json route for every operation of a spec, with
+// the declared status code, response headers and an example body, or one
+// generated from the response schema. Paths are prefixed with the base
+// path of the first server. Warnings describe path templates that had to
+// be approximated.
+func OpenAPIRoutes(doc *openapi3.T) ([]config.Route, []string) {
+	var routes []config.Route
+	var warnings []string
+
+	paths := make([]string, 0, doc.Paths.Len())
+	for path := range doc.Paths.Map() {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	base := BasePath(doc)
+	for _, path := range paths {
+		pattern, warning := muxPattern(path)
+		if warning != "" {
+			warnings = append(warnings, warning)
+		}
+
+		operations := doc.Paths.Value(path).Operations()
+		methods := make([]string, 0, len(operations))
+		for method := range operations {
+			methods = append(methods, method)
+		}
+		sort.Strings(methods)
+
+		for _, method := range methods {
+			route := operationRoute(operations[method])
+			route.Path = base + pattern
+			route.Type = "json"
+			route.Methods = []string{method}
+			routes = append(routes, route)
+		}
+	}
+
+	return routes, warnings
+}
+
+// muxPattern converts an OpenAPI path template to a server pattern. Names
+// that are not identifiers are rewritten, and parameters sharing a segment
+// with other text, as in /files/{name}.json, match the whole segment.
+func muxPattern(path string) (string, string) {
+	var warning string
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		params := pathParam.FindAllStringSubmatch(segment, -1)
+		if len(params) == 0 {
+			continue
+		}
+		name := identifier(params[0][1])
+		if len(params) > 1 || params[0][0] != segment {
+			warning = fmt.Sprintf("path %s: parameters inside a segment match the whole segment", path)
+		}
+		segments[i] = "{" + name + "}"
+	}
+	return strings.Join(segments, "/"), warning
+}
+
+// identifier turns a parameter name into a valid wildcard name
+func identifier(name string) string {
+	var b strings.Builder
+	for i, r := range name {
+		switch {
+		case r == '_' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z':
+			b.WriteRune(r)
+		case r >= '0' && r <= '9':
+			if i == 0 {
+				b.WriteRune('_')
+			}
+			b.WriteRune(r)
+		default:
+			b.WriteRune('_')
+		}
+	}
+	if b.Len() == 0 {
+		return "param"
+	}
+	return b.String()
+}
+
+// operationRoute fills in the response of an operation: the first 2xx
+// response, else the default one, else the first declared
+func operationRoute(op *openapi3.Operation) config.Route {
+	route := config.Route{Status: 200}
+	if op.Responses == nil {
+		return route
+	}
+
+	codes := make([]string, 0, op.Responses.Len())
+	for code := range op.Responses.Map() {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+
+	var ref *openapi3.ResponseRef
+	for _, code := range codes {
+		if status, err := strconv.Atoi(code); err == nil && status >= 200 && status < 300 {
+			route.Status, ref = status, op.Responses.Value(code)
+			break
+		}
+	}
+	if ref == nil {
+		ref = op.Responses.Default()
+	}
+	if ref == nil {
+		for _, code := range codes {
+			if status, err := strconv.Atoi(code); err == nil {
+				route.Status, ref = status, op.Responses.Value(code)
+				break
+			}
+		}
+	}
+	if ref == nil || ref.Value == nil {
+		return route
+	}
+	response := ref.Value
+
+	for name, header := range response.Headers {
+		if header.Value == nil || strings.EqualFold(name, "Content-Type") {
+			continue
+		}
+		value := header.Value.Example
+		if value == nil && header.Value.Schema != nil {
+			value = fakeValue(header.Value.Schema, 0)
+		}
+		if value != nil {
+			if route.Headers == nil {
+				route.Headers = make(map[string]string)
+			}
+			route.Headers[name] = fmt.Sprint(value)
+		}
+	}
+
+	contentType, media := responseMedia(response.Content)
+	if media == nil {
+		return route
+	}
+	route.ContentType = contentType
+
+	body, ok := mediaExample(media)
+	if !ok && media.Schema != nil {
+		body, ok = fakeValue(media.Schema, 0), true
+	}
+	if !ok {
+		return route
+	}
+	if s, isString := body.(string); isString && !isJSON(contentType) {
+		route.JSONContent = s
+	} else if data, err := json.MarshalIndent(body, "", "  "); err == nil {
+		route.JSONContent = string(data)
+	}
+	return route
+}
+
+// responseMedia picks the JSON media type of a response, if any, else the
+// first declared one
+func responseMedia(content openapi3.Content) (string, *openapi3.MediaType) {
+	types := make([]string, 0, len(content))
+	for t := range content {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+
+	for _, t := range types {
+		if isJSON(t) {
+			return t, content[t]
+		}
+	}
+	if len(types) > 0 {
+		return types[0], content[types[0]]
+	}
+	return "", nil
+}
+
+// isJSON reports whether a media type holds JSON, e.g. application/problem+json
+func isJSON(mediaType string) bool {
+	base, _, _ := strings.Cut(mediaType, ";")
+	base = strings.TrimSpace(strings.ToLower(base))
+	return base == "application/json" || strings.HasSuffix(base, "+json")
+}
+
+// mediaExample returns the example of a media type, or the first of its
+// named examples
+func mediaExample(media *openapi3.MediaType) (interface{}, bool) {
+	if media.Example != nil {
+		return media.Example, true
+	}
+
+	names := make([]string, 0, len(media.Examples))
+	for name := range media.Examples {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if ex := media.Examples[name]; ex != nil && ex.Value != nil && ex.Value.Value != nil {
+			return ex.Value.Value, true
+		}
+	}
+
+	if media.Schema != nil && media.Schema.Value != nil && media.Schema.Value.Example != nil {
+		return media.Schema.Value.Example, true
+	}
+	return nil, false
+}
+
+// fakeValue generates a value matching a schema, preferring its example,
+// default and enum values
+func fakeValue(ref *openapi3.SchemaRef, depth int) interface{} {
+	if ref == nil || ref.Value == nil || depth > maxSchemaDepth {
+		return nil
+	}
+	schema := ref.Value
+
+	switch {
+	case schema.Example != nil:
+		return schema.Example
+	case schema.Default != nil:
+		return schema.Default
+	case len(schema.Enum) > 0:
+		return schema.Enum[0]
+	case len(schema.AllOf) > 0:
+		merged := make(map[string]interface{})
+		for _, part := range schema.AllOf {
+			value := fakeValue(part, depth+1)
+			object, ok := value.(map[string]interface{})
+			if !ok {
+				return value
+			}
+			for k, v := range object {
+				merged[k] = v
+			}
+		}
+		return merged
+	case len(schema.OneOf) > 0:
+		return fakeValue(schema.OneOf[0], depth+1)
+	case len(schema.AnyOf) > 0:
+		return fakeValue(schema.AnyOf[0], depth+1)
+	}
+
+	switch {
+	case schema.Type.Is("object") || schema.Type == nil && len(schema.Properties) > 0:
+		object := make(map[string]interface{}, len(schema.Properties))
+		for name, property := range schema.Properties {
+			object[name] = fakeValue(property, depth+1)
+		}
+		return object
+	case schema.Type.Is("array"):
+		if item := fakeValue(schema.Items, depth+1); item != nil {
+			return []interface{}{item}
+		}
+		return []interface{}{}
+	case schema.Type.Is("string"):
+		return fakeString(schema.Format)
+	case schema.Type.Is("integer"):
+		if schema.Min != nil {
+			return int64(*schema.Min)
+		}
+		return 0
+	case schema.Type.Is("number"):
+		if schema.Min != nil {
+			return *schema.Min
+		}
+		return 0.0
+	case schema.Type.Is("boolean"):
+		return true
+	}
+	return nil
+}
+
+// fakeString returns a sample string for a string format
+func fakeString(format string) string {
+	switch format {
+	case "date-time":
+		return "2024-01-01T00:00:00Z"
+	case "date":
+		return "2024-01-01"
+	case "time":
+		return "00:00:00"
+	case "email":
+		return "user@example.com"
+	case "uuid":
+		return "00000000-0000-4000-8000-000000000000"
+	case "uri", "url":
+		return "https://example.com"
+	case "hostname":
+		return "example.com"
+	case "ipv4":
+		return "192.0.2.1"
+	case "ipv6":
+		return "2001:db8::1"
+	case "byte":
+		return "c3RyaW5n"
+	}
+	return "string"
+}
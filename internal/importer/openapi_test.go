@@ -0,0 +1,154 @@
+package importer
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/developmeh/mock-cors-server/internal/config"
+	"github.com/getkin/kin-openapi/openapi3"
+)
+
+func loadRoutes(t *testing.T) ([]config.Route, []string) {
+	t.Helper()
+	doc, err := LoadOpenAPI("testdata/petstore.yaml")
+	if err != nil {
+		t.Fatalf("Expected spec to load, got %v", err)
+	}
+	return OpenAPIRoutes(doc)
+}
+
+// findRoute returns the route for a path and method
+func findRoute(t *testing.T, routes []config.Route, path, method string) config.Route {
+	t.Helper()
+	for _, route := range routes {
+		if route.Path == path && route.Methods[0] == method {
+			return route
+		}
+	}
+	t.Fatalf("No route for %s %s in %+v", method, path, routes)
+	return config.Route{}
+}
+
+func TestOpenAPIRoutes(t *testing.T) {
+	routes, warnings := loadRoutes(t)
+
+	if len(routes) != 5 {
+		t.Fatalf("Expected 5 routes, got %d", len(routes))
+	}
+	for _, route := range routes {
+		if route.Type != "json" || len(route.Methods) != 1 {
+			t.Errorf("Expected a json route for one method, got %+v", route)
+		}
+	}
+
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "/files/{name}.json") {
+		t.Errorf("Expected a warning for the partial segment parameter, got %v", warnings)
+	}
+
+	t.Run("example body", func(t *testing.T) {
+		route := findRoute(t, routes, "/pets", "POST")
+		if route.Status != 201 {
+			t.Errorf("Expected status 201, got %d", route.Status)
+		}
+		var body map[string]interface{}
+		if err := json.Unmarshal([]byte(route.JSONContent), &body); err != nil || body["name"] != "Rex" {
+			t.Errorf("Expected example body, got %s", route.JSONContent)
+		}
+	})
+
+	t.Run("schema body and headers", func(t *testing.T) {
+		route := findRoute(t, routes, "/pets", "GET")
+		var body []map[string]interface{}
+		if err := json.Unmarshal([]byte(route.JSONContent), &body); err != nil || len(body) != 1 {
+			t.Fatalf("Expected a generated list, got %s", route.JSONContent)
+		}
+		if body[0]["kind"] != "dog" || body[0]["born"] != "2024-01-01" {
+			t.Errorf("Expected enum and format values, got %v", body[0])
+		}
+		if route.Headers["X-Total"] != "3" {
+			t.Errorf("Expected header from schema minimum, got %v", route.Headers)
+		}
+	})
+
+	t.Run("default response", func(t *testing.T) {
+		route := findRoute(t, routes, "/pets/{pet_id}", "GET")
+		if route.Status != 200 || !strings.Contains(route.JSONContent, `"id"`) {
+			t.Errorf("Expected default response as 200, got %d %s", route.Status, route.JSONContent)
+		}
+	})
+
+	t.Run("no content", func(t *testing.T) {
+		route := findRoute(t, routes, "/pets/{pet_id}", "DELETE")
+		if route.Status != 204 || route.JSONContent != "" || route.ContentType != "" {
+			t.Errorf("Expected an empty 204, got %+v", route)
+		}
+	})
+
+	t.Run("non-JSON example", func(t *testing.T) {
+		route := findRoute(t, routes, "/files/{name}", "GET")
+		if route.JSONContent != "hello" || route.ContentType != "text/plain" {
+			t.Errorf("Expected the plain text example, got %+v", route)
+		}
+	})
+
+	// Every generated route passes validation
+	cfg := config.DefaultConfig()
+	cfg.Routes = routes
+	if problems := config.Validate(cfg, ""); len(problems) != 0 {
+		t.Errorf("Expected generated routes to validate, got %v", problems)
+	}
+}
+
+func TestMuxPattern(t *testing.T) {
+	tests := map[string]string{
+		"/pets":                   "/pets",
+		"/pets/{id}":              "/pets/{id}",
+		"/orgs/{org-id}/{1st}":    "/orgs/{org_id}/{_1st}",
+		"/files/{name}.{ext}":     "/files/{name}",
+		"/reports/{year}/summary": "/reports/{year}/summary",
+	}
+	for path, expected := range tests {
+		if got, _ := muxPattern(path); got != expected {
+			t.Errorf("muxPattern(%q) = %q, expected %q", path, got, expected)
+		}
+	}
+}
+
+func TestOpenAPIRoutesBasePath(t *testing.T) {
+	doc, err := LoadOpenAPI("testdata/servers.yaml")
+	if err != nil {
+		t.Fatalf("Expected spec to load, got %v", err)
+	}
+
+	// The first server wins, with its variables set to their defaults
+	if base := BasePath(doc); base != "/api/v1" {
+		t.Errorf("Expected base path /api/v1, got %q", base)
+	}
+	routes, _ := OpenAPIRoutes(doc)
+	if len(routes) != 1 || routes[0].Path != "/api/v1/orders/{id}" {
+		t.Errorf("Expected the route under the base path, got %+v", routes)
+	}
+
+	doc.Servers = openapi3.Servers{{URL: "https://example.com"}}
+	if base := BasePath(doc); base != "" {
+		t.Errorf("Expected no base path for a root server, got %q", base)
+	}
+	doc.Servers = nil
+	if base := BasePath(doc); base != "" {
+		t.Errorf("Expected no base path without servers, got %q", base)
+	}
+}
+
+func TestLoadOpenAPIInvalid(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "spec.yaml")
+	if err := os.WriteFile(file, []byte("openapi: 3.0.3\npaths: {}\n"), 0644); err != nil {
+		t.Fatalf("Failed to write spec: %v", err)
+	}
+
+	if _, err := LoadOpenAPI(file); err == nil || !strings.Contains(err.Error(), "invalid OpenAPI spec") {
+		t.Errorf("Expected invalid spec error, got %v", err)
+	}
+}
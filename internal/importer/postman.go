@@ -0,0 +1,224 @@
+package importer
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/developmeh/mock-cors-server/internal/config"
+)
+
+// postmanCollection is the part of a Postman collection (v2.0 or v2.1)
+// routes are created from
+type postmanCollection struct {
+	Info struct {
+		Name   string `json:"name"`
+		Schema string `json:"schema"`
+	} `json:"info"`
+	Item []postmanItem `json:"item"`
+}
+
+// postmanItem is a request or, when it has items of its own, a folder
+type postmanItem struct {
+	Name     string            `json:"name"`
+	Item     []postmanItem     `json:"item"`
+	Request  *postmanRequest   `json:"request"`
+	Response []postmanResponse `json:"response"`
+}
+
+// postmanRequest is a request, given as an object or a plain URL
+type postmanRequest struct {
+	Method string     `json:"method"`
+	URL    postmanURL `json:"url"`
+}
+
+// postmanURL is a URL, given as an object or a raw string
+type postmanURL struct {
+	Raw  string            `json:"raw"`
+	Path []json.RawMessage `json:"path"`
+}
+
+// postmanResponse is an example response saved with a request
+type postmanResponse struct {
+	Name            string          `json:"name"`
+	OriginalRequest *postmanRequest `json:"originalRequest"`
+	Code            int             `json:"code"`
+	Header          json.RawMessage `json:"header"`
+	Body            string          `json:"body"`
+	PreviewLanguage string          `json:"_postman_previewlanguage"`
+}
+
+// postmanHeader is a request or response header
+type postmanHeader struct {
+	Key      string `json:"key"`
+	Value    string `json:"value"`
+	Disabled bool   `json:"disabled"`
+}
+
+// UnmarshalJSON accepts a plain URL in place of a request object
+func (r *postmanRequest) UnmarshalJSON(data []byte) error {
+	var raw string
+	if json.Unmarshal(data, &raw) == nil {
+		*r = postmanRequest{Method: "GET", URL: postmanURL{Raw: raw}}
+		return nil
+	}
+	type plain postmanRequest
+	return json.Unmarshal(data, (*plain)(r))
+}
+
+// UnmarshalJSON accepts a raw string in place of a URL object
+func (u *postmanURL) UnmarshalJSON(data []byte) error {
+	var raw string
+	if json.Unmarshal(data, &raw) == nil {
+		*u = postmanURL{Raw: raw}
+		return nil
+	}
+	type plain postmanURL
+	return json.Unmarshal(data, (*plain)(u))
+}
+
+// path returns the path of a URL, from its segments when they are given
+func (u postmanURL) path() string {
+	if len(u.Path) > 0 {
+		segments := make([]string, 0, len(u.Path))
+		for _, raw := range u.Path {
+			var segment string
+			if json.Unmarshal(raw, &segment) != nil {
+				// Segments may also be objects with a value
+				var object struct {
+					Value string `json:"value"`
+				}
+				json.Unmarshal(raw, &object)
+				segment = object.Value
+			}
+			segments = append(segments, segment)
+		}
+		return "/" + strings.Join(segments, "/")
+	}
+
+	raw := u.Raw
+	// Strip a {{baseUrl}} style host variable, or the scheme and host
+	if strings.HasPrefix(raw, "{{") {
+		if end := strings.Index(raw, "}}"); end >= 0 {
+			raw = raw[end+2:]
+		}
+	} else if strings.Contains(raw, "://") {
+		if parsed, err := url.Parse(raw); err == nil {
+			raw = parsed.Path
+		}
+	}
+	raw, _, _ = strings.Cut(raw, "#")
+	raw, _, _ = strings.Cut(raw, "?")
+	return raw
+}
+
+// Postman creates a capture for every example response saved in a Postman
+// collection, keeping the first example for each method and path. Path
+// variables such as :id and {{id}} become wildcards.
+func Postman(file string) ([]Capture, []string, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var collection postmanCollection
+	if err := json.Unmarshal(data, &collection); err != nil {
+		return nil, nil, fmt.Errorf("invalid Postman collection %s: %w", file, err)
+	}
+	if !strings.Contains(collection.Info.Schema, "/v2.") {
+		return nil, nil, fmt.Errorf("%s is not a Postman collection v2.0 or v2.1", file)
+	}
+
+	var c collector
+	var warnings []string
+	var walk func(items []postmanItem, folder string)
+	walk = func(items []postmanItem, folder string) {
+		for _, item := range items {
+			name := folder + item.Name
+			if len(item.Item) > 0 {
+				walk(item.Item, name+"/")
+				continue
+			}
+			if len(item.Response) == 0 {
+				warnings = append(warnings, fmt.Sprintf("%s: no saved examples, skipped", name))
+				continue
+			}
+
+			for _, response := range item.Response {
+				request := response.OriginalRequest
+				if request == nil {
+					request = item.Request
+				}
+				if request == nil {
+					warnings = append(warnings, fmt.Sprintf("%s: example %q has no request, skipped", name, response.Name))
+					continue
+				}
+				c.add(postmanCapture(request, response))
+			}
+		}
+	}
+	walk(collection.Item, "")
+
+	return c.captures, append(warnings, c.warnings()...), nil
+}
+
+// postmanCapture converts an example response
+func postmanCapture(request *postmanRequest, response postmanResponse) Capture {
+	method := strings.ToUpper(request.Method)
+	if method == "" {
+		method = "GET"
+	}
+	status := response.Code
+	if status == 0 {
+		status = 200
+	}
+
+	route := config.Route{
+		Path:    routePath(postmanPath(request.URL.path())),
+		Methods: []string{method},
+		Status:  status,
+	}
+
+	// Headers may also be given as a single string, which carries nothing useful
+	var headers []postmanHeader
+	json.Unmarshal(response.Header, &headers)
+	for _, h := range headers {
+		if h.Disabled {
+			continue
+		}
+		if strings.EqualFold(h.Key, "Content-Type") {
+			route.ContentType = h.Value
+		}
+		setHeader(&route, h.Key, h.Value)
+	}
+	if route.ContentType == "" && response.Body != "" {
+		switch response.PreviewLanguage {
+		case "json":
+			route.ContentType = "application/json"
+		case "html":
+			route.ContentType = "text/html"
+		case "xml":
+			route.ContentType = "application/xml"
+		default:
+			route.ContentType = "text/plain"
+		}
+	}
+
+	return Capture{Route: route, Body: []byte(response.Body)}
+}
+
+// postmanPath turns Postman path variables, :id or {{id}}, into wildcards
+func postmanPath(path string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		switch {
+		case strings.HasPrefix(segment, ":") && len(segment) > 1:
+			segments[i] = "{" + identifier(segment[1:]) + "}"
+		case strings.HasPrefix(segment, "{{") && strings.HasSuffix(segment, "}}") && len(segment) > 4:
+			segments[i] = "{" + identifier(segment[2:len(segment)-2]) + "}"
+		}
+	}
+	return strings.Join(segments, "/")
+}
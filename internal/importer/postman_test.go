@@ -0,0 +1,69 @@
+package importer
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPostman(t *testing.T) {
+	captures, warnings, err := Postman("testdata/collection.json")
+	if err != nil {
+		t.Fatalf("Expected collection to load, got %v", err)
+	}
+
+	var routes []string
+	for _, c := range captures {
+		routes = append(routes, c.Route.Methods[0]+" "+c.Route.Path)
+	}
+	expected := "GET /orders/{orderId},DELETE /orders/{orderId},GET /health"
+	if strings.Join(routes, ",") != expected {
+		t.Fatalf("Expected routes %s, got %v", expected, routes)
+	}
+	if len(warnings) != 2 || !strings.Contains(warnings[0], "No examples") || !strings.Contains(warnings[1], "skipped 1 more") {
+		t.Errorf("Unexpected warnings: %v", warnings)
+	}
+
+	order := captures[0]
+	if order.Route.Status != 200 || order.Route.ContentType != "application/json" || !strings.Contains(string(order.Body), `"id": 7`) {
+		t.Errorf("Unexpected order capture: %+v %s", order.Route, order.Body)
+	}
+	// Disabled headers are left out
+	if len(order.Route.Headers) != 1 || order.Route.Headers["X-Trace"] != "t-1" {
+		t.Errorf("Expected only X-Trace, got %v", order.Route.Headers)
+	}
+
+	if captures[1].Route.Status != 204 || len(captures[1].Body) != 0 {
+		t.Errorf("Expected an empty 204, got %+v", captures[1])
+	}
+	// Plain URL requests default to GET, bodies without headers to text
+	if captures[2].Route.ContentType != "text/plain" || string(captures[2].Body) != "ok" {
+		t.Errorf("Unexpected health capture: %+v %s", captures[2].Route, captures[2].Body)
+	}
+}
+
+func TestPostmanRejectsOtherFiles(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "openapi.json")
+	if err := os.WriteFile(file, []byte(`{"openapi": "3.0.3"}`), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	if _, _, err := Postman(file); err == nil || !strings.Contains(err.Error(), "not a Postman collection") {
+		t.Errorf("Expected a collection version error, got %v", err)
+	}
+}
+
+func TestPostmanPath(t *testing.T) {
+	tests := map[string]string{
+		"/orders/:orderId":      "/orders/{orderId}",
+		"/orders/{{order-id}}":  "/orders/{order_id}",
+		"/static/path":          "/static/path",
+		"/users/:id/items/:sku": "/users/{id}/items/{sku}",
+	}
+	for path, expected := range tests {
+		if got := postmanPath(path); got != expected {
+			t.Errorf("postmanPath(%q) = %q, expected %q", path, got, expected)
+		}
+	}
+}
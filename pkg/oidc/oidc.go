@@ -0,0 +1,671 @@
+package oidc
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/developmeh/mock-cors-server/internal/config"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	defaultAccessTokenTTL  = 3600
+	defaultRefreshTokenTTL = 86400
+	authorizationCodeTTL   = 60
+)
+
+// Provider is an in-memory OAuth2 / OpenID Connect identity provider
+type Provider struct {
+	config config.OIDCConfig
+	issuer string
+	key    *rsa.PrivateKey
+	keyID  string
+
+	mu            sync.Mutex
+	codes         map[string]*authorizationCode
+	refreshTokens map[string]*refreshToken
+}
+
+// authorizationCode is a pending code issued by the authorize endpoint
+type authorizationCode struct {
+	clientID      string
+	redirectURI   string
+	subject       string
+	scope         string
+	nonce         string
+	challenge     string
+	challengeMode string
+	expiresAt     time.Time
+}
+
+// refreshToken is an outstanding refresh token
+type refreshToken struct {
+	clientID  string
+	subject   string
+	scope     string
+	expiresAt time.Time
+}
+
+// tokenError is an OAuth2 error response (RFC 6749 section 5.2)
+type tokenError struct {
+	status      int
+	Code        string `json:"error"`
+	Description string `json:"error_description,omitempty"`
+}
+
+func (e *tokenError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Code, e.Description)
+}
+
+// New creates a provider from configuration. When no issuer is configured it
+// defaults to http://localhost:<port><path_prefix>.
+func New(cfg config.OIDCConfig, port int) (*Provider, error) {
+	cfg.PathPrefix = strings.TrimSuffix(cfg.PathPrefix, "/")
+	if cfg.AccessTokenTTL <= 0 {
+		cfg.AccessTokenTTL = defaultAccessTokenTTL
+	}
+	if cfg.RefreshTokenTTL <= 0 {
+		cfg.RefreshTokenTTL = defaultRefreshTokenTTL
+	}
+	if len(cfg.Users) == 0 {
+		cfg.Users = []config.OIDCUser{
+			{
+				Subject:  "user-1",
+				Username: "testuser",
+				Claims: map[string]interface{}{
+					"name":           "Test User",
+					"email":          "testuser@example.com",
+					"email_verified": true,
+				},
+			},
+		}
+	}
+
+	issuer := strings.TrimSuffix(cfg.Issuer, "/")
+	if issuer == "" {
+		issuer = fmt.Sprintf("http://localhost:%d%s", port, cfg.PathPrefix)
+	}
+
+	key, err := loadSigningKey(cfg.SigningKeyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Provider{
+		config:        cfg,
+		issuer:        issuer,
+		key:           key,
+		keyID:         keyID(&key.PublicKey),
+		codes:         make(map[string]*authorizationCode),
+		refreshTokens: make(map[string]*refreshToken),
+	}, nil
+}
+
+// loadSigningKey reads a PEM encoded RSA private key, or generates one when no file is given
+func loadSigningKey(path string) (*rsa.PrivateKey, error) {
+	if path == "" {
+		return rsa.GenerateKey(rand.Reader, 2048)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading signing key: %w", err)
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data found in %s", path)
+	}
+
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse signing key: %w", err)
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("signing key in %s is not an RSA key", path)
+	}
+	return key, nil
+}
+
+// keyID derives a stable key ID from the public key
+func keyID(key *rsa.PublicKey) string {
+	sum := sha256.Sum256(x509.MarshalPKCS1PublicKey(key))
+	return hex.EncodeToString(sum[:8])
+}
+
+// Issuer returns the issuer identifier used in tokens and discovery
+func (p *Provider) Issuer() string {
+	return p.issuer
+}
+
+// PublicKey returns the key used to verify tokens issued by the provider
+func (p *Provider) PublicKey() *rsa.PublicKey {
+	return &p.key.PublicKey
+}
+
+// Routes returns the provider endpoints keyed by path
+func (p *Provider) Routes() map[string]http.HandlerFunc {
+	prefix := p.config.PathPrefix
+	return map[string]http.HandlerFunc{
+		prefix + "/.well-known/openid-configuration": p.handleDiscovery,
+		prefix + "/authorize":                        p.handleAuthorize,
+		prefix + "/token":                            p.handleToken,
+		prefix + "/userinfo":                         p.handleUserInfo,
+		prefix + "/jwks.json":                        p.handleJWKS,
+	}
+}
+
+// handleDiscovery serves the OpenID Provider metadata document
+func (p *Provider) handleDiscovery(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"issuer":                                p.issuer,
+		"authorization_endpoint":                p.issuer + "/authorize",
+		"token_endpoint":                        p.issuer + "/token",
+		"userinfo_endpoint":                     p.issuer + "/userinfo",
+		"jwks_uri":                              p.issuer + "/jwks.json",
+		"response_types_supported":              []string{"code"},
+		"grant_types_supported":                 []string{"authorization_code", "client_credentials", "refresh_token"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"scopes_supported":                      []string{"openid", "profile", "email", "offline_access"},
+		"token_endpoint_auth_methods_supported": []string{"client_secret_basic", "client_secret_post", "none"},
+		"code_challenge_methods_supported":      []string{"plain", "S256"},
+		"claims_supported":                      p.claimsSupported(),
+	})
+}
+
+// claimsSupported lists the standard claims plus every configured user claim
+func (p *Provider) claimsSupported() []string {
+	claims := []string{"sub", "iss", "aud", "exp", "iat", "nonce"}
+	seen := make(map[string]bool)
+	for _, c := range claims {
+		seen[c] = true
+	}
+	for _, user := range p.config.Users {
+		for name := range user.Claims {
+			if !seen[name] {
+				seen[name] = true
+				claims = append(claims, name)
+			}
+		}
+	}
+	return claims
+}
+
+// handleJWKS serves the public signing key as a JSON Web Key Set
+func (p *Provider) handleJWKS(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	pub := p.key.PublicKey
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"keys": []map[string]string{
+			{
+				"kty": "RSA",
+				"use": "sig",
+				"alg": "RS256",
+				"kid": p.keyID,
+				"n":   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+			},
+		},
+	})
+}
+
+// handleAuthorize implements the authorization code flow. Every request is
+// approved immediately for the user selected by login_hint (or the first
+// configured user), so no login page is involved.
+func (p *Provider) handleAuthorize(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	// Errors about the client or redirect URI must not redirect (RFC 6749 section 4.1.2.1)
+	client := p.findClient(r.Form.Get("client_id"))
+	if client == nil {
+		writeJSON(w, http.StatusBadRequest, &tokenError{Code: "invalid_client", Description: "unknown client_id"})
+		return
+	}
+	redirectURI := r.Form.Get("redirect_uri")
+	if !validRedirectURI(client, redirectURI) {
+		writeJSON(w, http.StatusBadRequest, &tokenError{Code: "invalid_request", Description: "redirect_uri is not registered for this client"})
+		return
+	}
+	target, err := url.Parse(redirectURI)
+	if err != nil || !target.IsAbs() {
+		writeJSON(w, http.StatusBadRequest, &tokenError{Code: "invalid_request", Description: "redirect_uri must be an absolute URL"})
+		return
+	}
+
+	state := r.Form.Get("state")
+	redirectError := func(code, description string) {
+		query := target.Query()
+		query.Set("error", code)
+		query.Set("error_description", description)
+		if state != "" {
+			query.Set("state", state)
+		}
+		target.RawQuery = query.Encode()
+		http.Redirect(w, r, target.String(), http.StatusFound)
+	}
+
+	if r.Form.Get("response_type") != "code" {
+		redirectError("unsupported_response_type", "only the code response type is supported")
+		return
+	}
+
+	challengeMode := r.Form.Get("code_challenge_method")
+	if challengeMode == "" {
+		challengeMode = "plain"
+	}
+	if challengeMode != "plain" && challengeMode != "S256" {
+		redirectError("invalid_request", "unsupported code_challenge_method")
+		return
+	}
+
+	user := p.findUser(r.Form.Get("login_hint"))
+	if user == nil {
+		redirectError("access_denied", "no user matches login_hint")
+		return
+	}
+
+	code := randomToken()
+	p.mu.Lock()
+	p.codes[code] = &authorizationCode{
+		clientID:      client.ClientID,
+		redirectURI:   redirectURI,
+		subject:       user.Subject,
+		scope:         r.Form.Get("scope"),
+		nonce:         r.Form.Get("nonce"),
+		challenge:     r.Form.Get("code_challenge"),
+		challengeMode: challengeMode,
+		expiresAt:     time.Now().Add(authorizationCodeTTL * time.Second),
+	}
+	p.mu.Unlock()
+
+	query := target.Query()
+	query.Set("code", code)
+	if state != "" {
+		query.Set("state", state)
+	}
+	target.RawQuery = query.Encode()
+	http.Redirect(w, r, target.String(), http.StatusFound)
+}
+
+// handleToken exchanges grants for tokens
+func (p *Provider) handleToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		writeJSON(w, http.StatusBadRequest, &tokenError{Code: "invalid_request", Description: "unable to parse form"})
+		return
+	}
+
+	var (
+		response map[string]interface{}
+		err      error
+	)
+	client, err := p.authenticateClient(r)
+	if err == nil {
+		switch grantType := r.PostForm.Get("grant_type"); grantType {
+		case "authorization_code":
+			response, err = p.exchangeCode(client, r)
+		case "client_credentials":
+			response, err = p.clientCredentials(client, r)
+		case "refresh_token":
+			response, err = p.refresh(client, r)
+		default:
+			err = &tokenError{Code: "unsupported_grant_type", Description: fmt.Sprintf("grant_type %q is not supported", grantType)}
+		}
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+
+	var te *tokenError
+	if errors.As(err, &te) {
+		status := te.status
+		if status == 0 {
+			status = http.StatusBadRequest
+		}
+		if status == http.StatusUnauthorized {
+			w.Header().Set("WWW-Authenticate", `Basic realm="token"`)
+		}
+		writeJSON(w, status, te)
+		return
+	}
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, &tokenError{Code: "server_error", Description: err.Error()})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+// authenticateClient identifies the client via HTTP Basic or form parameters
+func (p *Provider) authenticateClient(r *http.Request) (*config.OIDCClient, error) {
+	clientID, secret, basic := r.BasicAuth()
+	if basic {
+		// Basic credentials are form-urlencoded (RFC 6749 section 2.3.1)
+		if id, err := url.QueryUnescape(clientID); err == nil {
+			clientID = id
+		}
+		if s, err := url.QueryUnescape(secret); err == nil {
+			secret = s
+		}
+	} else {
+		clientID = r.PostForm.Get("client_id")
+		secret = r.PostForm.Get("client_secret")
+	}
+
+	client := p.findClient(clientID)
+	if client == nil {
+		return nil, &tokenError{status: http.StatusUnauthorized, Code: "invalid_client", Description: "unknown client"}
+	}
+	if client.ClientSecret != "" && subtle.ConstantTimeCompare([]byte(client.ClientSecret), []byte(secret)) != 1 {
+		return nil, &tokenError{status: http.StatusUnauthorized, Code: "invalid_client", Description: "client authentication failed"}
+	}
+	return client, nil
+}
+
+// exchangeCode redeems an authorization code, verifying PKCE when a challenge was sent
+func (p *Provider) exchangeCode(client *config.OIDCClient, r *http.Request) (map[string]interface{}, error) {
+	code := r.PostForm.Get("code")
+
+	p.mu.Lock()
+	grant, ok := p.codes[code]
+	delete(p.codes, code) // Codes are single use
+	p.mu.Unlock()
+
+	if !ok || time.Now().After(grant.expiresAt) {
+		return nil, &tokenError{Code: "invalid_grant", Description: "authorization code is invalid or expired"}
+	}
+	if grant.clientID != client.ClientID {
+		return nil, &tokenError{Code: "invalid_grant", Description: "authorization code was issued to another client"}
+	}
+	if grant.redirectURI != r.PostForm.Get("redirect_uri") {
+		return nil, &tokenError{Code: "invalid_grant", Description: "redirect_uri does not match the authorization request"}
+	}
+	if grant.challenge != "" && !verifyPKCE(grant.challenge, grant.challengeMode, r.PostForm.Get("code_verifier")) {
+		return nil, &tokenError{Code: "invalid_grant", Description: "code_verifier does not match code_challenge"}
+	}
+	if grant.challenge == "" && client.ClientSecret == "" {
+		return nil, &tokenError{Code: "invalid_request", Description: "public clients must use PKCE"}
+	}
+
+	return p.issueTokens(client.ClientID, grant.subject, grant.scope, grant.nonce)
+}
+
+// clientCredentials issues an access token on behalf of a confidential client
+func (p *Provider) clientCredentials(client *config.OIDCClient, r *http.Request) (map[string]interface{}, error) {
+	if client.ClientSecret == "" {
+		return nil, &tokenError{Code: "unauthorized_client", Description: "public clients cannot use client_credentials"}
+	}
+
+	scope := r.PostForm.Get("scope")
+	accessToken, err := p.sign(p.accessTokenClaims(client.ClientID, client.ClientID, scope))
+	if err != nil {
+		return nil, err
+	}
+
+	response := map[string]interface{}{
+		"access_token": accessToken,
+		"token_type":   "Bearer",
+		"expires_in":   p.config.AccessTokenTTL,
+	}
+	if scope != "" {
+		response["scope"] = scope
+	}
+	return response, nil
+}
+
+// refresh rotates a refresh token and issues new tokens
+func (p *Provider) refresh(client *config.OIDCClient, r *http.Request) (map[string]interface{}, error) {
+	token := r.PostForm.Get("refresh_token")
+
+	p.mu.Lock()
+	grant, ok := p.refreshTokens[token]
+	delete(p.refreshTokens, token)
+	p.mu.Unlock()
+
+	if !ok || time.Now().After(grant.expiresAt) {
+		return nil, &tokenError{Code: "invalid_grant", Description: "refresh token is invalid or expired"}
+	}
+	if grant.clientID != client.ClientID {
+		return nil, &tokenError{Code: "invalid_grant", Description: "refresh token was issued to another client"}
+	}
+
+	return p.issueTokens(client.ClientID, grant.subject, grant.scope, "")
+}
+
+// issueTokens creates an access token, a refresh token and, for openid scopes, an ID token
+func (p *Provider) issueTokens(clientID, subject, scope, nonce string) (map[string]interface{}, error) {
+	accessToken, err := p.sign(p.accessTokenClaims(clientID, subject, scope))
+	if err != nil {
+		return nil, err
+	}
+
+	refresh := randomToken()
+	p.mu.Lock()
+	p.refreshTokens[refresh] = &refreshToken{
+		clientID:  clientID,
+		subject:   subject,
+		scope:     scope,
+		expiresAt: time.Now().Add(time.Duration(p.config.RefreshTokenTTL) * time.Second),
+	}
+	p.mu.Unlock()
+
+	response := map[string]interface{}{
+		"access_token":  accessToken,
+		"token_type":    "Bearer",
+		"expires_in":    p.config.AccessTokenTTL,
+		"refresh_token": refresh,
+	}
+	if scope != "" {
+		response["scope"] = scope
+	}
+
+	if hasScope(scope, "openid") {
+		claims := p.baseClaims(subject, clientID)
+		if nonce != "" {
+			claims["nonce"] = nonce
+		}
+		if user := p.findUserBySubject(subject); user != nil {
+			for name, value := range user.Claims {
+				if _, reserved := claims[name]; !reserved {
+					claims[name] = value
+				}
+			}
+		}
+		idToken, err := p.sign(claims)
+		if err != nil {
+			return nil, err
+		}
+		response["id_token"] = idToken
+	}
+
+	return response, nil
+}
+
+// baseClaims returns the registered claims shared by every token
+func (p *Provider) baseClaims(subject, audience string) jwt.MapClaims {
+	now := time.Now()
+	return jwt.MapClaims{
+		"iss": p.issuer,
+		"sub": subject,
+		"aud": audience,
+		"iat": now.Unix(),
+		"exp": now.Add(time.Duration(p.config.AccessTokenTTL) * time.Second).Unix(),
+	}
+}
+
+// accessTokenClaims returns the claims of an access token
+func (p *Provider) accessTokenClaims(clientID, subject, scope string) jwt.MapClaims {
+	claims := p.baseClaims(subject, clientID)
+	claims["client_id"] = clientID
+	claims["jti"] = randomToken()
+	if scope != "" {
+		claims["scope"] = scope
+	}
+	return claims
+}
+
+// sign serializes claims as an RS256 JWT
+func (p *Provider) sign(claims jwt.MapClaims) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = p.keyID
+	return token.SignedString(p.key)
+}
+
+// handleUserInfo returns the claims of the user an access token was issued for
+func (p *Provider) handleUserInfo(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	raw, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="userinfo"`)
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	token, err := jwt.Parse(raw, func(*jwt.Token) (interface{}, error) {
+		return &p.key.PublicKey, nil
+	}, jwt.WithValidMethods([]string{"RS256"}), jwt.WithIssuer(p.issuer))
+	if err != nil {
+		w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="userinfo", error="invalid_token", error_description=%q`, err.Error()))
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	subject, _ := token.Claims.GetSubject()
+	info := map[string]interface{}{"sub": subject}
+	if user := p.findUserBySubject(subject); user != nil {
+		for name, value := range user.Claims {
+			info[name] = value
+		}
+	}
+	writeJSON(w, http.StatusOK, info)
+}
+
+// findClient looks up a registered client by ID
+func (p *Provider) findClient(clientID string) *config.OIDCClient {
+	for i := range p.config.Clients {
+		if p.config.Clients[i].ClientID == clientID {
+			return &p.config.Clients[i]
+		}
+	}
+	return nil
+}
+
+// findUser selects the user matching a login hint, or the first user when no hint is given
+func (p *Provider) findUser(hint string) *config.OIDCUser {
+	if hint == "" {
+		return &p.config.Users[0]
+	}
+	for i := range p.config.Users {
+		if p.config.Users[i].Username == hint || p.config.Users[i].Subject == hint {
+			return &p.config.Users[i]
+		}
+	}
+	return nil
+}
+
+// findUserBySubject looks up a user by subject identifier
+func (p *Provider) findUserBySubject(subject string) *config.OIDCUser {
+	for i := range p.config.Users {
+		if p.config.Users[i].Subject == subject {
+			return &p.config.Users[i]
+		}
+	}
+	return nil
+}
+
+// validRedirectURI checks a redirect URI against the client's registered URIs
+func validRedirectURI(client *config.OIDCClient, redirectURI string) bool {
+	if redirectURI == "" {
+		return false
+	}
+	if len(client.RedirectURIs) == 0 {
+		return true
+	}
+	for _, uri := range client.RedirectURIs {
+		if uri == redirectURI {
+			return true
+		}
+	}
+	return false
+}
+
+// verifyPKCE checks a code verifier against the stored challenge (RFC 7636)
+func verifyPKCE(challenge, method, verifier string) bool {
+	if verifier == "" {
+		return false
+	}
+	expected := verifier
+	if method == "S256" {
+		sum := sha256.Sum256([]byte(verifier))
+		expected = base64.RawURLEncoding.EncodeToString(sum[:])
+	}
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(challenge)) == 1
+}
+
+// hasScope checks whether a space separated scope list contains a scope
+func hasScope(scope, want string) bool {
+	for _, s := range strings.Fields(scope) {
+		if s == want {
+			return true
+		}
+	}
+	return false
+}
+
+// randomToken returns an opaque random token
+func randomToken() string {
+	b := make([]byte, 24)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// writeJSON encodes a value as a JSON response
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,204 @@
+package oidc
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/developmeh/mock-cors-server/internal/config"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func newTestProvider(t *testing.T) *Provider {
+	t.Helper()
+
+	provider, err := New(config.OIDCConfig{
+		Enabled: true,
+		Clients: []config.OIDCClient{
+			{ClientID: "spa", RedirectURIs: []string{"http://localhost:3000/callback"}},
+			{ClientID: "backend", ClientSecret: "s3cret"},
+		},
+		Users: []config.OIDCUser{
+			{Subject: "alice-id", Username: "alice", Claims: map[string]interface{}{"email": "alice@example.com"}},
+			{Subject: "bob-id", Username: "bob", Claims: map[string]interface{}{"email": "bob@example.com"}},
+		},
+	}, 8081)
+	if err != nil {
+		t.Fatalf("Failed to create provider: %v", err)
+	}
+	return provider
+}
+
+func postToken(p *Provider, form url.Values, user, pass string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/token", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if user != "" {
+		req.SetBasicAuth(user, pass)
+	}
+	w := httptest.NewRecorder()
+	p.handleToken(w, req)
+	return w
+}
+
+func TestDiscovery(t *testing.T) {
+	p := newTestProvider(t)
+
+	req := httptest.NewRequest(http.MethodGet, "/.well-known/openid-configuration", nil)
+	w := httptest.NewRecorder()
+	p.Routes()["/.well-known/openid-configuration"](w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+
+	var doc map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &doc); err != nil {
+		t.Fatalf("Expected valid JSON, got error: %v", err)
+	}
+	if doc["issuer"] != "http://localhost:8081" {
+		t.Errorf("Expected issuer http://localhost:8081, got %v", doc["issuer"])
+	}
+	if doc["token_endpoint"] != "http://localhost:8081/token" {
+		t.Errorf("Expected token endpoint under issuer, got %v", doc["token_endpoint"])
+	}
+}
+
+func TestAuthorizationCodeWithPKCE(t *testing.T) {
+	p := newTestProvider(t)
+
+	verifier := "a-very-long-code-verifier-used-only-for-testing-pkce"
+	sum := sha256.Sum256([]byte(verifier))
+	challenge := base64.RawURLEncoding.EncodeToString(sum[:])
+
+	query := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {"spa"},
+		"redirect_uri":          {"http://localhost:3000/callback"},
+		"scope":                 {"openid email"},
+		"state":                 {"xyz"},
+		"nonce":                 {"n-0S6"},
+		"login_hint":            {"bob"},
+		"code_challenge":        {challenge},
+		"code_challenge_method": {"S256"},
+	}
+	req := httptest.NewRequest(http.MethodGet, "/authorize?"+query.Encode(), nil)
+	w := httptest.NewRecorder()
+	p.handleAuthorize(w, req)
+
+	if w.Code != http.StatusFound {
+		t.Fatalf("Expected status 302, got %d: %s", w.Code, w.Body.String())
+	}
+	location, err := url.Parse(w.Header().Get("Location"))
+	if err != nil {
+		t.Fatalf("Invalid redirect location: %v", err)
+	}
+	if location.Query().Get("state") != "xyz" {
+		t.Errorf("Expected state xyz, got %s", location.Query().Get("state"))
+	}
+	code := location.Query().Get("code")
+
+	// A wrong verifier is rejected and burns the code
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"client_id":     {"spa"},
+		"code":          {code},
+		"redirect_uri":  {"http://localhost:3000/callback"},
+		"code_verifier": {"wrong"},
+	}
+	if w := postToken(p, form, "", ""); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for wrong verifier, got %d", w.Code)
+	}
+
+	// Start over with the correct verifier
+	w = httptest.NewRecorder()
+	p.handleAuthorize(w, httptest.NewRequest(http.MethodGet, "/authorize?"+query.Encode(), nil))
+	location, _ = url.Parse(w.Header().Get("Location"))
+	form.Set("code", location.Query().Get("code"))
+	form.Set("code_verifier", verifier)
+
+	w = postToken(p, form, "", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var tokens map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &tokens)
+
+	idToken, err := jwt.Parse(tokens["id_token"].(string), func(*jwt.Token) (interface{}, error) {
+		return p.PublicKey(), nil
+	})
+	if err != nil {
+		t.Fatalf("Expected valid ID token, got error: %v", err)
+	}
+	claims := idToken.Claims.(jwt.MapClaims)
+	if claims["sub"] != "bob-id" || claims["nonce"] != "n-0S6" || claims["email"] != "bob@example.com" {
+		t.Errorf("Unexpected ID token claims: %v", claims)
+	}
+
+	// The access token works against userinfo
+	req = httptest.NewRequest(http.MethodGet, "/userinfo", nil)
+	req.Header.Set("Authorization", "Bearer "+tokens["access_token"].(string))
+	w = httptest.NewRecorder()
+	p.handleUserInfo(w, req)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "bob@example.com") {
+		t.Errorf("Expected userinfo for bob, got %d: %s", w.Code, w.Body.String())
+	}
+
+	// Refresh tokens rotate
+	refresh := url.Values{
+		"grant_type":    {"refresh_token"},
+		"client_id":     {"spa"},
+		"refresh_token": {tokens["refresh_token"].(string)},
+	}
+	if w := postToken(p, refresh, "", ""); w.Code != http.StatusOK {
+		t.Errorf("Expected refresh to succeed, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := postToken(p, refresh, "", ""); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected reused refresh token to fail, got %d", w.Code)
+	}
+}
+
+func TestClientCredentials(t *testing.T) {
+	p := newTestProvider(t)
+
+	form := url.Values{"grant_type": {"client_credentials"}, "scope": {"read"}}
+
+	if w := postToken(p, form, "backend", "wrong"); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status 401 for bad secret, got %d", w.Code)
+	}
+
+	w := postToken(p, form, "backend", "s3cret")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if w.Header().Get("Cache-Control") != "no-store" {
+		t.Error("Expected token response to be marked no-store")
+	}
+	if strings.Contains(w.Body.String(), "refresh_token") {
+		t.Error("Expected no refresh token for client credentials")
+	}
+}
+
+func TestAuthorizeRejectsUnregisteredRedirect(t *testing.T) {
+	p := newTestProvider(t)
+
+	query := url.Values{
+		"response_type": {"code"},
+		"client_id":     {"spa"},
+		"redirect_uri":  {"https://evil.example.com/callback"},
+	}
+	w := httptest.NewRecorder()
+	p.handleAuthorize(w, httptest.NewRequest(http.MethodGet, "/authorize?"+query.Encode(), nil))
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400, got %d", w.Code)
+	}
+	if w.Header().Get("Location") != "" {
+		t.Error("Expected no redirect for an unregistered redirect_uri")
+	}
+}
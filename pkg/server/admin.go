@@ -0,0 +1,67 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/developmeh/mock-cors-server/internal/config"
+)
+
+// setupAdmin mounts the admin endpoints under config.AdminPrefix
+func (s *Server) setupAdmin() {
+	s.mux.HandleFunc(config.AdminPrefix+"har", s.handleHARExport)
+	s.mux.HandleFunc(config.AdminPrefix+"triggers/", s.handleTrigger)
+}
+
+// handleHARExport downloads the recorded traffic as a HAR file on GET, and
+// clears it on DELETE
+func (s *Server) handleHARExport(w http.ResponseWriter, r *http.Request) {
+	// The admin endpoints use the global CORS settings
+	s.setCORSHeaders(w, r, nil)
+
+	switch r.Method {
+	case http.MethodOptions:
+		w.WriteHeader(http.StatusOK)
+	case http.MethodGet, http.MethodHead:
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Disposition", `attachment; filename="mock-cors-server.har"`)
+		s.recorder.archive().Encode(w)
+	case http.MethodDelete:
+		s.recorder.reset()
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.Header().Set("Allow", "GET, HEAD, DELETE, OPTIONS")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleTrigger releases the requests held by long_poll routes waiting on
+// the trigger named by the path. A posted body becomes their response.
+func (s *Server) handleTrigger(w http.ResponseWriter, r *http.Request) {
+	s.setCORSHeaders(w, r, nil)
+
+	switch r.Method {
+	case http.MethodOptions:
+		w.WriteHeader(http.StatusOK)
+	case http.MethodPost:
+		name := strings.TrimPrefix(r.URL.Path, config.AdminPrefix+"triggers/")
+		if name == "" || strings.Contains(name, "/") {
+			http.Error(w, "Trigger not found", http.StatusNotFound)
+			return
+		}
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, "Failed to read body", http.StatusBadRequest)
+			return
+		}
+
+		released := s.triggers.fire(name, triggerEvent{body: body, contentType: r.Header.Get("Content-Type")})
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"trigger": name, "released": released})
+	default:
+		w.Header().Set("Allow", "POST, OPTIONS")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,98 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/developmeh/mock-cors-server/internal/config"
+	"github.com/developmeh/mock-cors-server/internal/har"
+)
+
+func TestHandleHARExport(t *testing.T) {
+	cfg := config.DefaultConfig()
+	server := New(cfg)
+	if err := server.setupRoutes(); err != nil {
+		t.Fatalf("Expected routes to be set up, got %v", err)
+	}
+	server.setupAdmin()
+	handler := server.recorder.middleware(server.mux)
+
+	serve := func(method, path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+		return w
+	}
+
+	serve(http.MethodOptions, "/v1/json/begin")
+	serve(http.MethodPost, "/v1/json/begin")
+
+	w := serve(http.MethodGet, "/__admin/har")
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "application/json" {
+		t.Fatalf("Expected a JSON download, got %d %v", w.Code, w.Header())
+	}
+	archive, err := har.Decode(w.Body)
+	if err != nil {
+		t.Fatalf("Expected a valid HAR document, got %v", err)
+	}
+	// Preflights are recorded like any other request
+	if archive.Log.Version != "1.2" || len(archive.Log.Entries) != 2 || archive.Log.Entries[0].Request.Method != http.MethodOptions {
+		t.Errorf("Unexpected archive: %+v", archive.Log)
+	}
+
+	if w := serve(http.MethodDelete, "/__admin/har"); w.Code != http.StatusNoContent {
+		t.Errorf("Expected 204 on delete, got %d", w.Code)
+	}
+	if entries := server.recorder.archive().Log.Entries; len(entries) != 0 {
+		t.Errorf("Expected no entries after delete, got %d", len(entries))
+	}
+
+	if w := serve(http.MethodPut, "/__admin/har"); w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected 405, got %d", w.Code)
+	}
+}
+
+func TestSetupRoutesRejectsAdminPaths(t *testing.T) {
+	for _, path := range []string{"/__admin/har", "/__admin/triggers/", "/__admin/other"} {
+		cfg := config.DefaultConfig()
+		cfg.Routes = []config.Route{{Path: path, Type: "dummy"}}
+
+		server := New(cfg)
+		err := server.setupRoutes()
+		if err == nil || !strings.Contains(err.Error(), "reserved for the admin endpoints") {
+			t.Errorf("%s: expected reserved path error, got %v", path, err)
+		}
+	}
+}
+
+func TestHandleTrigger(t *testing.T) {
+	server := New(config.DefaultConfig())
+	server.setupAdmin()
+
+	tests := []struct {
+		method         string
+		path           string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{method: http.MethodPost, path: "/__admin/triggers/orders", expectedStatus: http.StatusOK, expectedBody: `{"released":0,"trigger":"orders"}`},
+		{method: http.MethodOptions, path: "/__admin/triggers/orders", expectedStatus: http.StatusOK},
+		{method: http.MethodGet, path: "/__admin/triggers/orders", expectedStatus: http.StatusMethodNotAllowed},
+		{method: http.MethodPost, path: "/__admin/triggers/", expectedStatus: http.StatusNotFound},
+		{method: http.MethodPost, path: "/__admin/triggers/a/b", expectedStatus: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			server.mux.ServeHTTP(w, httptest.NewRequest(tt.method, tt.path, nil))
+			if w.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+			if tt.expectedBody != "" && strings.TrimSpace(w.Body.String()) != tt.expectedBody {
+				t.Errorf("Expected body %s, got %s", tt.expectedBody, w.Body.String())
+			}
+		})
+	}
+}
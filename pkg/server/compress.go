@@ -0,0 +1,382 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+
+	"github.com/developmeh/mock-cors-server/internal/config"
+)
+
+// precompressedExtensions maps encodings to the extension of precompressed
+// siblings of static files
+var precompressedExtensions = map[string]string{
+	"br":   ".br",
+	"zstd": ".zst",
+	"gzip": ".gz",
+}
+
+// compressor negotiates the content encoding of the responses of a route
+type compressor struct {
+	enabled       bool
+	minSize       int
+	encodings     []string // Offered encodings, in order of preference
+	precompressed bool
+}
+
+// newCompressor prepares the compression settings of a route; it returns
+// nil when the route compresses nothing
+func newCompressor(cfg config.CompressionConfig) *compressor {
+	if !cfg.Enabled && !cfg.Precompressed {
+		return nil
+	}
+	encodings := make([]string, 0, len(cfg.Encodings))
+	for _, encoding := range cfg.Encodings {
+		encodings = append(encodings, strings.ToLower(encoding))
+	}
+	return &compressor{
+		enabled:       cfg.Enabled,
+		minSize:       cfg.MinSize,
+		encodings:     encodings,
+		precompressed: cfg.Precompressed,
+	}
+}
+
+// precompressedContextKey is the context key holding the compressor of a
+// route serving precompressed files
+type precompressedContextKey struct{}
+
+// wrap returns a writer compressing the response, and the request carrying
+// the compressor for precompressed static files
+func (c *compressor) wrap(w http.ResponseWriter, r *http.Request) (*compressWriter, *http.Request) {
+	if c.precompressed {
+		r = r.WithContext(context.WithValue(r.Context(), precompressedContextKey{}, c))
+	}
+	cw := &compressWriter{ResponseWriter: w, minSize: c.minSize, head: r.Method == http.MethodHead, vary: c.enabled}
+	if c.enabled {
+		cw.encoding = negotiateEncoding(r.Header.Get("Accept-Encoding"), c.encodings)
+	}
+	return cw, r
+}
+
+// precompressedFile returns the precompressed sibling of a file in the best
+// encoding the client accepts, when the route serves them
+func precompressedFile(w http.ResponseWriter, r *http.Request, filePath string) (string, string, os.FileInfo, bool) {
+	c, _ := r.Context().Value(precompressedContextKey{}).(*compressor)
+	if c == nil {
+		return "", "", nil, false
+	}
+
+	var available []string
+	infos := make(map[string]os.FileInfo)
+	for _, encoding := range c.encodings {
+		ext, ok := precompressedExtensions[encoding]
+		if !ok {
+			continue
+		}
+		if info, err := os.Stat(filePath + ext); err == nil && info.Mode().IsRegular() {
+			available = append(available, encoding)
+			infos[encoding] = info
+		}
+	}
+
+	if len(available) > 0 {
+		addVary(w.Header(), "Accept-Encoding")
+	}
+	encoding := negotiateEncoding(r.Header.Get("Accept-Encoding"), available)
+	if encoding == "" {
+		return "", "", nil, false
+	}
+	return filePath + precompressedExtensions[encoding], encoding, infos[encoding], true
+}
+
+// negotiateEncoding picks the offered encoding with the highest quality in
+// an Accept-Encoding header, preferring earlier offers on ties. It returns
+// an empty string when the response should not be encoded.
+func negotiateEncoding(acceptEncoding string, offered []string) string {
+	if acceptEncoding == "" || len(offered) == 0 {
+		return ""
+	}
+
+	qualities := make(map[string]float64)
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		coding = strings.ToLower(strings.TrimSpace(coding))
+		if coding == "" {
+			continue
+		}
+		q := 1.0
+		if name, value, ok := strings.Cut(strings.TrimSpace(params), "="); ok && strings.EqualFold(strings.TrimSpace(name), "q") {
+			if parsed, err := strconv.ParseFloat(strings.TrimSpace(value), 64); err == nil {
+				q = parsed
+			}
+		}
+		qualities[coding] = q
+	}
+
+	best, bestQ := "", 0.0
+	for _, encoding := range offered {
+		q, ok := qualities[encoding]
+		if !ok {
+			q, ok = qualities["*"]
+		}
+		if ok && q > bestQ {
+			best, bestQ = encoding, q
+		}
+	}
+	return best
+}
+
+// compressWriter compresses a response in the negotiated encoding. The start
+// of the body is buffered until min_size bytes decide whether compressing is
+// worth it; responses that end earlier are sent as is.
+type compressWriter struct {
+	http.ResponseWriter
+	encoding string // Negotiated encoding, empty for none
+	minSize  int
+	head     bool
+	vary     bool // Responses depend on Accept-Encoding
+
+	status   int
+	buf      []byte
+	decided  bool
+	encoder  io.WriteCloser
+	hijacked bool
+}
+
+// WriteHeader holds the status back until the encoding is decided, except
+// for responses that have no body to compress
+func (cw *compressWriter) WriteHeader(code int) {
+	if cw.decided || cw.status != 0 {
+		return
+	}
+	if code < http.StatusOK {
+		cw.ResponseWriter.WriteHeader(code)
+		return
+	}
+	cw.status = code
+	if code == http.StatusNoContent || code == http.StatusNotModified || code == http.StatusPartialContent {
+		cw.decide(false)
+	}
+}
+
+// Write buffers the body until the encoding is decided
+func (cw *compressWriter) Write(b []byte) (int, error) {
+	if !cw.decided {
+		if cw.status == 0 {
+			cw.status = http.StatusOK
+		}
+		cw.buf = append(cw.buf, b...)
+		if len(cw.buf) >= cw.minSize {
+			if err := cw.decide(true); err != nil {
+				return 0, err
+			}
+		}
+		return len(b), nil
+	}
+	if cw.encoder != nil {
+		return cw.encoder.Write(b)
+	}
+	return cw.ResponseWriter.Write(b)
+}
+
+// Flush decides the encoding of a streamed response, compressing it as long
+// as the client accepts it, and flushes what was written so far
+func (cw *compressWriter) Flush() {
+	if !cw.decided {
+		if cw.status == 0 {
+			cw.status = http.StatusOK
+		}
+		cw.decide(true)
+	}
+	if f, ok := cw.encoder.(interface{ Flush() error }); ok {
+		f.Flush()
+	}
+	if f, ok := cw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack hands the connection over, as for WebSocket upgrades
+func (cw *compressWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, rw, err := http.NewResponseController(cw.ResponseWriter).Hijack()
+	if err == nil {
+		cw.hijacked = true
+	}
+	return conn, rw, err
+}
+
+// Unwrap returns the wrapped writer for http.ResponseController
+func (cw *compressWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+// Close decides the encoding of responses shorter than min_size and
+// finishes the compressed stream
+func (cw *compressWriter) Close() error {
+	if cw.hijacked {
+		return nil
+	}
+	if !cw.decided {
+		if cw.status == 0 && len(cw.buf) == 0 {
+			return nil // Nothing was written, net/http sends the 200
+		}
+		if err := cw.decide(false); err != nil {
+			return err
+		}
+	}
+	if cw.encoder != nil {
+		return cw.encoder.Close()
+	}
+	return nil
+}
+
+// decide commits the headers, compressing when want is set and the response
+// qualifies, and writes the buffered start of the body
+func (cw *compressWriter) decide(want bool) error {
+	cw.decided = true
+	header := cw.Header()
+	if cw.vary {
+		addVary(header, "Accept-Encoding")
+	}
+
+	if want && cw.compressible() {
+		if header.Get("Content-Type") == "" {
+			// Sniffing the compressed body would find nothing
+			header.Set("Content-Type", http.DetectContentType(cw.buf))
+		}
+		header.Del("Content-Length")
+		header.Set("Content-Encoding", cw.encoding)
+		// The compressed body is a different representation of the resource
+		if etag := header.Get("ETag"); strings.HasPrefix(etag, `"`) {
+			header.Set("ETag", "W/"+etag)
+		}
+		cw.encoder = newEncoder(cw.encoding, cw.ResponseWriter)
+	}
+
+	cw.ResponseWriter.WriteHeader(cw.status)
+	buf := cw.buf
+	cw.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	var err error
+	if cw.encoder != nil {
+		_, err = cw.encoder.Write(buf)
+	} else {
+		_, err = cw.ResponseWriter.Write(buf)
+	}
+	return err
+}
+
+// addVary adds a request header to the Vary header, once
+func addVary(header http.Header, name string) {
+	for _, value := range header.Values("Vary") {
+		for _, field := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(field), name) {
+				return
+			}
+		}
+	}
+	header.Add("Vary", name)
+}
+
+// compressible reports whether the response may be compressed
+func (cw *compressWriter) compressible() bool {
+	header := cw.Header()
+	if cw.encoding == "" || cw.head || cw.status < http.StatusOK ||
+		cw.status == http.StatusNoContent || cw.status == http.StatusNotModified || cw.status == http.StatusPartialContent {
+		return false
+	}
+	if header.Get("Content-Encoding") != "" || header.Get("Content-Range") != "" {
+		return false
+	}
+	if length, err := strconv.Atoi(header.Get("Content-Length")); err == nil && length < cw.minSize {
+		return false
+	}
+	return compressibleType(header.Get("Content-Type"))
+}
+
+// compressibleType reports whether compressing a content type pays off;
+// most image, audio and video formats and archives are compressed already
+func compressibleType(contentType string) bool {
+	if contentType == "" {
+		return true
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return true
+	}
+	switch {
+	case mediaType == "image/svg+xml", mediaType == "image/bmp", mediaType == "image/x-icon":
+		return true
+	case strings.HasPrefix(mediaType, "image/"), strings.HasPrefix(mediaType, "audio/"), strings.HasPrefix(mediaType, "video/"):
+		return false
+	}
+	switch mediaType {
+	case "font/woff", "font/woff2", "application/zip", "application/gzip", "application/x-gzip",
+		"application/zstd", "application/x-bzip2", "application/x-7z-compressed", "application/x-rar-compressed":
+		return false
+	}
+	return true
+}
+
+// decodeBody reverses a content encoding
+func decodeBody(encoding string, body []byte) ([]byte, error) {
+	var r io.Reader
+	switch strings.ToLower(encoding) {
+	case "br":
+		r = brotli.NewReader(bytes.NewReader(body))
+	case "zstd":
+		decoder, err := zstd.NewReader(bytes.NewReader(body), zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, err
+		}
+		defer decoder.Close()
+		r = decoder
+	case "deflate":
+		zr, err := zlib.NewReader(bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		r = zr
+	case "gzip", "x-gzip":
+		zr, err := gzip.NewReader(bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		r = zr
+	default:
+		return nil, fmt.Errorf("unsupported content encoding %q", encoding)
+	}
+	return io.ReadAll(r)
+}
+
+// newEncoder creates the writer of an encoding; deflate is the zlib format
+// in HTTP
+func newEncoder(encoding string, w io.Writer) io.WriteCloser {
+	switch encoding {
+	case "br":
+		return brotli.NewWriter(w)
+	case "zstd":
+		encoder, _ := zstd.NewWriter(w, zstd.WithEncoderConcurrency(1))
+		return encoder
+	case "deflate":
+		return zlib.NewWriter(w)
+	default:
+		return gzip.NewWriter(w)
+	}
+}
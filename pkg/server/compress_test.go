@@ -0,0 +1,199 @@
+package server
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/developmeh/mock-cors-server/internal/config"
+)
+
+func TestNegotiateEncoding(t *testing.T) {
+	offered := []string{"br", "zstd", "gzip", "deflate"}
+
+	tests := []struct {
+		acceptEncoding string
+		expected       string
+	}{
+		{"", ""},
+		{"gzip", "gzip"},
+		{"gzip, deflate, br", "br"},
+		{"gzip;q=1.0, br;q=0.5", "gzip"},
+		{"br;q=0, gzip", "gzip"},
+		{"identity", ""},
+		{"*", "br"},
+		{"*;q=0.1, zstd", "zstd"},
+		{"GZIP", "gzip"},
+		{"compress", ""},
+	}
+
+	for _, tt := range tests {
+		if got := negotiateEncoding(tt.acceptEncoding, offered); got != tt.expected {
+			t.Errorf("negotiateEncoding(%q) = %q, expected %q", tt.acceptEncoding, got, tt.expected)
+		}
+	}
+}
+
+// decode reverses a content encoding
+func decode(t *testing.T, encoding string, body []byte) string {
+	t.Helper()
+	decoded, err := decodeBody(encoding, body)
+	if err != nil {
+		t.Fatalf("Failed to decode %s body: %v", encoding, err)
+	}
+	return string(decoded)
+}
+
+func TestCompression(t *testing.T) {
+	dir := t.TempDir()
+	bundle := strings.Repeat("console.log('hello');\n", 200)
+	files := map[string]string{
+		"app.js":    bundle,
+		"app.js.br": "precompressed br",
+		"app.js.gz": "precompressed gzip",
+		"tiny.txt":  "tiny",
+		"photo.png": strings.Repeat("\x89PNG", 500),
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+	largeJSON := `{"items": [` + strings.Repeat(`{"id": 1, "name": "item"},`, 100) + `{}]}`
+
+	cfg := config.DefaultConfig()
+	cfg.Compression.Enabled = true
+	cfg.Routes = []config.Route{
+		{Path: "/assets/", Type: "static_dir", Dir: dir},
+		{Path: "/api", Type: "json", JSONContent: largeJSON},
+		{Path: "/small", Type: "json", JSONContent: `{"ok": true}`},
+		{Path: "/raw", Type: "json", JSONContent: largeJSON, Compression: &config.CompressionConfig{}},
+		{Path: "/pre/", Type: "static_dir", Dir: dir, Compression: &config.CompressionConfig{Precompressed: true, Encodings: config.Encodings}},
+		{Path: "/gzip-only", Type: "json", JSONContent: largeJSON, Compression: &config.CompressionConfig{Enabled: true, Encodings: []string{"gzip"}}},
+	}
+	server := New(cfg)
+	if err := server.setupRoutes(); err != nil {
+		t.Fatalf("Expected routes to be set up, got %v", err)
+	}
+
+	serve := func(method, path string, headers map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		for name, value := range headers {
+			req.Header.Set(name, value)
+		}
+		w := httptest.NewRecorder()
+		server.mux.ServeHTTP(w, req)
+		return w
+	}
+
+	for _, encoding := range config.Encodings {
+		t.Run(encoding, func(t *testing.T) {
+			w := serve(http.MethodPost, "/api", map[string]string{"Accept-Encoding": encoding})
+			if w.Header().Get("Content-Encoding") != encoding {
+				t.Fatalf("Expected Content-Encoding %s, got %v", encoding, w.Header())
+			}
+			if body := decode(t, encoding, w.Body.Bytes()); body != largeJSON {
+				t.Errorf("Expected the JSON content after decoding, got %q", body)
+			}
+			if w.Header().Get("Vary") != "Accept-Encoding" || w.Header().Get("Content-Type") != "application/json" {
+				t.Errorf("Unexpected headers: %v", w.Header())
+			}
+		})
+	}
+
+	tests := []struct {
+		name             string
+		method           string
+		path             string
+		headers          map[string]string
+		expectedStatus   int
+		expectedEncoding string
+		expectedBody     string
+	}{
+		{name: "not accepted", method: http.MethodPost, path: "/api", expectedStatus: http.StatusOK, expectedBody: largeJSON},
+		{name: "below min size", method: http.MethodPost, path: "/small", headers: map[string]string{"Accept-Encoding": "gzip"}, expectedStatus: http.StatusOK, expectedBody: `{"ok": true}`},
+		{name: "disabled for route", method: http.MethodPost, path: "/raw", headers: map[string]string{"Accept-Encoding": "gzip"}, expectedStatus: http.StatusOK, expectedBody: largeJSON},
+		{name: "route encodings", method: http.MethodPost, path: "/gzip-only", headers: map[string]string{"Accept-Encoding": "br, gzip"}, expectedStatus: http.StatusOK, expectedEncoding: "gzip", expectedBody: largeJSON},
+		{name: "static file", method: http.MethodGet, path: "/assets/app.js", headers: map[string]string{"Accept-Encoding": "gzip"}, expectedStatus: http.StatusOK, expectedEncoding: "gzip", expectedBody: bundle},
+		{name: "small static file", method: http.MethodGet, path: "/assets/tiny.txt", headers: map[string]string{"Accept-Encoding": "gzip"}, expectedStatus: http.StatusOK, expectedBody: "tiny"},
+		{name: "compressed image", method: http.MethodGet, path: "/assets/photo.png", headers: map[string]string{"Accept-Encoding": "gzip"}, expectedStatus: http.StatusOK, expectedBody: files["photo.png"]},
+		{name: "range", method: http.MethodGet, path: "/assets/app.js", headers: map[string]string{"Accept-Encoding": "gzip", "Range": "bytes=0-6"}, expectedStatus: http.StatusPartialContent, expectedBody: "console"},
+		{name: "head", method: http.MethodHead, path: "/assets/app.js", headers: map[string]string{"Accept-Encoding": "gzip"}, expectedStatus: http.StatusOK},
+		{name: "precompressed", method: http.MethodGet, path: "/pre/app.js", headers: map[string]string{"Accept-Encoding": "gzip, br"}, expectedStatus: http.StatusOK, expectedEncoding: "br", expectedBody: "precompressed br"},
+		{name: "precompressed gzip", method: http.MethodGet, path: "/pre/app.js", headers: map[string]string{"Accept-Encoding": "gzip"}, expectedStatus: http.StatusOK, expectedEncoding: "gzip", expectedBody: "precompressed gzip"},
+		{name: "precompressed not accepted", method: http.MethodGet, path: "/pre/app.js", headers: map[string]string{"Accept-Encoding": "zstd"}, expectedStatus: http.StatusOK, expectedBody: bundle},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(tt.method, tt.path, tt.headers)
+			if w.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+			if encoding := w.Header().Get("Content-Encoding"); encoding != tt.expectedEncoding {
+				t.Errorf("Expected Content-Encoding %q, got %q", tt.expectedEncoding, encoding)
+			}
+			body := w.Body.String()
+			if tt.expectedEncoding != "" && !strings.HasPrefix(tt.expectedBody, "precompressed") {
+				body = decode(t, tt.expectedEncoding, w.Body.Bytes())
+			}
+			if body != tt.expectedBody {
+				t.Errorf("Expected body %.40q, got %.40q", tt.expectedBody, body)
+			}
+		})
+	}
+
+	t.Run("etag weakened", func(t *testing.T) {
+		w := serve(http.MethodGet, "/assets/app.js", map[string]string{"Accept-Encoding": "gzip"})
+		etag := w.Header().Get("ETag")
+		if !strings.HasPrefix(etag, `W/"`) {
+			t.Fatalf("Expected a weak ETag, got %q", etag)
+		}
+
+		w = serve(http.MethodGet, "/assets/app.js", map[string]string{"Accept-Encoding": "gzip", "If-None-Match": etag})
+		if w.Code != http.StatusNotModified {
+			t.Errorf("Expected 304 for the weak ETag, got %d", w.Code)
+		}
+	})
+
+	t.Run("precompressed vary", func(t *testing.T) {
+		w := serve(http.MethodGet, "/pre/app.js", nil)
+		if w.Header().Get("Vary") != "Accept-Encoding" || w.Header().Get("Content-Type") != "application/javascript" {
+			t.Errorf("Unexpected headers: %v", w.Header())
+		}
+	})
+}
+
+func TestCompressWriterFlush(t *testing.T) {
+	rec := httptest.NewRecorder()
+	cw := &compressWriter{ResponseWriter: rec, encoding: "gzip", minSize: 1024, vary: true}
+	cw.Header().Set("Content-Type", "text/event-stream")
+
+	cw.Write([]byte("data: 1\n\n"))
+	cw.Flush()
+	if !rec.Flushed || rec.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("Expected the stream to be compressed and flushed, got %v", rec.Header())
+	}
+
+	// The flushed part is readable before the stream ends
+	zr, err := gzip.NewReader(bytes.NewReader(rec.Body.Bytes()))
+	if err != nil {
+		t.Fatalf("Failed to open gzip stream: %v", err)
+	}
+	buf := make([]byte, 9)
+	if _, err := io.ReadFull(zr, buf); err != nil || string(buf) != "data: 1\n\n" {
+		t.Errorf("Expected the first event, got %q, %v", buf, err)
+	}
+
+	cw.Write([]byte("data: 2\n\n"))
+	cw.Close()
+	if body := decode(t, "gzip", rec.Body.Bytes()); body != "data: 1\n\ndata: 2\n\n" {
+		t.Errorf("Expected both events, got %q", body)
+	}
+}
@@ -0,0 +1,537 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/vektah/gqlparser/v2"
+	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+	"github.com/vektah/gqlparser/v2/validator"
+
+	"github.com/developmeh/mock-cors-server/internal/config"
+)
+
+// fakeListLength is the number of items of lists filled with fake data
+const fakeListLength = 2
+
+// graphQLEndpoint answers the operations of a graphql route
+type graphQLEndpoint struct {
+	schema      *ast.Schema
+	resolvers   map[string]graphQLResolver // By lowercase operation name
+	contentType string
+	status      int
+}
+
+// graphQLResolver is the parsed response configured for an operation
+type graphQLResolver struct {
+	data   map[string]interface{}
+	errors []string
+}
+
+// newGraphQLEndpoint loads the schema of a graphql route and parses its
+// resolvers. Operation names are matched case-insensitively, since config
+// keys are lowercased when loaded.
+func newGraphQLEndpoint(route config.Route, contentType string) (*graphQLEndpoint, error) {
+	if route.Schema == "" {
+		return nil, fmt.Errorf("schema is required for graphql routes")
+	}
+	sdl, err := os.ReadFile(route.Schema)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schema: %w", err)
+	}
+	schema, err := gqlparser.LoadSchema(&ast.Source{Name: route.Schema, Input: string(sdl)})
+	if err != nil {
+		return nil, fmt.Errorf("invalid schema %s: %w", route.Schema, err)
+	}
+
+	resolvers := make(map[string]graphQLResolver, len(route.Resolvers))
+	for name, r := range route.Resolvers {
+		resolver := graphQLResolver{errors: r.Errors}
+		if r.Data != "" {
+			if err := json.Unmarshal([]byte(r.Data), &resolver.data); err != nil {
+				return nil, fmt.Errorf("resolvers.%s: data must be a JSON object: %w", name, err)
+			}
+		}
+		resolvers[strings.ToLower(name)] = resolver
+	}
+
+	status := route.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	return &graphQLEndpoint{schema: schema, resolvers: resolvers, contentType: contentType, status: status}, nil
+}
+
+// graphQLRequest is a GraphQL request sent over HTTP
+type graphQLRequest struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+	Extensions    map[string]interface{} `json:"extensions"`
+}
+
+// graphQLResponse is the result of a request; data is left out when the
+// request failed before it was executed
+type graphQLResponse struct {
+	Data   json.RawMessage `json:"data,omitempty"`
+	Errors gqlerror.List   `json:"errors,omitempty"`
+}
+
+// serve answers GET requests with the query in the URL, and POST requests
+// with a JSON body, an application/graphql body or a JSON array of requests
+// as batched by Apollo
+func (g *graphQLEndpoint) serve(w http.ResponseWriter, r *http.Request) {
+	requests, batch, err := readGraphQLRequests(r)
+	if err != nil {
+		g.write(w, http.StatusBadRequest, graphQLResponse{Errors: gqlerror.List{gqlerror.Errorf("%s", err)}})
+		return
+	}
+
+	responses := make([]graphQLResponse, len(requests))
+	status := g.status
+	for i, req := range requests {
+		var code int
+		responses[i], code = g.execute(r, req)
+		if code != 0 && !batch {
+			status = code
+		}
+	}
+
+	if status == http.StatusMethodNotAllowed {
+		w.Header().Set("Allow", http.MethodPost)
+	}
+	if batch {
+		g.write(w, status, responses)
+	} else {
+		g.write(w, status, responses[0])
+	}
+}
+
+// write sends a response
+func (g *graphQLEndpoint) write(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", g.contentType)
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+// readGraphQLRequests reads the requests sent, reporting whether they were
+// sent as a batch
+func readGraphQLRequests(r *http.Request) ([]graphQLRequest, bool, error) {
+	if r.Method == http.MethodGet {
+		query := r.URL.Query()
+		req := graphQLRequest{Query: query.Get("query"), OperationName: query.Get("operationName")}
+		if variables := query.Get("variables"); variables != "" {
+			if err := json.Unmarshal([]byte(variables), &req.Variables); err != nil {
+				return nil, false, fmt.Errorf("variables must be a JSON object: %v", err)
+			}
+		}
+		if extensions := query.Get("extensions"); extensions != "" {
+			if err := json.Unmarshal([]byte(extensions), &req.Extensions); err != nil {
+				return nil, false, fmt.Errorf("extensions must be a JSON object: %v", err)
+			}
+		}
+		return []graphQLRequest{req}, false, nil
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to read body: %v", err)
+	}
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == "application/graphql" {
+		return []graphQLRequest{{Query: string(body)}}, false, nil
+	}
+
+	if trimmed := bytes.TrimSpace(body); len(trimmed) > 0 && trimmed[0] == '[' {
+		var requests []graphQLRequest
+		if err := json.Unmarshal(trimmed, &requests); err != nil {
+			return nil, false, fmt.Errorf("invalid request batch: %v", err)
+		}
+		if len(requests) == 0 {
+			return nil, false, fmt.Errorf("request batch is empty")
+		}
+		return requests, true, nil
+	}
+
+	var req graphQLRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		return nil, false, fmt.Errorf("invalid request body: %v", err)
+	}
+	return []graphQLRequest{req}, false, nil
+}
+
+// execute runs an operation. The returned status is set for requests that
+// cannot be executed at all.
+func (g *graphQLEndpoint) execute(r *http.Request, req graphQLRequest) (graphQLResponse, int) {
+	if req.Query == "" {
+		if _, ok := req.Extensions["persistedQuery"]; ok {
+			// Apollo falls back to sending the query
+			err := withCode(gqlerror.Errorf("PersistedQueryNotSupported"), "PERSISTED_QUERY_NOT_SUPPORTED")
+			return graphQLResponse{Errors: gqlerror.List{err}}, 0
+		}
+		return graphQLResponse{Errors: gqlerror.List{gqlerror.Errorf("query is required")}}, http.StatusBadRequest
+	}
+
+	doc, errs := gqlparser.LoadQuery(g.schema, req.Query)
+	if len(errs) > 0 {
+		// Validation errors name the rule they break, syntax errors do not
+		for _, err := range errs {
+			if err.Rule != "" {
+				withCode(err, "GRAPHQL_VALIDATION_FAILED")
+			} else {
+				withCode(err, "GRAPHQL_PARSE_FAILED")
+			}
+		}
+		return graphQLResponse{Errors: errs}, 0
+	}
+	op := doc.Operations.ForName(req.OperationName)
+	if op == nil {
+		if req.OperationName != "" {
+			return graphQLResponse{Errors: gqlerror.List{gqlerror.Errorf("unknown operation %q", req.OperationName)}}, 0
+		}
+		return graphQLResponse{Errors: gqlerror.List{gqlerror.Errorf("operationName is required for documents with several operations")}}, 0
+	}
+
+	var root *ast.Definition
+	switch op.Operation {
+	case ast.Query:
+		root = g.schema.Query
+	case ast.Mutation:
+		if r.Method == http.MethodGet {
+			return graphQLResponse{Errors: gqlerror.List{gqlerror.Errorf("mutations must be sent with POST")}}, http.StatusMethodNotAllowed
+		}
+		root = g.schema.Mutation
+	default:
+		return graphQLResponse{Errors: gqlerror.List{gqlerror.Errorf("%s operations are not supported", op.Operation)}}, 0
+	}
+
+	vars, err := validator.VariableValues(g.schema, op, req.Variables)
+	if err != nil {
+		gqlErr, ok := err.(*gqlerror.Error)
+		if !ok {
+			gqlErr = gqlerror.Errorf("%s", err)
+		}
+		return graphQLResponse{Errors: gqlerror.List{withCode(gqlErr, "BAD_USER_INPUT")}}, 0
+	}
+
+	resolver := g.resolvers[strings.ToLower(op.Name)]
+	e := &graphQLExecutor{schema: g.schema, fragments: doc.Fragments, vars: vars}
+	var data interface{}
+	if resolver.data != nil || len(resolver.errors) == 0 {
+		// A null non-null root field nulls the whole data
+		if object, ok := e.object([]ast.SelectionSet{op.SelectionSet}, root, resolver.data, nil, 1); ok {
+			data = object
+		}
+	}
+	for _, message := range resolver.errors {
+		e.errors = append(e.errors, gqlerror.Errorf("%s", message))
+	}
+
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return graphQLResponse{Errors: gqlerror.List{gqlerror.Errorf("failed to encode data: %v", err)}}, http.StatusInternalServerError
+	}
+	return graphQLResponse{Data: encoded, Errors: e.errors}, 0
+}
+
+// withCode sets the extensions.code clients such as Apollo tell errors
+// apart by
+func withCode(err *gqlerror.Error, code string) *gqlerror.Error {
+	if err.Extensions == nil {
+		err.Extensions = make(map[string]interface{})
+	}
+	err.Extensions["code"] = code
+	return err
+}
+
+// graphQLExecutor resolves the selections of an operation against the data
+// of its resolver, filling in fake values for fields the data leaves out
+type graphQLExecutor struct {
+	schema    *ast.Schema
+	fragments ast.FragmentDefinitionList
+	vars      map[string]interface{}
+	errors    gqlerror.List
+}
+
+// graphQLObject is a result object keeping its fields in the order they
+// were selected
+type graphQLObject []graphQLField
+
+// graphQLField is a field of a result object
+type graphQLField struct {
+	key   string
+	value interface{}
+}
+
+// MarshalJSON encodes the object with its fields in order
+func (o graphQLObject) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, f := range o {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, _ := json.Marshal(f.key)
+		buf.Write(key)
+		buf.WriteByte(':')
+		value, err := json.Marshal(f.value)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// graphQLLazy is a field value computed from the field's arguments when it
+// is selected, so introspection types, which reference each other, are only
+// built as deep as the query goes
+type graphQLLazy func(args map[string]interface{}) interface{}
+
+// collectedField is a field selected once or more under the same response
+// key, with the selection sets to merge
+type collectedField struct {
+	key   string
+	field *ast.Field
+	sets  []ast.SelectionSet
+}
+
+// object resolves the selections of an object type. Source holds the data
+// of the object, nil when every field is faked; n numbers the object in
+// the nearest list, starting at 1. When a non-null field is null the
+// object is null as well, and false is returned.
+func (e *graphQLExecutor) object(sets []ast.SelectionSet, def *ast.Definition, source map[string]interface{}, path ast.Path, n int) (graphQLObject, bool) {
+	var fields []*collectedField
+	byKey := make(map[string]*collectedField)
+	for _, set := range sets {
+		e.collectFields(set, def, &fields, byKey)
+	}
+
+	result := make(graphQLObject, 0, len(fields))
+	for _, cf := range fields {
+		fieldPath := appendPath(path, ast.PathName(cf.key))
+		name := cf.field.Name
+		if name == "__typename" {
+			result = append(result, graphQLField{cf.key, def.Name})
+			continue
+		}
+
+		var value interface{}
+		present := false
+		switch {
+		case def == e.schema.Query && name == "__schema":
+			value, present = e.introspectSchema(), true
+		case def == e.schema.Query && name == "__type":
+			typeName, _ := cf.field.ArgumentMap(e.vars)["name"].(string)
+			value, present = e.introspectType(e.schema.Types[typeName]), true
+		case source != nil:
+			// Data copied from real responses is keyed by alias
+			if value, present = source[cf.key]; !present {
+				value, present = source[name]
+			}
+		}
+		if lazy, ok := value.(graphQLLazy); ok {
+			value = lazy(cf.field.ArgumentMap(e.vars))
+		}
+
+		fd := def.Fields.ForName(name)
+		if fd == nil {
+			result = append(result, graphQLField{cf.key, nil})
+			continue
+		}
+		completed := e.complete(fd.Type, name, cf.sets, value, present, fieldPath, n)
+		if completed == nil && fd.Type.NonNull {
+			return nil, false
+		}
+		result = append(result, graphQLField{cf.key, completed})
+	}
+	return result, true
+}
+
+// collectFields adds the fields a selection set selects on an object type,
+// following fragments that apply to it and honouring @skip and @include
+func (e *graphQLExecutor) collectFields(set ast.SelectionSet, def *ast.Definition, fields *[]*collectedField, byKey map[string]*collectedField) {
+	for _, selection := range set {
+		switch sel := selection.(type) {
+		case *ast.Field:
+			if !e.included(sel.Directives) {
+				continue
+			}
+			key := sel.Alias
+			if key == "" {
+				key = sel.Name
+			}
+			if cf, ok := byKey[key]; ok {
+				cf.sets = append(cf.sets, sel.SelectionSet)
+				continue
+			}
+			cf := &collectedField{key: key, field: sel, sets: []ast.SelectionSet{sel.SelectionSet}}
+			byKey[key] = cf
+			*fields = append(*fields, cf)
+		case *ast.InlineFragment:
+			if e.included(sel.Directives) && e.applies(sel.TypeCondition, def) {
+				e.collectFields(sel.SelectionSet, def, fields, byKey)
+			}
+		case *ast.FragmentSpread:
+			fragment := e.fragments.ForName(sel.Name)
+			if fragment != nil && e.included(sel.Directives) && e.applies(fragment.TypeCondition, def) {
+				e.collectFields(fragment.SelectionSet, def, fields, byKey)
+			}
+		}
+	}
+}
+
+// included evaluates the @skip and @include directives of a selection
+func (e *graphQLExecutor) included(directives ast.DirectiveList) bool {
+	if skip := directives.ForName("skip"); skip != nil && skip.ArgumentMap(e.vars)["if"] == true {
+		return false
+	}
+	if include := directives.ForName("include"); include != nil && include.ArgumentMap(e.vars)["if"] == false {
+		return false
+	}
+	return true
+}
+
+// applies reports whether a fragment's type condition matches an object type
+func (e *graphQLExecutor) applies(condition string, def *ast.Definition) bool {
+	if condition == "" || condition == def.Name {
+		return true
+	}
+	for _, possible := range e.schema.GetPossibleTypes(e.schema.Types[condition]) {
+		if possible.Name == def.Name {
+			return true
+		}
+	}
+	return false
+}
+
+// complete turns the value of a field into its result, faking it when the
+// data has none
+func (e *graphQLExecutor) complete(t *ast.Type, name string, sets []ast.SelectionSet, value interface{}, present bool, path ast.Path, n int) interface{} {
+	if present && value == nil {
+		// The null propagates to the nearest nullable parent, as the spec
+		// requires, with an error saying why it is missing
+		if t.NonNull {
+			e.errorf(path, "resolver data for %s is null, which %s does not allow", name, t.String())
+		}
+		return nil
+	}
+
+	if t.Elem != nil {
+		count := fakeListLength
+		var items []interface{}
+		if present {
+			list, ok := value.([]interface{})
+			if !ok {
+				e.errorf(path, "resolver data for %s is not a list", name)
+				return nil
+			}
+			items, count = list, len(list)
+		}
+		result := make([]interface{}, count)
+		for i := range result {
+			var item interface{}
+			if present {
+				item = items[i]
+			}
+			result[i] = e.complete(t.Elem, name, sets, item, present, appendPath(path, ast.PathIndex(i)), i+1)
+			if result[i] == nil && t.Elem.NonNull {
+				return nil
+			}
+		}
+		return result
+	}
+
+	def := e.schema.Types[t.NamedType]
+	if def == nil {
+		return nil
+	}
+	switch def.Kind {
+	case ast.Scalar, ast.Enum:
+		if present {
+			return value
+		}
+		return fakeValue(def, name, n)
+	default:
+		var source map[string]interface{}
+		if present {
+			object, ok := value.(map[string]interface{})
+			if !ok {
+				e.errorf(path, "resolver data for %s is not an object", name)
+				return nil
+			}
+			source = object
+		}
+		if def.IsAbstractType() {
+			def = e.concreteType(def, source)
+		}
+		object, ok := e.object(sets, def, source, path, n)
+		if !ok {
+			return nil
+		}
+		return object
+	}
+}
+
+// concreteType picks the object type of an interface or union value: the
+// one named by __typename in the data, or the first possible type
+func (e *graphQLExecutor) concreteType(def *ast.Definition, source map[string]interface{}) *ast.Definition {
+	possible := e.schema.GetPossibleTypes(def)
+	if typeName, ok := source["__typename"].(string); ok {
+		for _, p := range possible {
+			if p.Name == typeName {
+				return p
+			}
+		}
+	}
+	if len(possible) > 0 {
+		return possible[0]
+	}
+	return def
+}
+
+// errorf records an error of the field at path
+func (e *graphQLExecutor) errorf(path ast.Path, format string, args ...interface{}) {
+	err := gqlerror.Errorf(format, args...)
+	err.Path = path
+	e.errors = append(e.errors, err)
+}
+
+// appendPath extends a path without sharing its backing array
+func appendPath(path ast.Path, element ast.PathElement) ast.Path {
+	extended := make(ast.Path, len(path), len(path)+1)
+	copy(extended, path)
+	return append(extended, element)
+}
+
+// fakeValue makes up a value of a scalar or enum type for the nth item of
+// a list, or a field outside lists
+func fakeValue(def *ast.Definition, name string, n int) interface{} {
+	if def.Kind == ast.Enum {
+		if len(def.EnumValues) == 0 {
+			return nil
+		}
+		return def.EnumValues[(n-1)%len(def.EnumValues)].Name
+	}
+	switch def.Name {
+	case "Int":
+		return n
+	case "Float":
+		return float64(n) + 0.5
+	case "Boolean":
+		return n%2 == 1
+	case "ID":
+		return strconv.Itoa(n)
+	default:
+		// String and custom scalars
+		return fmt.Sprintf("%s %d", name, n)
+	}
+}
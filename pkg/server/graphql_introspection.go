@@ -0,0 +1,229 @@
+package server
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/vektah/gqlparser/v2/ast"
+)
+
+// introspectionObject returns a value of an introspection type with every
+// field set to null, so fields left unset are not faked
+func (e *graphQLExecutor) introspectionObject(typeName string) map[string]interface{} {
+	object := make(map[string]interface{})
+	if def := e.schema.Types[typeName]; def != nil {
+		for _, f := range def.Fields {
+			object[f.Name] = nil
+		}
+	}
+	return object
+}
+
+// introspectSchema describes the schema for the __schema field
+func (e *graphQLExecutor) introspectSchema() map[string]interface{} {
+	s := e.introspectionObject("__Schema")
+	s["description"] = nullIfEmpty(e.schema.Description)
+	s["types"] = graphQLLazy(func(map[string]interface{}) interface{} {
+		names := make([]string, 0, len(e.schema.Types))
+		for name := range e.schema.Types {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		types := make([]interface{}, 0, len(names))
+		for _, name := range names {
+			types = append(types, e.introspectType(e.schema.Types[name]))
+		}
+		return types
+	})
+	s["queryType"] = e.introspectType(e.schema.Query)
+	s["mutationType"] = e.introspectType(e.schema.Mutation)
+	s["subscriptionType"] = e.introspectType(e.schema.Subscription)
+	s["directives"] = graphQLLazy(func(map[string]interface{}) interface{} {
+		names := make([]string, 0, len(e.schema.Directives))
+		for name := range e.schema.Directives {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		directives := make([]interface{}, 0, len(names))
+		for _, name := range names {
+			directives = append(directives, e.introspectDirective(e.schema.Directives[name]))
+		}
+		return directives
+	})
+	return s
+}
+
+// introspectType describes a named type for __Type, or returns nil for
+// types the schema lacks
+func (e *graphQLExecutor) introspectType(def *ast.Definition) interface{} {
+	if def == nil {
+		return nil
+	}
+	t := e.introspectionObject("__Type")
+	t["kind"] = string(def.Kind)
+	t["name"] = def.Name
+	t["description"] = nullIfEmpty(def.Description)
+	if specifiedBy := def.Directives.ForName("specifiedBy"); specifiedBy != nil {
+		if url := specifiedBy.Arguments.ForName("url"); url != nil {
+			t["specifiedByURL"] = url.Value.Raw
+		}
+	}
+
+	switch def.Kind {
+	case ast.Object, ast.Interface:
+		t["fields"] = graphQLLazy(func(args map[string]interface{}) interface{} {
+			fields := make([]interface{}, 0, len(def.Fields))
+			for _, f := range def.Fields {
+				deprecated, _ := deprecation(f.Directives)
+				if strings.HasPrefix(f.Name, "__") || (deprecated && args["includeDeprecated"] != true) {
+					continue
+				}
+				fields = append(fields, e.introspectField(f))
+			}
+			return fields
+		})
+		t["interfaces"] = graphQLLazy(func(map[string]interface{}) interface{} {
+			interfaces := make([]interface{}, 0, len(def.Interfaces))
+			for _, name := range def.Interfaces {
+				interfaces = append(interfaces, e.introspectType(e.schema.Types[name]))
+			}
+			return interfaces
+		})
+	case ast.Enum:
+		t["enumValues"] = graphQLLazy(func(args map[string]interface{}) interface{} {
+			values := make([]interface{}, 0, len(def.EnumValues))
+			for _, v := range def.EnumValues {
+				deprecated, reason := deprecation(v.Directives)
+				if deprecated && args["includeDeprecated"] != true {
+					continue
+				}
+				value := e.introspectionObject("__EnumValue")
+				value["name"] = v.Name
+				value["description"] = nullIfEmpty(v.Description)
+				value["isDeprecated"] = deprecated
+				value["deprecationReason"] = reason
+				values = append(values, value)
+			}
+			return values
+		})
+	case ast.InputObject:
+		t["inputFields"] = graphQLLazy(func(args map[string]interface{}) interface{} {
+			fields := make([]interface{}, 0, len(def.Fields))
+			for _, f := range def.Fields {
+				if deprecated, _ := deprecation(f.Directives); deprecated && args["includeDeprecated"] != true {
+					continue
+				}
+				fields = append(fields, e.introspectInputValue(f.Name, f.Description, f.Type, f.DefaultValue, f.Directives))
+			}
+			return fields
+		})
+		t["isOneOf"] = def.Directives.ForName("oneOf") != nil
+	}
+	if def.Kind == ast.Interface || def.Kind == ast.Union {
+		t["possibleTypes"] = graphQLLazy(func(map[string]interface{}) interface{} {
+			possible := e.schema.GetPossibleTypes(def)
+			types := make([]interface{}, 0, len(possible))
+			for _, p := range possible {
+				types = append(types, e.introspectType(p))
+			}
+			return types
+		})
+	}
+	return t
+}
+
+// introspectTypeRef describes the type of a field or argument, wrapping
+// named types in NON_NULL and LIST types
+func (e *graphQLExecutor) introspectTypeRef(t *ast.Type) interface{} {
+	switch {
+	case t.NonNull:
+		ref := e.introspectionObject("__Type")
+		ref["kind"] = "NON_NULL"
+		nullable := *t
+		nullable.NonNull = false
+		ref["ofType"] = e.introspectTypeRef(&nullable)
+		return ref
+	case t.Elem != nil:
+		ref := e.introspectionObject("__Type")
+		ref["kind"] = "LIST"
+		ref["ofType"] = e.introspectTypeRef(t.Elem)
+		return ref
+	default:
+		return e.introspectType(e.schema.Types[t.NamedType])
+	}
+}
+
+// introspectField describes a field for __Field
+func (e *graphQLExecutor) introspectField(f *ast.FieldDefinition) map[string]interface{} {
+	field := e.introspectionObject("__Field")
+	field["name"] = f.Name
+	field["description"] = nullIfEmpty(f.Description)
+	field["args"] = e.introspectArgs(f.Arguments)
+	field["type"] = e.introspectTypeRef(f.Type)
+	field["isDeprecated"], field["deprecationReason"] = deprecation(f.Directives)
+	return field
+}
+
+// introspectArgs lists arguments, leaving out deprecated ones unless asked
+func (e *graphQLExecutor) introspectArgs(arguments ast.ArgumentDefinitionList) graphQLLazy {
+	return func(args map[string]interface{}) interface{} {
+		values := make([]interface{}, 0, len(arguments))
+		for _, a := range arguments {
+			if deprecated, _ := deprecation(a.Directives); deprecated && args["includeDeprecated"] != true {
+				continue
+			}
+			values = append(values, e.introspectInputValue(a.Name, a.Description, a.Type, a.DefaultValue, a.Directives))
+		}
+		return values
+	}
+}
+
+// introspectInputValue describes an argument or input field for
+// __InputValue
+func (e *graphQLExecutor) introspectInputValue(name, description string, t *ast.Type, defaultValue *ast.Value, directives ast.DirectiveList) map[string]interface{} {
+	value := e.introspectionObject("__InputValue")
+	value["name"] = name
+	value["description"] = nullIfEmpty(description)
+	value["type"] = e.introspectTypeRef(t)
+	if defaultValue != nil {
+		value["defaultValue"] = defaultValue.String()
+	}
+	value["isDeprecated"], value["deprecationReason"] = deprecation(directives)
+	return value
+}
+
+// introspectDirective describes a directive for __Directive
+func (e *graphQLExecutor) introspectDirective(d *ast.DirectiveDefinition) map[string]interface{} {
+	directive := e.introspectionObject("__Directive")
+	directive["name"] = d.Name
+	directive["description"] = nullIfEmpty(d.Description)
+	directive["isRepeatable"] = d.IsRepeatable
+	locations := make([]interface{}, 0, len(d.Locations))
+	for _, location := range d.Locations {
+		locations = append(locations, string(location))
+	}
+	directive["locations"] = locations
+	directive["args"] = e.introspectArgs(d.Arguments)
+	return directive
+}
+
+// deprecation reports whether an element is marked @deprecated, and why
+func deprecation(directives ast.DirectiveList) (bool, interface{}) {
+	deprecated := directives.ForName("deprecated")
+	if deprecated == nil {
+		return false, nil
+	}
+	if reason := deprecated.Arguments.ForName("reason"); reason != nil {
+		return true, reason.Value.Raw
+	}
+	return true, "No longer supported"
+}
+
+// nullIfEmpty returns nil for empty strings, which introspection reports
+// as null
+func nullIfEmpty(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
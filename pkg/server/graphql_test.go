@@ -0,0 +1,327 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/developmeh/mock-cors-server/internal/config"
+)
+
+const testSchema = `
+type Query {
+  me: User
+  users(first: Int = 10): [User!]!
+  search(term: String!): [SearchResult!]!
+}
+
+type Mutation {
+  rename(name: String!): User!
+}
+
+"Something with an ID"
+interface Node {
+  id: ID!
+}
+
+type User implements Node {
+  id: ID!
+  name: String!
+  email: String @deprecated(reason: "Use contact")
+  contact: String
+  role: Role!
+  score: Float
+  active: Boolean!
+  friends: [User!]!
+}
+
+type Post implements Node {
+  id: ID!
+  title: String!
+}
+
+union SearchResult = User | Post
+
+enum Role {
+  ADMIN
+  MEMBER
+}
+`
+
+// newGraphQLTestServer serves a graphql route for the test schema
+func newGraphQLTestServer(t *testing.T) *Server {
+	t.Helper()
+	schema := filepath.Join(t.TempDir(), "schema.graphql")
+	if err := os.WriteFile(schema, []byte(testSchema), 0644); err != nil {
+		t.Fatalf("Failed to write schema: %v", err)
+	}
+
+	cfg := config.DefaultConfig()
+	cfg.Routes = []config.Route{{Path: "/graphql", Type: "graphql", Schema: schema, Resolvers: map[string]config.GraphQLResolver{
+		"GetViewer": {Data: `{"me": {"id": "42", "name": "Ada", "unselected": true}}`},
+		"search":    {Data: `{"search": [{"__typename": "Post", "id": "p1", "title": "Hello"}, {"__typename": "User", "name": "Bo"}]}`},
+		"forbidden": {Errors: []string{"Not authorized"}},
+		"aliased":   {Data: `{"viewer": {"name": "Cy"}}`},
+		"nullName":  {Data: `{"me": {"id": "7", "name": null, "contact": null}}`},
+		"nullUser":  {Data: `{"users": [{"id": "1"}, null]}`},
+	}}}
+	server := New(cfg)
+	if err := server.setupRoutes(); err != nil {
+		t.Fatalf("Expected routes to be set up, got %v", err)
+	}
+	return server
+}
+
+func TestGraphQLRoute(t *testing.T) {
+	server := newGraphQLTestServer(t)
+
+	serve := func(req *http.Request) (int, string) {
+		w := httptest.NewRecorder()
+		server.mux.ServeHTTP(w, req)
+		return w.Code, strings.TrimSpace(w.Body.String())
+	}
+	post := func(body interface{}) (int, string) {
+		encoded, _ := json.Marshal(body)
+		req := httptest.NewRequest(http.MethodPost, "/graphql", strings.NewReader(string(encoded)))
+		req.Header.Set("Content-Type", "application/json")
+		return serve(req)
+	}
+
+	tests := []struct {
+		name           string
+		request        interface{}
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name:           "resolver data with fake fields",
+			request:        map[string]interface{}{"query": "query GetViewer { me { id name role friends { name } } }"},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"data":{"me":{"id":"42","name":"Ada","role":"ADMIN","friends":[{"name":"name 1"},{"name":"name 2"}]}}}`,
+		},
+		{
+			name:           "fake data",
+			request:        map[string]interface{}{"query": "{ users { id active role score } }"},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"data":{"users":[{"id":"1","active":true,"role":"ADMIN","score":1.5},{"id":"2","active":false,"role":"MEMBER","score":2.5}]}}`,
+		},
+		{
+			name:           "aliases",
+			request:        map[string]interface{}{"query": "query Aliased { viewer: me { name } }"},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"data":{"viewer":{"name":"Cy"}}}`,
+		},
+		{
+			name:           "union types",
+			request:        map[string]interface{}{"query": `query Search { search(term: "h") { __typename ... on Post { title } ... on User { name } } }`},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"data":{"search":[{"__typename":"Post","title":"Hello"},{"__typename":"User","name":"Bo"}]}}`,
+		},
+		{
+			name:           "fragments and directives",
+			request:        map[string]interface{}{"query": "query GetViewer($full: Boolean!) { me { ...Basic email @include(if: $full) } } fragment Basic on User { id }", "variables": map[string]interface{}{"full": false}},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"data":{"me":{"id":"42"}}}`,
+		},
+		{
+			name:           "resolver errors",
+			request:        map[string]interface{}{"query": "query Forbidden { me { id } }"},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"data":null,"errors":[{"message":"Not authorized"}]}`,
+		},
+		{
+			name:           "null in a non-null field",
+			request:        map[string]interface{}{"query": "query NullName { me { id name } }"},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"data":{"me":null},"errors":[{"message":"resolver data for name is null, which String! does not allow","path":["me","name"]}]}`,
+		},
+		{
+			name:           "null in a nullable field",
+			request:        map[string]interface{}{"query": "query NullName { me { id contact } }"},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"data":{"me":{"id":"7","contact":null}}}`,
+		},
+		{
+			name:           "null propagated to the root",
+			request:        map[string]interface{}{"query": "query NullUser { users { id } }"},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"data":null,"errors":[{"message":"resolver data for users is null, which User! does not allow","path":["users",1]}]}`,
+		},
+		{
+			name:           "mutation",
+			request:        map[string]interface{}{"query": `mutation Rename { rename(name: "Dee") { name } }`},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"data":{"rename":{"name":"name 1"}}}`,
+		},
+		{
+			name:           "invalid query",
+			request:        map[string]interface{}{"query": "{ me { nickname } }"},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"errors":[{"message":"Cannot query field \"nickname\" on type \"User\". Did you mean \"name\"?","locations":[{"line":1,"column":8}],"extensions":{"code":"GRAPHQL_VALIDATION_FAILED"}}]}`,
+		},
+		{
+			name:           "invalid variables",
+			request:        map[string]interface{}{"query": "query Users($n: Int!) { users(first: $n) { id } }", "variables": map[string]interface{}{"n": "ten"}},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"errors":[{"message":"cannot use string as Int","path":["variable","n"],"extensions":{"code":"BAD_USER_INPUT"}}]}`,
+		},
+		{
+			name:           "syntax error",
+			request:        map[string]interface{}{"query": "{ me { "},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"errors":[{"message":"Expected Name, found \u003cEOF\u003e","locations":[{"line":1,"column":8}],"extensions":{"code":"GRAPHQL_PARSE_FAILED"}}]}`,
+		},
+		{
+			name:           "unknown operation",
+			request:        map[string]interface{}{"query": "query A { me { id } }", "operationName": "B"},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"errors":[{"message":"unknown operation \"B\""}]}`,
+		},
+		{
+			name:           "missing query",
+			request:        map[string]interface{}{},
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   `{"errors":[{"message":"query is required"}]}`,
+		},
+		{
+			name:           "persisted query",
+			request:        map[string]interface{}{"extensions": map[string]interface{}{"persistedQuery": map[string]interface{}{"version": 1, "sha256Hash": "abc"}}},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"errors":[{"message":"PersistedQueryNotSupported","extensions":{"code":"PERSISTED_QUERY_NOT_SUPPORTED"}}]}`,
+		},
+		{
+			name:           "batch",
+			request:        []map[string]interface{}{{"query": "query Aliased { viewer: me { name } }"}, {"query": "{ me { id } }"}},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `[{"data":{"viewer":{"name":"Cy"}}},{"data":{"me":{"id":"1"}}}]`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, body := post(tt.request)
+			if status != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, status)
+			}
+			if body != tt.expectedBody {
+				t.Errorf("Expected body\n%s\ngot\n%s", tt.expectedBody, body)
+			}
+		})
+	}
+
+	t.Run("get", func(t *testing.T) {
+		query := url.Values{"query": {"query GetViewer { me { name } }"}}
+		status, body := serve(httptest.NewRequest(http.MethodGet, "/graphql?"+query.Encode(), nil))
+		if status != http.StatusOK || body != `{"data":{"me":{"name":"Ada"}}}` {
+			t.Errorf("Unexpected response: %d %s", status, body)
+		}
+
+		query = url.Values{"query": {`mutation { rename(name: "x") { id } }`}}
+		if status, _ := serve(httptest.NewRequest(http.MethodGet, "/graphql?"+query.Encode(), nil)); status != http.StatusMethodNotAllowed {
+			t.Errorf("Expected 405 for a mutation over GET, got %d", status)
+		}
+	})
+
+	t.Run("application/graphql", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/graphql", strings.NewReader("query GetViewer { me { id } }"))
+		req.Header.Set("Content-Type", "application/graphql")
+		if status, body := serve(req); status != http.StatusOK || body != `{"data":{"me":{"id":"42"}}}` {
+			t.Errorf("Unexpected response: %d %s", status, body)
+		}
+	})
+}
+
+func TestGraphQLIntrospection(t *testing.T) {
+	server := newGraphQLTestServer(t)
+
+	query := func(t *testing.T, q string) map[string]interface{} {
+		t.Helper()
+		encoded, _ := json.Marshal(map[string]string{"query": q})
+		w := httptest.NewRecorder()
+		server.mux.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/graphql", strings.NewReader(string(encoded))))
+		var response struct {
+			Data   map[string]interface{} `json:"data"`
+			Errors []interface{}          `json:"errors"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil || len(response.Errors) > 0 {
+			t.Fatalf("Expected data, got %s", w.Body.String())
+		}
+		return response.Data
+	}
+	names := func(list interface{}) string {
+		var result []string
+		for _, item := range list.([]interface{}) {
+			result = append(result, item.(map[string]interface{})["name"].(string))
+		}
+		return strings.Join(result, ",")
+	}
+
+	t.Run("schema", func(t *testing.T) {
+		data := query(t, "{ __schema { queryType { name } mutationType { name } subscriptionType { name } types { name } directives { name } } }")
+		schema := data["__schema"].(map[string]interface{})
+		if schema["queryType"].(map[string]interface{})["name"] != "Query" || schema["mutationType"].(map[string]interface{})["name"] != "Mutation" || schema["subscriptionType"] != nil {
+			t.Errorf("Unexpected root types: %v", schema)
+		}
+		types := names(schema["types"])
+		for _, name := range []string{"Query", "User", "Role", "SearchResult", "String", "__Schema"} {
+			if !strings.Contains(","+types+",", ","+name+",") {
+				t.Errorf("Expected type %s in %s", name, types)
+			}
+		}
+		if !strings.Contains(names(schema["directives"]), "deprecated") {
+			t.Errorf("Expected the built-in directives, got %v", schema["directives"])
+		}
+	})
+
+	t.Run("type", func(t *testing.T) {
+		data := query(t, `{
+			user: __type(name: "User") { kind fields { name type { kind name ofType { kind name } } } interfaces { name } }
+			all: __type(name: "User") { fields(includeDeprecated: true) { name isDeprecated deprecationReason } }
+			role: __type(name: "Role") { kind enumValues { name } }
+			node: __type(name: "Node") { kind description possibleTypes { name } }
+			missing: __type(name: "Missing") { name }
+		}`)
+
+		user := data["user"].(map[string]interface{})
+		if user["kind"] != "OBJECT" || names(user["fields"]) != "id,name,contact,role,score,active,friends" || names(user["interfaces"]) != "Node" {
+			t.Errorf("Unexpected User type: %v", user)
+		}
+		id := user["fields"].([]interface{})[0].(map[string]interface{})["type"].(map[string]interface{})
+		if id["kind"] != "NON_NULL" || id["name"] != nil || id["ofType"].(map[string]interface{})["name"] != "ID" {
+			t.Errorf("Expected ID!, got %v", id)
+		}
+
+		email := data["all"].(map[string]interface{})["fields"].([]interface{})[2].(map[string]interface{})
+		if email["name"] != "email" || email["isDeprecated"] != true || email["deprecationReason"] != "Use contact" {
+			t.Errorf("Expected the deprecated email field, got %v", email)
+		}
+
+		if role := data["role"].(map[string]interface{}); role["kind"] != "ENUM" || names(role["enumValues"]) != "ADMIN,MEMBER" {
+			t.Errorf("Unexpected Role type: %v", role)
+		}
+		if node := data["node"].(map[string]interface{}); node["kind"] != "INTERFACE" || node["description"] != "Something with an ID" || names(node["possibleTypes"]) != "User,Post" {
+			t.Errorf("Unexpected Node type: %v", node)
+		}
+		if data["missing"] != nil {
+			t.Errorf("Expected null for unknown types, got %v", data["missing"])
+		}
+	})
+}
+
+func TestNewGraphQLEndpoint(t *testing.T) {
+	dir := t.TempDir()
+	invalid := filepath.Join(dir, "invalid.graphql")
+	os.WriteFile(invalid, []byte("type Query { me: Unknown }"), 0644)
+
+	if _, err := newGraphQLEndpoint(config.Route{Path: "/graphql", Type: "graphql", Schema: invalid}, "application/json"); err == nil || !strings.Contains(err.Error(), "invalid schema") {
+		t.Errorf("Expected an invalid schema error, got %v", err)
+	}
+	if _, err := newGraphQLEndpoint(config.Route{Path: "/graphql", Type: "graphql", Schema: filepath.Join(dir, "missing.graphql")}, "application/json"); err == nil {
+		t.Error("Expected an error for a missing schema")
+	}
+}
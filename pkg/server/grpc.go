@@ -0,0 +1,494 @@
+package server
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+
+	"github.com/developmeh/mock-cors-server/internal/config"
+)
+
+// gRPC status codes used by the server itself
+const (
+	grpcInvalidArgument = 3
+	grpcUnimplemented   = 12
+	grpcInternal        = 13
+)
+
+// Flags of enveloped messages
+const (
+	flagCompressed = 0x01
+	flagEndStream  = 0x02 // Connect end-of-stream message
+	flagTrailers   = 0x80 // gRPC-Web trailers
+)
+
+// connectHTTPStatus maps gRPC status codes to the HTTP status of Connect
+// unary errors
+var connectHTTPStatus = []int{200, 499, 500, 400, 504, 404, 409, 403, 429, 400, 409, 400, 501, 500, 503, 500, 401}
+
+// grpcAllowHeaders are request headers gRPC-Web and Connect clients send,
+// and grpcExposeHeaders the response headers they read the status from
+var (
+	grpcAllowHeaders  = []string{"Content-Type", "Connect-Protocol-Version", "Connect-Timeout-Ms", "Grpc-Timeout", "X-Grpc-Web", "X-User-Agent"}
+	grpcExposeHeaders = []string{"Grpc-Status", "Grpc-Message", "Grpc-Status-Details-Bin"}
+)
+
+// grpcService answers gRPC-Web and Connect calls to the services of a
+// descriptor set
+type grpcService struct {
+	methods map[string]*grpcMethod // By full name, e.g. acme.v1.Greeter/SayHello
+	types   *dynamicpb.Types
+}
+
+// grpcMethod is a method of a service and its configured response
+type grpcMethod struct {
+	desc      protoreflect.MethodDescriptor
+	responses []proto.Message
+	status    grpcStatus
+}
+
+// grpcStatus is the outcome of a call, sent after the response messages
+type grpcStatus struct {
+	code     int
+	message  string
+	trailers map[string]string
+}
+
+// newGRPCService loads the descriptor set of a grpc route and parses the
+// configured responses against it
+func newGRPCService(route config.Route) (*grpcService, error) {
+	if route.DescriptorSet == "" {
+		return nil, fmt.Errorf("descriptor_set is required for grpc routes")
+	}
+	data, err := os.ReadFile(route.DescriptorSet)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read descriptor set: %w", err)
+	}
+	var set descriptorpb.FileDescriptorSet
+	if err := proto.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("invalid descriptor set %s: %w", route.DescriptorSet, err)
+	}
+	files, err := protodesc.NewFiles(&set)
+	if err != nil {
+		return nil, fmt.Errorf("invalid descriptor set %s (build it with --include_imports): %w", route.DescriptorSet, err)
+	}
+
+	g := &grpcService{methods: make(map[string]*grpcMethod), types: dynamicpb.NewTypes(files)}
+	files.RangeFiles(func(fd protoreflect.FileDescriptor) bool {
+		for i := 0; i < fd.Services().Len(); i++ {
+			sd := fd.Services().Get(i)
+			for j := 0; j < sd.Methods().Len(); j++ {
+				md := sd.Methods().Get(j)
+				g.methods[string(sd.FullName())+"/"+string(md.Name())] = &grpcMethod{desc: md}
+			}
+		}
+		return true
+	})
+	if len(g.methods) == 0 {
+		return nil, fmt.Errorf("descriptor set %s has no services", route.DescriptorSet)
+	}
+
+	unmarshal := protojson.UnmarshalOptions{Resolver: g.types}
+	for i, rpc := range route.RPCs {
+		m := g.methods[rpc.Method]
+		if m == nil {
+			return nil, fmt.Errorf("rpcs[%d]: unknown method %q", i, rpc.Method)
+		}
+		if !m.desc.IsStreamingServer() && len(rpc.Responses) > 1 {
+			return nil, fmt.Errorf("rpcs[%d]: unary method %s takes at most one response", i, rpc.Method)
+		}
+		code, ok := config.ParseGRPCCode(rpc.Code)
+		if !ok {
+			return nil, fmt.Errorf("rpcs[%d]: unknown status code %q", i, rpc.Code)
+		}
+		m.status = grpcStatus{code: code, message: rpc.Message, trailers: rpc.Trailers}
+		for j, response := range rpc.Responses {
+			msg := dynamicpb.NewMessage(m.desc.Output())
+			if err := unmarshal.Unmarshal([]byte(response), msg); err != nil {
+				return nil, fmt.Errorf("rpcs[%d].responses[%d]: invalid %s: %w", i, j, m.desc.Output().FullName(), err)
+			}
+			m.responses = append(m.responses, msg)
+		}
+	}
+	return g, nil
+}
+
+// cors adds the headers gRPC clients send and read to a CORS configuration,
+// including trailers, which arrive as headers in some responses
+func (g *grpcService) cors(cors config.CORSConfig) *config.CORSConfig {
+	expose := append([]string(nil), grpcExposeHeaders...)
+	var trailers []string
+	for _, m := range g.methods {
+		for name := range m.status.trailers {
+			trailers = append(trailers, name, "Trailer-"+name)
+		}
+	}
+	sort.Strings(trailers)
+
+	cors.AllowHeaders = mergeHeaders(cors.AllowHeaders, grpcAllowHeaders)
+	cors.ExposeHeaders = mergeHeaders(cors.ExposeHeaders, append(expose, trailers...))
+	return &cors
+}
+
+// mergeHeaders appends the header names list lacks
+func mergeHeaders(list, names []string) []string {
+	merged := append([]string(nil), list...)
+	for _, name := range names {
+		found := false
+		for _, existing := range merged {
+			if strings.EqualFold(existing, name) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			merged = append(merged, name)
+		}
+	}
+	return merged
+}
+
+// grpcProtocol is the wire protocol of a call, told apart by content type
+type grpcProtocol struct {
+	web         bool // gRPC-Web, Connect otherwise
+	enveloped   bool // Messages are framed, as in gRPC-Web and Connect streaming
+	json        bool // Protobuf JSON, binary otherwise
+	text        bool // gRPC-Web text, base64 encoded
+	contentType string
+}
+
+// detectGRPCProtocol tells the protocol of a request. Native gRPC is not
+// supported, since it needs HTTP/2 trailers.
+func detectGRPCProtocol(r *http.Request) (grpcProtocol, bool) {
+	if r.Method == http.MethodGet {
+		// Connect GET requests carry the message in the query
+		switch r.URL.Query().Get("encoding") {
+		case "json":
+			return grpcProtocol{json: true, contentType: "application/json"}, true
+		case "proto":
+			return grpcProtocol{contentType: "application/proto"}, true
+		}
+		return grpcProtocol{}, false
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	protocol := grpcProtocol{contentType: mediaType}
+	switch mediaType {
+	case "application/grpc-web", "application/grpc-web+proto":
+		protocol.web, protocol.enveloped = true, true
+	case "application/grpc-web+json":
+		protocol.web, protocol.enveloped, protocol.json = true, true, true
+	case "application/grpc-web-text", "application/grpc-web-text+proto":
+		protocol.web, protocol.enveloped, protocol.text = true, true, true
+	case "application/connect+proto":
+		protocol.enveloped = true
+	case "application/connect+json":
+		protocol.enveloped, protocol.json = true, true
+	case "application/proto":
+	case "application/json":
+		protocol.json = true
+	default:
+		return grpcProtocol{}, false
+	}
+	return protocol, true
+}
+
+// serve answers a call with the configured messages and status. Requests
+// are decoded to check them against the method's input type.
+func (g *grpcService) serve(w http.ResponseWriter, r *http.Request) {
+	protocol, ok := detectGRPCProtocol(r)
+	if !ok {
+		w.Header().Set("Accept-Post", "application/grpc-web, application/grpc-web-text, application/connect+proto, application/connect+json, application/proto, application/json")
+		http.Error(w, "Unsupported Media Type", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	// Clients call {base URL}/{package.Service}/{Method}
+	name := r.URL.Path
+	if parts := strings.Split(strings.Trim(name, "/"), "/"); len(parts) >= 2 {
+		name = parts[len(parts)-2] + "/" + parts[len(parts)-1]
+	}
+	method := g.methods[name]
+	if method == nil {
+		g.finish(w, protocol, nil, grpcStatus{code: grpcUnimplemented, message: fmt.Sprintf("unknown method %s", name)})
+		return
+	}
+	// Connect only sends methods without side effects with GET
+	options, _ := method.desc.Options().(*descriptorpb.MethodOptions)
+	if r.Method == http.MethodGet && options.GetIdempotencyLevel() != descriptorpb.MethodOptions_NO_SIDE_EFFECTS {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if status := g.readRequest(r, protocol, method.desc.Input()); status != nil {
+		g.finish(w, protocol, nil, *status)
+		return
+	}
+
+	// Unary calls answer with exactly one message, unless they fail
+	responses := method.responses
+	if !method.desc.IsStreamingServer() {
+		if method.status.code != 0 {
+			responses = nil
+		} else if len(responses) == 0 {
+			responses = []proto.Message{dynamicpb.NewMessage(method.desc.Output())}
+		}
+	}
+	messages := make([][]byte, 0, len(responses))
+	for _, response := range responses {
+		data, err := g.marshal(protocol, response)
+		if err != nil {
+			g.finish(w, protocol, nil, grpcStatus{code: grpcInternal, message: err.Error()})
+			return
+		}
+		messages = append(messages, data)
+	}
+	g.finish(w, protocol, messages, method.status)
+}
+
+// readRequest decodes the request messages, returning the status to fail
+// the call with when they are invalid
+func (g *grpcService) readRequest(r *http.Request, protocol grpcProtocol, input protoreflect.MessageDescriptor) *grpcStatus {
+	invalid := func(format string, args ...interface{}) *grpcStatus {
+		return &grpcStatus{code: grpcInvalidArgument, message: fmt.Sprintf(format, args...)}
+	}
+
+	var body []byte
+	if r.Method == http.MethodGet {
+		query := r.URL.Query()
+		if compression := query.Get("compression"); compression != "" && compression != "identity" {
+			return &grpcStatus{code: grpcUnimplemented, message: fmt.Sprintf("compression %q is not supported", compression)}
+		}
+		body = []byte(query.Get("message"))
+		if query.Get("base64") == "1" {
+			decoded, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(string(body), "="))
+			if err != nil {
+				return invalid("invalid base64 message: %v", err)
+			}
+			body = decoded
+		}
+	} else {
+		var reader io.Reader = r.Body
+		if encoding := r.Header.Get("Content-Encoding"); encoding == "gzip" && !protocol.enveloped {
+			gz, err := gzip.NewReader(r.Body)
+			if err != nil {
+				return invalid("invalid gzip body: %v", err)
+			}
+			defer gz.Close()
+			reader = gz
+		} else if encoding != "" && encoding != "identity" {
+			return &grpcStatus{code: grpcUnimplemented, message: fmt.Sprintf("content encoding %q is not supported", encoding)}
+		}
+		data, err := io.ReadAll(reader)
+		if err != nil {
+			return invalid("failed to read request: %v", err)
+		}
+		body = data
+		if protocol.text {
+			decoded, err := base64.StdEncoding.DecodeString(string(body))
+			if err != nil {
+				return invalid("invalid base64 body: %v", err)
+			}
+			body = decoded
+		}
+	}
+
+	messages := [][]byte{body}
+	if protocol.enveloped {
+		messages = nil
+		for len(body) > 0 {
+			if len(body) < 5 || uint32(len(body)-5) < binary.BigEndian.Uint32(body[1:5]) {
+				return invalid("truncated message")
+			}
+			if body[0]&flagCompressed != 0 {
+				return &grpcStatus{code: grpcUnimplemented, message: "compressed messages are not supported"}
+			}
+			length := 5 + int(binary.BigEndian.Uint32(body[1:5]))
+			messages = append(messages, body[5:length])
+			body = body[length:]
+		}
+	}
+
+	for _, data := range messages {
+		msg := dynamicpb.NewMessage(input)
+		var err error
+		if protocol.json {
+			// Connect clients may send an empty body for empty messages
+			if len(bytes.TrimSpace(data)) > 0 {
+				err = protojson.UnmarshalOptions{Resolver: g.types}.Unmarshal(data, msg)
+			}
+		} else {
+			err = proto.UnmarshalOptions{Resolver: g.types}.Unmarshal(data, msg)
+		}
+		if err != nil {
+			return invalid("invalid %s: %v", input.FullName(), err)
+		}
+	}
+	return nil
+}
+
+// marshal encodes a response message in the codec of the request
+func (g *grpcService) marshal(protocol grpcProtocol, msg proto.Message) ([]byte, error) {
+	if protocol.json {
+		return protojson.MarshalOptions{Resolver: g.types}.Marshal(msg)
+	}
+	return proto.Marshal(msg)
+}
+
+// finish writes the messages and status in the protocol of the call
+func (g *grpcService) finish(w http.ResponseWriter, protocol grpcProtocol, messages [][]byte, status grpcStatus) {
+	switch {
+	case protocol.web:
+		writeGRPCWeb(w, protocol, messages, status)
+	case protocol.enveloped:
+		writeConnectStream(w, protocol, messages, status)
+	default:
+		writeConnectUnary(w, protocol, messages, status)
+	}
+}
+
+// writeGRPCWeb frames the messages, followed by the status as trailers.
+// Calls failing without messages get a trailers-only response, with the
+// status in the headers.
+func writeGRPCWeb(w http.ResponseWriter, protocol grpcProtocol, messages [][]byte, status grpcStatus) {
+	w.Header().Set("Content-Type", protocol.contentType)
+	if len(messages) == 0 && status.code != 0 {
+		for _, field := range status.fields() {
+			w.Header().Set(field[0], field[1])
+		}
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	var body bytes.Buffer
+	for _, message := range messages {
+		body.Write(envelope(0, message))
+	}
+	var trailers bytes.Buffer
+	for _, field := range status.fields() {
+		fmt.Fprintf(&trailers, "%s: %s\r\n", field[0], field[1])
+	}
+	body.Write(envelope(flagTrailers, trailers.Bytes()))
+
+	out := body.Bytes()
+	if protocol.text {
+		out = []byte(base64.StdEncoding.EncodeToString(out))
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write(out)
+}
+
+// fields lists the status and trailers as gRPC metadata
+func (s grpcStatus) fields() [][2]string {
+	fields := [][2]string{{"grpc-status", strconv.Itoa(s.code)}}
+	if s.message != "" {
+		fields = append(fields, [2]string{"grpc-message", encodeGRPCMessage(s.message)})
+	}
+	names := make([]string, 0, len(s.trailers))
+	for name := range s.trailers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fields = append(fields, [2]string{strings.ToLower(name), s.trailers[name]})
+	}
+	return fields
+}
+
+// encodeGRPCMessage percent-encodes a status message as gRPC requires
+func encodeGRPCMessage(message string) string {
+	var b strings.Builder
+	for i := 0; i < len(message); i++ {
+		if c := message[i]; c < ' ' || c > '~' || c == '%' {
+			fmt.Fprintf(&b, "%%%02X", c)
+		} else {
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// connectError is the JSON error of Connect responses
+type connectError struct {
+	Code    string `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+// connectEndStream is the last message of Connect streaming responses
+type connectEndStream struct {
+	Error    *connectError       `json:"error,omitempty"`
+	Metadata map[string][]string `json:"metadata,omitempty"`
+}
+
+// writeConnectUnary sends the message, or the error as JSON with the
+// matching HTTP status. Trailers are sent as Trailer- headers.
+func writeConnectUnary(w http.ResponseWriter, protocol grpcProtocol, messages [][]byte, status grpcStatus) {
+	for name, value := range status.trailers {
+		w.Header().Set("Trailer-"+name, value)
+	}
+	if status.code != 0 {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(connectHTTPStatus[status.code])
+		json.NewEncoder(w).Encode(connectError{Code: config.GRPCCodes[status.code], Message: status.message})
+		return
+	}
+
+	w.Header().Set("Content-Type", protocol.contentType)
+	w.WriteHeader(http.StatusOK)
+	if len(messages) > 0 {
+		w.Write(messages[0])
+	}
+}
+
+// writeConnectStream frames the messages, followed by an end-of-stream
+// message with the error and trailers
+func writeConnectStream(w http.ResponseWriter, protocol grpcProtocol, messages [][]byte, status grpcStatus) {
+	end := connectEndStream{}
+	if status.code != 0 {
+		end.Error = &connectError{Code: config.GRPCCodes[status.code], Message: status.message}
+	}
+	if len(status.trailers) > 0 {
+		end.Metadata = make(map[string][]string, len(status.trailers))
+		for name, value := range status.trailers {
+			end.Metadata[name] = []string{value}
+		}
+	}
+	data, _ := json.Marshal(end)
+
+	var body bytes.Buffer
+	for _, message := range messages {
+		body.Write(envelope(0, message))
+	}
+	body.Write(envelope(flagEndStream, data))
+
+	w.Header().Set("Content-Type", protocol.contentType)
+	w.WriteHeader(http.StatusOK)
+	w.Write(body.Bytes())
+}
+
+// envelope frames a message with its flags and length
+func envelope(flags byte, data []byte) []byte {
+	frame := make([]byte, 5+len(data))
+	frame[0] = flags
+	binary.BigEndian.PutUint32(frame[1:5], uint32(len(data)))
+	copy(frame[5:], data)
+	return frame
+}
@@ -0,0 +1,311 @@
+package server
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+
+	"github.com/developmeh/mock-cors-server/internal/config"
+)
+
+// testGreeterFile describes
+//
+//	package acme.v1;
+//	message HelloRequest { string name = 1; }
+//	message HelloReply { string message = 1; int32 count = 2; }
+//	service Greeter {
+//	  rpc SayHello(HelloRequest) returns (HelloReply) { option idempotency_level = NO_SIDE_EFFECTS; }
+//	  rpc Fail(HelloRequest) returns (HelloReply);
+//	  rpc Watch(HelloRequest) returns (stream HelloReply);
+//	}
+func testGreeterFile() *descriptorpb.FileDescriptorProto {
+	field := func(name string, number int32, typ descriptorpb.FieldDescriptorProto_Type) *descriptorpb.FieldDescriptorProto {
+		return &descriptorpb.FieldDescriptorProto{
+			Name:     proto.String(name),
+			JsonName: proto.String(name),
+			Number:   proto.Int32(number),
+			Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+			Type:     typ.Enum(),
+		}
+	}
+	method := func(name string, stream bool) *descriptorpb.MethodDescriptorProto {
+		return &descriptorpb.MethodDescriptorProto{
+			Name:            proto.String(name),
+			InputType:       proto.String(".acme.v1.HelloRequest"),
+			OutputType:      proto.String(".acme.v1.HelloReply"),
+			ServerStreaming: proto.Bool(stream),
+		}
+	}
+	sayHello := method("SayHello", false)
+	sayHello.Options = &descriptorpb.MethodOptions{IdempotencyLevel: descriptorpb.MethodOptions_NO_SIDE_EFFECTS.Enum()}
+
+	return &descriptorpb.FileDescriptorProto{
+		Name:    proto.String("acme/v1/greeter.proto"),
+		Package: proto.String("acme.v1"),
+		Syntax:  proto.String("proto3"),
+		MessageType: []*descriptorpb.DescriptorProto{
+			{Name: proto.String("HelloRequest"), Field: []*descriptorpb.FieldDescriptorProto{field("name", 1, descriptorpb.FieldDescriptorProto_TYPE_STRING)}},
+			{Name: proto.String("HelloReply"), Field: []*descriptorpb.FieldDescriptorProto{
+				field("message", 1, descriptorpb.FieldDescriptorProto_TYPE_STRING),
+				field("count", 2, descriptorpb.FieldDescriptorProto_TYPE_INT32),
+			}},
+		},
+		Service: []*descriptorpb.ServiceDescriptorProto{{
+			Name:   proto.String("Greeter"),
+			Method: []*descriptorpb.MethodDescriptorProto{sayHello, method("Fail", false), method("Watch", true)},
+		}},
+	}
+}
+
+// writeTestDescriptorSet writes the greeter descriptor set to a file
+func writeTestDescriptorSet(t *testing.T) string {
+	t.Helper()
+	data, err := proto.Marshal(&descriptorpb.FileDescriptorSet{File: []*descriptorpb.FileDescriptorProto{testGreeterFile()}})
+	if err != nil {
+		t.Fatalf("Failed to marshal descriptor set: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "greeter.binpb")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatalf("Failed to write descriptor set: %v", err)
+	}
+	return path
+}
+
+// testMessage returns the descriptor of a message of the greeter file
+func testMessage(t *testing.T, name protoreflect.Name) protoreflect.MessageDescriptor {
+	t.Helper()
+	fd, err := protodesc.NewFile(testGreeterFile(), nil)
+	if err != nil {
+		t.Fatalf("Invalid test file: %v", err)
+	}
+	return fd.Messages().ByName(name)
+}
+
+// frames splits an enveloped body into its flags and messages
+func frames(t *testing.T, body []byte) ([]byte, [][]byte) {
+	t.Helper()
+	var flags []byte
+	var messages [][]byte
+	for len(body) > 0 {
+		if len(body) < 5 {
+			t.Fatalf("Truncated frame: %q", body)
+		}
+		length := 5 + int(binary.BigEndian.Uint32(body[1:5]))
+		flags = append(flags, body[0])
+		messages = append(messages, body[5:length])
+		body = body[length:]
+	}
+	return flags, messages
+}
+
+func TestNewGRPCService(t *testing.T) {
+	descriptorSet := writeTestDescriptorSet(t)
+	route := func(rpcs ...config.GRPCMethod) config.Route {
+		return config.Route{Path: "/", Type: "grpc", DescriptorSet: descriptorSet, RPCs: rpcs}
+	}
+
+	service, err := newGRPCService(route(config.GRPCMethod{Method: "acme.v1.Greeter/Watch", Responses: []string{`{"count": 1}`, `{"count": 2}`}}))
+	if err != nil {
+		t.Fatalf("Expected service, got %v", err)
+	}
+	if len(service.methods) != 3 || len(service.methods["acme.v1.Greeter/Watch"].responses) != 2 {
+		t.Errorf("Unexpected methods: %v", service.methods)
+	}
+
+	tests := []struct {
+		name         string
+		route        config.Route
+		expectedText string
+	}{
+		{"missing descriptor set", config.Route{Path: "/", Type: "grpc"}, "descriptor_set is required"},
+		{"unreadable descriptor set", config.Route{Path: "/", Type: "grpc", DescriptorSet: "missing.binpb"}, "failed to read"},
+		{"unknown method", route(config.GRPCMethod{Method: "acme.v1.Greeter/Nope"}), "unknown method"},
+		{"several unary responses", route(config.GRPCMethod{Method: "acme.v1.Greeter/SayHello", Responses: []string{"{}", "{}"}}), "at most one response"},
+		{"unknown field", route(config.GRPCMethod{Method: "acme.v1.Greeter/SayHello", Responses: []string{`{"nope": 1}`}}), "invalid acme.v1.HelloReply"},
+		{"unknown code", route(config.GRPCMethod{Method: "acme.v1.Greeter/Fail", Code: "oops"}), "unknown status code"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := newGRPCService(tt.route)
+			if err == nil || !strings.Contains(err.Error(), tt.expectedText) {
+				t.Errorf("Expected error containing %q, got %v", tt.expectedText, err)
+			}
+		})
+	}
+}
+
+func TestGRPCRoute(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.Routes = []config.Route{{Path: "/rpc/", Type: "grpc", DescriptorSet: writeTestDescriptorSet(t), RPCs: []config.GRPCMethod{
+		{Method: "acme.v1.Greeter/SayHello", Responses: []string{`{"message": "Hello", "count": 2}`}, Trailers: map[string]string{"x-request-id": "abc"}},
+		{Method: "acme.v1.Greeter/Fail", Code: "NOT_FOUND", Message: "no user named Zoë"},
+		{Method: "acme.v1.Greeter/Watch", Responses: []string{`{"count": 1}`, `{"count": 2}`}, Code: "unavailable"},
+	}}}
+	server := New(cfg)
+	if err := server.setupRoutes(); err != nil {
+		t.Fatalf("Expected routes to be set up, got %v", err)
+	}
+
+	call := func(method, path, contentType string, body []byte) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(string(body)))
+		req.Header.Set("Origin", "http://localhost:3000")
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+		w := httptest.NewRecorder()
+		server.mux.ServeHTTP(w, req)
+		return w
+	}
+	request, _ := proto.Marshal(dynamicpb.NewMessage(testMessage(t, "HelloRequest")))
+	reply := testMessage(t, "HelloReply")
+	decode := func(t *testing.T, data []byte) string {
+		t.Helper()
+		msg := dynamicpb.NewMessage(reply)
+		if err := proto.Unmarshal(data, msg); err != nil {
+			t.Fatalf("Invalid reply: %v", err)
+		}
+		encoded, _ := protojson.Marshal(msg)
+		return compactJSON(t, encoded)
+	}
+
+	t.Run("grpc-web", func(t *testing.T) {
+		w := call(http.MethodPost, "/rpc/acme.v1.Greeter/SayHello", "application/grpc-web+proto", envelope(0, request))
+		if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "application/grpc-web+proto" {
+			t.Fatalf("Unexpected response: %d %v", w.Code, w.Header())
+		}
+		if expose := w.Header().Get("Access-Control-Expose-Headers"); !strings.Contains(expose, "Grpc-Status, Grpc-Message") || !strings.Contains(expose, "x-request-id") {
+			t.Errorf("Expected the status and trailers exposed, got %q", expose)
+		}
+		flags, messages := frames(t, w.Body.Bytes())
+		if len(flags) != 2 || flags[0] != 0 || flags[1] != flagTrailers {
+			t.Fatalf("Expected a message and trailers, got flags %v", flags)
+		}
+		if got := decode(t, messages[0]); got != `{"message":"Hello","count":2}` {
+			t.Errorf("Unexpected reply: %s", got)
+		}
+		if string(messages[1]) != "grpc-status: 0\r\nx-request-id: abc\r\n" {
+			t.Errorf("Unexpected trailers: %q", messages[1])
+		}
+	})
+
+	t.Run("grpc-web-text", func(t *testing.T) {
+		body := base64.StdEncoding.EncodeToString(envelope(0, request))
+		w := call(http.MethodPost, "/rpc/acme.v1.Greeter/SayHello", "application/grpc-web-text", []byte(body))
+		decoded, err := base64.StdEncoding.DecodeString(w.Body.String())
+		if err != nil {
+			t.Fatalf("Expected a base64 body, got %q", w.Body.String())
+		}
+		if _, messages := frames(t, decoded); len(messages) != 2 || decode(t, messages[0]) != `{"message":"Hello","count":2}` {
+			t.Errorf("Unexpected messages: %q", messages)
+		}
+	})
+
+	t.Run("grpc-web error", func(t *testing.T) {
+		w := call(http.MethodPost, "/rpc/acme.v1.Greeter/Fail", "application/grpc-web", envelope(0, request))
+		// Trailers-only responses carry the status in the headers
+		if w.Code != http.StatusOK || w.Header().Get("Grpc-Status") != "5" || w.Header().Get("Grpc-Message") != "no user named Zo%C3%AB" || w.Body.Len() != 0 {
+			t.Errorf("Unexpected response: %d %v %q", w.Code, w.Header(), w.Body.String())
+		}
+	})
+
+	t.Run("grpc-web stream", func(t *testing.T) {
+		w := call(http.MethodPost, "/rpc/acme.v1.Greeter/Watch", "application/grpc-web+json", envelope(0, []byte(`{"name": "Ada"}`)))
+		flags, messages := frames(t, w.Body.Bytes())
+		if len(flags) != 3 || compactJSON(t, messages[1]) != `{"count":2}` || string(messages[2]) != "grpc-status: 14\r\n" {
+			t.Errorf("Unexpected frames: %v %q", flags, messages)
+		}
+	})
+
+	t.Run("connect unary", func(t *testing.T) {
+		w := call(http.MethodPost, "/rpc/acme.v1.Greeter/SayHello", "application/json", []byte(`{"name": "Ada"}`))
+		if w.Code != http.StatusOK || w.Header().Get("Trailer-X-Request-Id") != "abc" || compactJSON(t, w.Body.Bytes()) != `{"message":"Hello","count":2}` {
+			t.Errorf("Unexpected response: %d %v %q", w.Code, w.Header(), w.Body.String())
+		}
+
+		w = call(http.MethodPost, "/rpc/acme.v1.Greeter/SayHello", "application/proto", request)
+		if w.Header().Get("Content-Type") != "application/proto" || decode(t, w.Body.Bytes()) != `{"message":"Hello","count":2}` {
+			t.Errorf("Unexpected response: %v %q", w.Header(), w.Body.String())
+		}
+	})
+
+	t.Run("connect error", func(t *testing.T) {
+		w := call(http.MethodPost, "/rpc/acme.v1.Greeter/Fail", "application/json", nil)
+		if w.Code != http.StatusNotFound || strings.TrimSpace(w.Body.String()) != `{"code":"not_found","message":"no user named Zoë"}` {
+			t.Errorf("Unexpected response: %d %q", w.Code, w.Body.String())
+		}
+	})
+
+	t.Run("connect stream", func(t *testing.T) {
+		w := call(http.MethodPost, "/rpc/acme.v1.Greeter/Watch", "application/connect+json", envelope(0, []byte(`{}`)))
+		flags, messages := frames(t, w.Body.Bytes())
+		if len(flags) != 3 || flags[2] != flagEndStream || string(messages[2]) != `{"error":{"code":"unavailable"}}` {
+			t.Errorf("Unexpected frames: %v %q", flags, messages)
+		}
+	})
+
+	t.Run("connect get", func(t *testing.T) {
+		query := url.Values{"connect": {"v1"}, "encoding": {"json"}, "message": {`{"name":"Ada"}`}}
+		if w := call(http.MethodGet, "/rpc/acme.v1.Greeter/SayHello?"+query.Encode(), "", nil); w.Code != http.StatusOK {
+			t.Errorf("Expected 200, got %d %q", w.Code, w.Body.String())
+		}
+		if w := call(http.MethodGet, "/rpc/acme.v1.Greeter/Fail?"+query.Encode(), "", nil); w.Code != http.StatusMethodNotAllowed {
+			t.Errorf("Expected 405 for methods with side effects, got %d", w.Code)
+		}
+	})
+
+	t.Run("invalid request", func(t *testing.T) {
+		w := call(http.MethodPost, "/rpc/acme.v1.Greeter/SayHello", "application/json", []byte(`{"nope": 1}`))
+		if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), `"code":"invalid_argument"`) {
+			t.Errorf("Unexpected response: %d %q", w.Code, w.Body.String())
+		}
+	})
+
+	t.Run("unknown method", func(t *testing.T) {
+		w := call(http.MethodPost, "/rpc/acme.v1.Greeter/Nope", "application/grpc-web", envelope(0, request))
+		if w.Header().Get("Grpc-Status") != "12" {
+			t.Errorf("Expected unimplemented, got %v", w.Header())
+		}
+	})
+
+	t.Run("native grpc", func(t *testing.T) {
+		if w := call(http.MethodPost, "/rpc/acme.v1.Greeter/SayHello", "application/grpc", envelope(0, request)); w.Code != http.StatusUnsupportedMediaType {
+			t.Errorf("Expected 415, got %d", w.Code)
+		}
+	})
+
+	t.Run("preflight", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodOptions, "/rpc/acme.v1.Greeter/SayHello", nil)
+		req.Header.Set("Origin", "http://localhost:3000")
+		req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+		w := httptest.NewRecorder()
+		server.mux.ServeHTTP(w, req)
+		if allow := w.Header().Get("Access-Control-Allow-Headers"); !strings.Contains(allow, "X-Grpc-Web") || !strings.Contains(allow, "Connect-Protocol-Version") {
+			t.Errorf("Expected gRPC headers allowed, got %q", allow)
+		}
+	})
+}
+
+// compactJSON removes the whitespace protojson varies between runs
+func compactJSON(t *testing.T, data []byte) string {
+	t.Helper()
+	var value json.RawMessage
+	if err := json.Unmarshal(data, &value); err != nil {
+		t.Fatalf("Invalid JSON %q: %v", data, err)
+	}
+	compact, _ := json.Marshal(value)
+	return string(compact)
+}
@@ -0,0 +1,367 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/developmeh/mock-cors-server/internal/config"
+	"github.com/developmeh/mock-cors-server/internal/har"
+)
+
+// maxRecordedBody bounds the request and response bodies kept per entry
+const maxRecordedBody = 1 << 20
+
+// harRecorder keeps the requests the server handled, with their responses,
+// for export as an HTTP Archive
+type harRecorder struct {
+	mu         sync.Mutex
+	entries    []har.Entry
+	maxEntries int // 0 keeps every entry
+}
+
+// newHARRecorder creates a recorder keeping at most maxEntries entries
+func newHARRecorder(maxEntries int) *harRecorder {
+	return &harRecorder{maxEntries: maxEntries}
+}
+
+// middleware records every request except those for the admin endpoints
+func (rec *harRecorder) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, config.AdminPrefix) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		start := time.Now()
+
+		// Keep a copy of the request body, leaving it readable for the handler
+		var body []byte
+		if r.Body != nil && r.Body != http.NoBody {
+			body, _ = io.ReadAll(io.LimitReader(r.Body, maxRecordedBody))
+			r.Body = struct {
+				io.Reader
+				io.Closer
+			}{io.MultiReader(bytes.NewReader(body), r.Body), r.Body}
+		}
+
+		// WebSocket handlers add the messages of the connection
+		messages := &webSocketMessages{}
+		r = r.WithContext(context.WithValue(r.Context(), webSocketMessagesContextKey{}, messages))
+
+		rw := &recordingWriter{ResponseWriter: w}
+		next.ServeHTTP(rw, r)
+
+		entry := newEntry(r, body, rw, start, time.Now())
+		if rw.hijacked && strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+			entry.ResourceType = "websocket"
+			entry.WebSocketMessages = messages.list()
+		}
+		rec.add(entry)
+	})
+}
+
+// webSocketMessagesContextKey is the context key holding the messages of a
+// recorded WebSocket connection
+type webSocketMessagesContextKey struct{}
+
+// webSocketMessages collects the messages of a WebSocket connection
+type webSocketMessages struct {
+	mu       sync.Mutex
+	messages []har.WebSocketMessage
+}
+
+// list returns the collected messages
+func (m *webSocketMessages) list() []har.WebSocketMessage {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]har.WebSocketMessage(nil), m.messages...)
+}
+
+// recordWebSocketMessage adds a message to the recording of the connection
+// of a request, when it is recorded, returning a function removing it again.
+// Binary data is base64 encoded, as browsers do.
+func recordWebSocketMessage(r *http.Request, fromClient bool, opcode int, data []byte) func() {
+	m, _ := r.Context().Value(webSocketMessagesContextKey{}).(*webSocketMessages)
+	if m == nil {
+		return func() {}
+	}
+
+	message := har.WebSocketMessage{
+		Type:   "receive",
+		Time:   float64(time.Now().UnixMicro()) / 1e6,
+		Opcode: opcode,
+		Data:   string(data),
+	}
+	if fromClient {
+		message.Type = "send"
+	}
+	if opcode != 1 {
+		message.Data = base64.StdEncoding.EncodeToString(data)
+	}
+
+	m.mu.Lock()
+	m.messages = append(m.messages, message)
+	m.mu.Unlock()
+
+	return func() {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		for i := len(m.messages) - 1; i >= 0; i-- {
+			if m.messages[i] == message {
+				m.messages = append(m.messages[:i], m.messages[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// add appends an entry, dropping the oldest beyond the limit
+func (rec *harRecorder) add(entry har.Entry) {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+
+	rec.entries = append(rec.entries, entry)
+	if rec.maxEntries > 0 && len(rec.entries) > rec.maxEntries {
+		rec.entries = append([]har.Entry(nil), rec.entries[len(rec.entries)-rec.maxEntries:]...)
+	}
+}
+
+// reset drops every entry
+func (rec *harRecorder) reset() {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	rec.entries = nil
+}
+
+// archive returns the recorded entries as a HAR document
+func (rec *harRecorder) archive() *har.HAR {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+
+	entries := append([]har.Entry{}, rec.entries...)
+	return &har.HAR{Log: har.Log{
+		Version: har.Version,
+		Creator: har.Creator{Name: "mock-cors-server", Version: buildVersion()},
+		Entries: entries,
+	}}
+}
+
+// writeFile writes the recorded entries to a HAR file
+func (rec *harRecorder) writeFile(file string) (int, error) {
+	archive := rec.archive()
+
+	var buf bytes.Buffer
+	if err := archive.Encode(&buf); err != nil {
+		return 0, err
+	}
+	if err := os.WriteFile(file, buf.Bytes(), 0644); err != nil {
+		return 0, fmt.Errorf("failed to write HAR file: %w", err)
+	}
+	return len(archive.Log.Entries), nil
+}
+
+// buildVersion returns the module version of the running binary
+func buildVersion() string {
+	if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" {
+		return info.Main.Version
+	}
+	return "(devel)"
+}
+
+// recordingWriter passes a response through while keeping its status,
+// size and the start of its body
+type recordingWriter struct {
+	http.ResponseWriter
+	status    int
+	body      bytes.Buffer
+	size      int64
+	firstByte time.Time
+	hijacked  bool
+}
+
+// WriteHeader records the status
+func (rw *recordingWriter) WriteHeader(status int) {
+	if rw.status == 0 {
+		rw.status = status
+		rw.firstByte = time.Now()
+	}
+	rw.ResponseWriter.WriteHeader(status)
+}
+
+// Write records the body, up to maxRecordedBody
+func (rw *recordingWriter) Write(data []byte) (int, error) {
+	if rw.status == 0 {
+		rw.WriteHeader(http.StatusOK)
+	}
+	if room := maxRecordedBody - rw.body.Len(); room > 0 {
+		rw.body.Write(data[:min(room, len(data))])
+	}
+	n, err := rw.ResponseWriter.Write(data)
+	rw.size += int64(n)
+	return n, err
+}
+
+// Flush sends buffered data to the client, for streaming responses
+func (rw *recordingWriter) Flush() {
+	if rw.status == 0 {
+		rw.WriteHeader(http.StatusOK)
+	}
+	if f, ok := rw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack hands the connection over, for WebSocket upgrades
+func (rw *recordingWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := rw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, http.ErrNotSupported
+	}
+	conn, buf, err := h.Hijack()
+	if err == nil {
+		rw.hijacked = true
+		rw.firstByte = time.Now()
+	}
+	return conn, buf, err
+}
+
+// Unwrap returns the underlying writer, for http.ResponseController
+func (rw *recordingWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
+// newEntry describes a handled request as a HAR entry
+func newEntry(r *http.Request, body []byte, rw *recordingWriter, start, end time.Time) har.Entry {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+
+	request := har.Request{
+		Method:      r.Method,
+		URL:         scheme + "://" + r.Host + r.URL.RequestURI(),
+		HTTPVersion: r.Proto,
+		Cookies:     []har.Cookie{},
+		Headers:     nameValues(r.Header),
+		QueryString: nameValues(r.URL.Query()),
+		HeadersSize: -1,
+		BodySize:    int64(len(body)),
+	}
+	for _, c := range r.Cookies() {
+		request.Cookies = append(request.Cookies, har.Cookie{Name: c.Name, Value: c.Value})
+	}
+	if len(body) > 0 {
+		request.PostData = &har.PostData{MimeType: r.Header.Get("Content-Type")}
+		if utf8.Valid(body) {
+			request.PostData.Text = string(body)
+		} else {
+			request.PostData.Comment = "binary body not recorded"
+		}
+	}
+
+	status := rw.status
+	if rw.hijacked {
+		status = http.StatusSwitchingProtocols
+	} else if status == 0 {
+		status = http.StatusOK
+	}
+
+	header := rw.Header()
+	response := har.Response{
+		Status:      status,
+		StatusText:  http.StatusText(status),
+		HTTPVersion: r.Proto,
+		Cookies:     []har.Cookie{},
+		Headers:     nameValues(header),
+		Content: har.Content{
+			Size:     rw.size,
+			MimeType: header.Get("Content-Type"),
+		},
+		RedirectURL: header.Get("Location"),
+		HeadersSize: -1,
+		BodySize:    rw.size,
+	}
+	for _, c := range (&http.Response{Header: header}).Cookies() {
+		cookie := har.Cookie{Name: c.Name, Value: c.Value, Path: c.Path, Domain: c.Domain, HTTPOnly: c.HttpOnly, Secure: c.Secure}
+		if !c.Expires.IsZero() {
+			cookie.Expires = c.Expires.UTC().Format(time.RFC3339)
+		}
+		response.Cookies = append(response.Cookies, cookie)
+	}
+	if recorded := rw.body.Bytes(); len(recorded) > 0 {
+		// HAR content is the decoded body; compression counts the bytes saved
+		if encoding := header.Get("Content-Encoding"); encoding != "" && int64(len(recorded)) == rw.size {
+			if decoded, err := decodeBody(encoding, recorded); err == nil {
+				recorded = decoded
+				response.Content.Size = int64(len(decoded))
+				response.Content.Compression = response.Content.Size - rw.size
+			}
+		}
+		if utf8.Valid(recorded) {
+			response.Content.Text = string(recorded)
+		} else {
+			response.Content.Text = base64.StdEncoding.EncodeToString(recorded)
+			response.Content.Encoding = "base64"
+		}
+		if rw.body.Len() < int(rw.size) {
+			response.Content.Comment = fmt.Sprintf("body truncated to %d bytes", len(recorded))
+		}
+	}
+
+	// The server sees no DNS, connect or TLS phases of its own
+	firstByte := rw.firstByte
+	if firstByte.IsZero() {
+		firstByte = end
+	}
+	timings := har.Timings{
+		Blocked: -1,
+		DNS:     -1,
+		Connect: -1,
+		SSL:     -1,
+		Wait:    milliseconds(firstByte.Sub(start)),
+		Receive: milliseconds(end.Sub(firstByte)),
+	}
+
+	return har.Entry{
+		StartedDateTime: start,
+		Time:            timings.Wait + timings.Receive,
+		Request:         request,
+		Response:        response,
+		Timings:         timings,
+	}
+}
+
+// nameValues lists headers or query parameters sorted by name
+func nameValues(values map[string][]string) []har.NameValue {
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	list := []har.NameValue{}
+	for _, name := range names {
+		for _, value := range values[name] {
+			list = append(list, har.NameValue{Name: name, Value: value})
+		}
+	}
+	return list
+}
+
+// milliseconds converts a duration to the fractional milliseconds HAR uses
+func milliseconds(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
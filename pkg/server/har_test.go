@@ -0,0 +1,135 @@
+package server
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHARRecorder(t *testing.T) {
+	rec := newHARRecorder(2)
+	handler := rec.middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		switch r.URL.Path {
+		case "/echo":
+			http.SetCookie(w, &http.Cookie{Name: "session", Value: "abc", HttpOnly: true})
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusCreated)
+			w.Write(body)
+		case "/binary":
+			w.Header().Set("Content-Type", "image/png")
+			w.Write([]byte{0x89, 'P', 'N', 'G', 0xff})
+		default:
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+
+	serve := func(req *http.Request) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/echo?debug=1", strings.NewReader(`{"a": 1}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.AddCookie(&http.Cookie{Name: "token", Value: "t"})
+	if w := serve(req); w.Body.String() != `{"a": 1}` {
+		t.Fatalf("Expected the handler to read the body, got %q", w.Body.String())
+	}
+
+	entries := rec.archive().Log.Entries
+	if len(entries) != 1 {
+		t.Fatalf("Expected 1 entry, got %d", len(entries))
+	}
+	entry := entries[0]
+
+	if entry.Request.Method != http.MethodPost || entry.Request.URL != "http://example.com/echo?debug=1" {
+		t.Errorf("Unexpected request: %s %s", entry.Request.Method, entry.Request.URL)
+	}
+	if entry.Request.PostData == nil || entry.Request.PostData.Text != `{"a": 1}` || entry.Request.PostData.MimeType != "application/json" {
+		t.Errorf("Unexpected post data: %+v", entry.Request.PostData)
+	}
+	if len(entry.Request.QueryString) != 1 || entry.Request.QueryString[0].Value != "1" {
+		t.Errorf("Unexpected query string: %+v", entry.Request.QueryString)
+	}
+	if len(entry.Request.Cookies) != 1 || entry.Request.Cookies[0].Name != "token" {
+		t.Errorf("Unexpected request cookies: %+v", entry.Request.Cookies)
+	}
+
+	if entry.Response.Status != http.StatusCreated || entry.Response.StatusText != "Created" {
+		t.Errorf("Unexpected status: %d %s", entry.Response.Status, entry.Response.StatusText)
+	}
+	if entry.Response.Content.Text != `{"a": 1}` || entry.Response.Content.Size != 8 || entry.Response.Content.MimeType != "application/json" {
+		t.Errorf("Unexpected content: %+v", entry.Response.Content)
+	}
+	if len(entry.Response.Cookies) != 1 || !entry.Response.Cookies[0].HTTPOnly {
+		t.Errorf("Unexpected response cookies: %+v", entry.Response.Cookies)
+	}
+	if entry.Timings.DNS != -1 || entry.Time < 0 {
+		t.Errorf("Unexpected timings: %+v", entry.Timings)
+	}
+
+	t.Run("binary body", func(t *testing.T) {
+		serve(httptest.NewRequest(http.MethodGet, "/binary", nil))
+		entries := rec.archive().Log.Entries
+		content := entries[len(entries)-1].Response.Content
+		if content.Encoding != "base64" || content.Text != "iVBOR/8=" {
+			t.Errorf("Expected a base64 body, got %+v", content)
+		}
+	})
+
+	t.Run("compressed body", func(t *testing.T) {
+		rec := newHARRecorder(0)
+		text := strings.Repeat("compressed ", 200)
+		handler := rec.middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			cw := &compressWriter{ResponseWriter: w, encoding: "gzip"}
+			cw.Header().Set("Content-Type", "text/plain")
+			cw.Write([]byte(text))
+			cw.Close()
+		}))
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/text", nil))
+
+		content := rec.archive().Log.Entries[0].Response.Content
+		if content.Text != text || content.Size != int64(len(text)) || content.Compression <= 0 {
+			t.Errorf("Expected the decoded body with the bytes saved, got size %d, compression %d", content.Size, content.Compression)
+		}
+	})
+
+	t.Run("oldest entries dropped", func(t *testing.T) {
+		serve(httptest.NewRequest(http.MethodDelete, "/other", nil))
+		entries := rec.archive().Log.Entries
+		if len(entries) != 2 || entries[0].Request.URL != "http://example.com/binary" {
+			t.Errorf("Expected the last 2 entries, got %d", len(entries))
+		}
+	})
+
+	t.Run("admin requests are not recorded", func(t *testing.T) {
+		serve(httptest.NewRequest(http.MethodGet, "/__admin/har", nil))
+		entries := rec.archive().Log.Entries
+		if entries[len(entries)-1].Request.URL == "http://example.com/__admin/har" {
+			t.Error("Expected admin requests to be left out")
+		}
+	})
+}
+
+func TestRecordWebSocketMessage(t *testing.T) {
+	messages := &webSocketMessages{}
+	r := httptest.NewRequest(http.MethodGet, "/ws", nil)
+	r = r.WithContext(context.WithValue(r.Context(), webSocketMessagesContextKey{}, messages))
+
+	recordWebSocketMessage(r, true, 1, []byte("hello"))
+	drop := recordWebSocketMessage(r, false, 2, []byte{0xff})
+	recordWebSocketMessage(r, false, 1, []byte("bye"))
+	drop()
+
+	got := messages.list()
+	if len(got) != 2 || got[0].Type != "send" || got[0].Data != "hello" || got[1].Type != "receive" || got[1].Data != "bye" {
+		t.Errorf("Expected the dropped message removed, got %+v", got)
+	}
+
+	// Requests that are not recorded are ignored
+	recordWebSocketMessage(httptest.NewRequest(http.MethodGet, "/ws", nil), true, 1, []byte("x"))()
+}
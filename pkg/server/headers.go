@@ -0,0 +1,181 @@
+package server
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/developmeh/mock-cors-server/internal/config"
+)
+
+// headerGuard rejects requests that lack required headers or carry unknown API keys
+type headerGuard struct {
+	rules  []headerRule
+	apiKey *apiKeyRule
+}
+
+// headerRule is a compiled HeaderRequirement
+type headerRule struct {
+	name          string
+	values        []string
+	pattern       *regexp.Regexp
+	missingStatus int
+	invalidStatus int
+	body          string
+}
+
+// apiKeyRule is a compiled APIKeyConfig
+type apiKeyRule struct {
+	header        string
+	keys          map[string]bool
+	missingStatus int
+	invalidStatus int
+	body          string
+}
+
+// newHeaderGuard compiles the header requirements of a route
+func newHeaderGuard(cfg *config.RequireHeadersConfig) (*headerGuard, error) {
+	missingStatus := statusOrDefault(cfg.MissingStatus, http.StatusBadRequest)
+	invalidStatus := statusOrDefault(cfg.InvalidStatus, http.StatusForbidden)
+
+	guard := &headerGuard{}
+	for _, req := range cfg.Headers {
+		if req.Name == "" {
+			return nil, fmt.Errorf("require_headers entry is missing a name")
+		}
+
+		rule := headerRule{
+			name:          req.Name,
+			values:        req.Values,
+			missingStatus: statusOrDefault(req.MissingStatus, missingStatus),
+			invalidStatus: statusOrDefault(req.InvalidStatus, invalidStatus),
+			body:          req.Body,
+		}
+		if rule.body == "" {
+			rule.body = cfg.Body
+		}
+		if req.Pattern != "" {
+			pattern, err := regexp.Compile(req.Pattern)
+			if err != nil {
+				return nil, fmt.Errorf("invalid pattern for header %s: %w", req.Name, err)
+			}
+			rule.pattern = pattern
+		}
+		guard.rules = append(guard.rules, rule)
+	}
+
+	if cfg.APIKey != nil {
+		if cfg.APIKey.Header == "" || cfg.APIKey.File == "" {
+			return nil, fmt.Errorf("api_key requires both header and file")
+		}
+		keys, err := loadAPIKeys(cfg.APIKey.File)
+		if err != nil {
+			return nil, err
+		}
+		guard.apiKey = &apiKeyRule{
+			header:        cfg.APIKey.Header,
+			keys:          keys,
+			missingStatus: statusOrDefault(cfg.APIKey.MissingStatus, http.StatusUnauthorized),
+			invalidStatus: statusOrDefault(cfg.APIKey.InvalidStatus, http.StatusForbidden),
+			body:          cfg.APIKey.Body,
+		}
+		if guard.apiKey.body == "" {
+			guard.apiKey.body = cfg.Body
+		}
+	}
+
+	return guard, nil
+}
+
+// check validates the request headers, writing an error response on mismatch
+func (g *headerGuard) check(w http.ResponseWriter, r *http.Request) bool {
+	for _, rule := range g.rules {
+		values := r.Header.Values(rule.name)
+		if len(values) == 0 {
+			writeHeaderError(w, rule.missingStatus, rule.body, "missing_header", rule.name,
+				fmt.Sprintf("required header %s is missing", rule.name))
+			return false
+		}
+
+		value := values[0]
+		if len(rule.values) > 0 && !contains(rule.values, value) {
+			writeHeaderError(w, rule.invalidStatus, rule.body, "invalid_header", rule.name,
+				fmt.Sprintf("header %s must be one of: %s", rule.name, joinStrings(rule.values)))
+			return false
+		}
+		if rule.pattern != nil && !rule.pattern.MatchString(value) {
+			writeHeaderError(w, rule.invalidStatus, rule.body, "invalid_header", rule.name,
+				fmt.Sprintf("header %s must match %s", rule.name, rule.pattern.String()))
+			return false
+		}
+	}
+
+	if g.apiKey != nil {
+		key := r.Header.Get(g.apiKey.header)
+		if key == "" {
+			writeHeaderError(w, g.apiKey.missingStatus, g.apiKey.body, "missing_api_key", g.apiKey.header,
+				fmt.Sprintf("API key header %s is missing", g.apiKey.header))
+			return false
+		}
+		if !g.apiKey.keys[key] {
+			writeHeaderError(w, g.apiKey.invalidStatus, g.apiKey.body, "invalid_api_key", g.apiKey.header,
+				fmt.Sprintf("API key in header %s is not recognized", g.apiKey.header))
+			return false
+		}
+	}
+
+	return true
+}
+
+// loadAPIKeys reads one key per line, ignoring blank lines, comments and
+// anything after the first whitespace (so keys can carry a label)
+func loadAPIKeys(path string) (map[string]bool, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading API key file: %w", err)
+	}
+	defer file.Close()
+
+	keys := make(map[string]bool)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		keys[strings.Fields(line)[0]] = true
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading API key file: %w", err)
+	}
+	return keys, nil
+}
+
+// writeHeaderError writes the configured body, or a JSON description of the failure
+func writeHeaderError(w http.ResponseWriter, status int, body, code, header, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	if body != "" {
+		w.Write([]byte(body))
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]string{
+		"error":   code,
+		"header":  header,
+		"message": message,
+	})
+}
+
+// statusOrDefault returns status, or fallback when it is unset
+func statusOrDefault(status, fallback int) int {
+	if status == 0 {
+		return fallback
+	}
+	return status
+}
@@ -0,0 +1,190 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/developmeh/mock-cors-server/internal/config"
+)
+
+func TestHeaderGuard(t *testing.T) {
+	keyFile, err := os.CreateTemp("", "keys*.txt")
+	if err != nil {
+		t.Fatalf("Failed to create temp file: %v", err)
+	}
+	defer os.Remove(keyFile.Name())
+	keyFile.WriteString("# integrator keys\nkey-acme   Acme Corp\n\nkey-globex\n")
+	keyFile.Close()
+
+	guard, err := newHeaderGuard(&config.RequireHeadersConfig{
+		Headers: []config.HeaderRequirement{
+			{Name: "site-token", Pattern: "^st_[a-z0-9]+$"},
+			{Name: "placement-id", Values: []string{"header", "footer"}, InvalidStatus: http.StatusUnprocessableEntity},
+		},
+		APIKey: &config.APIKeyConfig{
+			Header: "integrator-id",
+			File:   keyFile.Name(),
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create header guard: %v", err)
+	}
+
+	valid := map[string]string{
+		"site-token":    "st_abc123",
+		"placement-id":  "footer",
+		"integrator-id": "key-acme",
+	}
+
+	tests := []struct {
+		name           string
+		override       map[string]string
+		remove         string
+		expectedStatus int
+		expectedError  string
+	}{
+		{
+			name:           "all headers valid",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "missing header",
+			remove:         "site-token",
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  "missing_header",
+		},
+		{
+			name:           "pattern mismatch",
+			override:       map[string]string{"site-token": "nope"},
+			expectedStatus: http.StatusForbidden,
+			expectedError:  "invalid_header",
+		},
+		{
+			name:           "value not allowed with per-header status",
+			override:       map[string]string{"placement-id": "sidebar"},
+			expectedStatus: http.StatusUnprocessableEntity,
+			expectedError:  "invalid_header",
+		},
+		{
+			name:           "missing API key",
+			remove:         "integrator-id",
+			expectedStatus: http.StatusUnauthorized,
+			expectedError:  "missing_api_key",
+		},
+		{
+			name:           "unknown API key",
+			override:       map[string]string{"integrator-id": "Acme"},
+			expectedStatus: http.StatusForbidden,
+			expectedError:  "invalid_api_key",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/test", nil)
+			for name, value := range valid {
+				if name != tt.remove {
+					req.Header.Set(name, value)
+				}
+			}
+			for name, value := range tt.override {
+				req.Header.Set(name, value)
+			}
+			w := httptest.NewRecorder()
+
+			ok := guard.check(w, req)
+			if ok != (tt.expectedStatus == http.StatusOK) {
+				t.Fatalf("Expected ok=%v, got %v", tt.expectedStatus == http.StatusOK, ok)
+			}
+			if ok {
+				return
+			}
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+
+			var body map[string]string
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatalf("Expected JSON error body, got error: %v", err)
+			}
+			if body["error"] != tt.expectedError {
+				t.Errorf("Expected error %s, got %s", tt.expectedError, body["error"])
+			}
+		})
+	}
+}
+
+func TestHeaderGuardCustomBody(t *testing.T) {
+	guard, err := newHeaderGuard(&config.RequireHeadersConfig{
+		Headers:       []config.HeaderRequirement{{Name: "client-id"}},
+		MissingStatus: http.StatusUnauthorized,
+		Body:          `{"code": "CLIENT_ID_REQUIRED"}`,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create header guard: %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	guard.check(w, httptest.NewRequest(http.MethodGet, "/test", nil))
+
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status 401, got %d", w.Code)
+	}
+	if w.Body.String() != `{"code": "CLIENT_ID_REQUIRED"}` {
+		t.Errorf("Expected configured body, got %s", w.Body.String())
+	}
+}
+
+func TestHeaderGuardSharedBody(t *testing.T) {
+	keyFile := filepath.Join(t.TempDir(), "keys.txt")
+	if err := os.WriteFile(keyFile, []byte("key-1\n"), 0644); err != nil {
+		t.Fatalf("Failed to write key file: %v", err)
+	}
+	guard, err := newHeaderGuard(&config.RequireHeadersConfig{
+		APIKey: &config.APIKeyConfig{Header: "x-api-key", File: keyFile},
+		Body:   `{"code": "DENIED"}`,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create header guard: %v", err)
+	}
+
+	// API key failures fall back to the body of the guard, like header rules
+	w := httptest.NewRecorder()
+	guard.check(w, httptest.NewRequest(http.MethodGet, "/test", nil))
+	if w.Code != http.StatusUnauthorized || w.Body.String() != `{"code": "DENIED"}` {
+		t.Errorf("Expected the shared body with 401, got %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestHeaderGuardInvalidConfig(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  config.RequireHeadersConfig
+	}{
+		{
+			name: "invalid pattern",
+			cfg:  config.RequireHeadersConfig{Headers: []config.HeaderRequirement{{Name: "site-token", Pattern: "("}}},
+		},
+		{
+			name: "missing name",
+			cfg:  config.RequireHeadersConfig{Headers: []config.HeaderRequirement{{Values: []string{"a"}}}},
+		},
+		{
+			name: "missing key file",
+			cfg:  config.RequireHeadersConfig{APIKey: &config.APIKeyConfig{Header: "client-id", File: "/non/existing/keys.txt"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := newHeaderGuard(&tt.cfg); err == nil {
+				t.Error("Expected error for invalid configuration")
+			}
+		})
+	}
+}
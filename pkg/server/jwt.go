@@ -0,0 +1,374 @@
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/developmeh/mock-cors-server/internal/config"
+	"github.com/developmeh/mock-cors-server/pkg/oidc"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// jwtVerifier validates bearer tokens for a single route
+type jwtVerifier struct {
+	realm  string
+	keys   []verificationKey
+	parser *jwt.Parser
+	claims map[string]string // Required claim values
+}
+
+// verificationKey is a key a token may be signed with
+type verificationKey struct {
+	id  string
+	key interface{}
+}
+
+// newJWTVerifier builds a verifier from route configuration
+func newJWTVerifier(cfg *config.JWTConfig, provider *oidc.Provider) (*jwtVerifier, error) {
+	var keys []verificationKey
+
+	if cfg.Secret != "" {
+		keys = append(keys, verificationKey{key: []byte(cfg.Secret)})
+	}
+	if cfg.PublicKeyFile != "" {
+		key, err := loadPublicKey(cfg.PublicKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, verificationKey{key: key})
+	}
+	if cfg.JWKSFile != "" {
+		jwks, err := loadJWKS(cfg.JWKSFile)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, jwks...)
+	}
+
+	issuer := cfg.Issuer
+	if cfg.UseOIDC {
+		if provider == nil {
+			return nil, errors.New("use_oidc requires the OIDC provider to be enabled")
+		}
+		keys = append(keys, verificationKey{key: provider.PublicKey()})
+		if issuer == "" {
+			issuer = provider.Issuer()
+		}
+	}
+
+	if len(keys) == 0 {
+		return nil, errors.New("no verification key configured (set secret, public_key_file, jwks_file or use_oidc)")
+	}
+
+	algorithms := cfg.Algorithms
+	if len(algorithms) == 0 {
+		algorithms = algorithmsForKeys(keys)
+	}
+
+	options := []jwt.ParserOption{
+		jwt.WithValidMethods(algorithms),
+		jwt.WithLeeway(time.Duration(cfg.Leeway) * time.Second),
+	}
+	if issuer != "" {
+		options = append(options, jwt.WithIssuer(issuer))
+	}
+	if cfg.Audience != "" {
+		options = append(options, jwt.WithAudience(cfg.Audience))
+	}
+
+	realm := cfg.Realm
+	if realm == "" {
+		realm = "mock-cors-server"
+	}
+
+	return &jwtVerifier{
+		realm:  realm,
+		keys:   keys,
+		parser: jwt.NewParser(options...),
+		claims: cfg.Claims,
+	}, nil
+}
+
+// authenticate validates the bearer token of a request. On failure it
+// writes a 401 response as described in RFC 6750 section 3, or a 403 when
+// a valid token lacks a required claim.
+func (v *jwtVerifier) authenticate(w http.ResponseWriter, r *http.Request) bool {
+	scheme, raw, found := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") || strings.TrimSpace(raw) == "" {
+		// No credentials at all: the challenge carries no error code
+		w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm=%q`, v.realm))
+		writeAuthError(w, http.StatusUnauthorized, "invalid_request", "missing bearer token")
+		return false
+	}
+
+	claims := jwt.MapClaims{}
+	if _, err := v.parser.ParseWithClaims(strings.TrimSpace(raw), claims, v.keyfunc); err != nil {
+		description := strings.ReplaceAll(err.Error(), `"`, "'")
+		w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm=%q, error="invalid_token", error_description="%s"`, v.realm, description))
+		writeAuthError(w, http.StatusUnauthorized, "invalid_token", err.Error())
+		return false
+	}
+
+	if name, ok := v.missingClaim(claims); !ok {
+		description := fmt.Sprintf("token lacks the required %s claim", name)
+		w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm=%q, error="insufficient_scope", error_description="%s"`, v.realm, description))
+		writeAuthError(w, http.StatusForbidden, "insufficient_scope", description)
+		return false
+	}
+	return true
+}
+
+// missingClaim checks the required claims in name order, returning the
+// first one the token does not satisfy
+func (v *jwtVerifier) missingClaim(claims jwt.MapClaims) (string, bool) {
+	names := make([]string, 0, len(v.claims))
+	for name := range v.claims {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if !claimMatches(claims[name], v.claims[name]) {
+			return name, false
+		}
+	}
+	return "", true
+}
+
+// claimMatches reports whether a claim holds a value: string claims match
+// it whole or as one of their space-separated words, as scope does, array
+// claims when one of their elements matches, and other claims by their
+// printed value
+func claimMatches(claim interface{}, value string) bool {
+	switch c := claim.(type) {
+	case nil:
+		return false
+	case string:
+		if c == value {
+			return true
+		}
+		for _, word := range strings.Fields(c) {
+			if word == value {
+				return true
+			}
+		}
+		return false
+	case []interface{}:
+		for _, element := range c {
+			if claimMatches(element, value) {
+				return true
+			}
+		}
+		return false
+	default:
+		return fmt.Sprint(c) == value
+	}
+}
+
+// keyfunc picks the verification key for a token, by kid when present and
+// otherwise by the key type matching the signing algorithm
+func (v *jwtVerifier) keyfunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+
+	var candidates []jwt.VerificationKey
+	for _, k := range v.keys {
+		if kid != "" && k.id != "" && k.id != kid {
+			continue
+		}
+		if keyMatchesMethod(k.key, token.Method) {
+			candidates = append(candidates, k.key)
+		}
+	}
+
+	switch len(candidates) {
+	case 0:
+		return nil, fmt.Errorf("no key matches alg %s", token.Method.Alg())
+	case 1:
+		return candidates[0], nil
+	default:
+		return jwt.VerificationKeySet{Keys: candidates}, nil
+	}
+}
+
+// keyMatchesMethod reports whether a key can verify a signing method
+func keyMatchesMethod(key interface{}, method jwt.SigningMethod) bool {
+	switch key.(type) {
+	case []byte:
+		_, ok := method.(*jwt.SigningMethodHMAC)
+		return ok
+	case *rsa.PublicKey:
+		switch method.(type) {
+		case *jwt.SigningMethodRSA, *jwt.SigningMethodRSAPSS:
+			return true
+		}
+	case *ecdsa.PublicKey:
+		_, ok := method.(*jwt.SigningMethodECDSA)
+		return ok
+	case ed25519.PublicKey:
+		_, ok := method.(*jwt.SigningMethodEd25519)
+		return ok
+	}
+	return false
+}
+
+// algorithmsForKeys lists the algorithms the configured keys can verify
+func algorithmsForKeys(keys []verificationKey) []string {
+	var algorithms []string
+	seen := make(map[string]bool)
+	add := func(algs ...string) {
+		for _, alg := range algs {
+			if !seen[alg] {
+				seen[alg] = true
+				algorithms = append(algorithms, alg)
+			}
+		}
+	}
+
+	for _, k := range keys {
+		switch k.key.(type) {
+		case []byte:
+			add("HS256", "HS384", "HS512")
+		case *rsa.PublicKey:
+			add("RS256", "RS384", "RS512", "PS256", "PS384", "PS512")
+		case *ecdsa.PublicKey:
+			add("ES256", "ES384", "ES512")
+		case ed25519.PublicKey:
+			add("EdDSA")
+		}
+	}
+	return algorithms
+}
+
+// loadPublicKey reads a PEM encoded public key or certificate
+func loadPublicKey(path string) (interface{}, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading public key: %w", err)
+	}
+
+	if key, err := jwt.ParseRSAPublicKeyFromPEM(data); err == nil {
+		return key, nil
+	}
+	if key, err := jwt.ParseECPublicKeyFromPEM(data); err == nil {
+		return key, nil
+	}
+	if key, err := jwt.ParseEdPublicKeyFromPEM(data); err == nil {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unable to parse public key in %s", path)
+}
+
+// jsonWebKey is a single entry of a JSON Web Key Set (RFC 7517)
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+	K   string `json:"k"`
+}
+
+// loadJWKS reads the keys of a local JSON Web Key Set file
+func loadJWKS(path string) ([]verificationKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading JWKS: %w", err)
+	}
+
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("unable to decode JWKS %s: %w", path, err)
+	}
+
+	var keys []verificationKey
+	for i, jwk := range set.Keys {
+		key, err := jwk.publicKey()
+		if err != nil {
+			return nil, fmt.Errorf("JWKS %s key %d: %w", path, i, err)
+		}
+		keys = append(keys, verificationKey{id: jwk.Kid, key: key})
+	}
+	return keys, nil
+}
+
+// publicKey converts a JSON Web Key to a key usable for verification
+func (k jsonWebKey) publicKey() (interface{}, error) {
+	decode := base64.RawURLEncoding.DecodeString
+
+	switch k.Kty {
+	case "RSA":
+		n, err := decode(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("invalid modulus: %w", err)
+		}
+		e, err := decode(k.E)
+		if err != nil {
+			return nil, fmt.Errorf("invalid exponent: %w", err)
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decode(k.X)
+		if err != nil {
+			return nil, fmt.Errorf("invalid x coordinate: %w", err)
+		}
+		y, err := decode(k.Y)
+		if err != nil {
+			return nil, fmt.Errorf("invalid y coordinate: %w", err)
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decode(k.X)
+		if err != nil {
+			return nil, fmt.Errorf("invalid x coordinate: %w", err)
+		}
+		return ed25519.PublicKey(x), nil
+	case "oct":
+		secret, err := decode(k.K)
+		if err != nil {
+			return nil, fmt.Errorf("invalid key value: %w", err)
+		}
+		return secret, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+}
+
+// writeAuthError writes an OAuth2 style JSON error body
+func writeAuthError(w http.ResponseWriter, status int, code, description string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{
+		"error":             code,
+		"error_description": description,
+	})
+}
@@ -0,0 +1,293 @@
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/developmeh/mock-cors-server/internal/config"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func signHS256(t *testing.T, claims jwt.MapClaims, secret string) string {
+	t.Helper()
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(secret))
+	if err != nil {
+		t.Fatalf("Failed to sign token: %v", err)
+	}
+	return token
+}
+
+func TestJWTVerifier(t *testing.T) {
+	verifier, err := newJWTVerifier(&config.JWTConfig{
+		Secret:   "top-secret",
+		Issuer:   "https://issuer.example.com",
+		Audience: "mock-api",
+	}, nil)
+	if err != nil {
+		t.Fatalf("Failed to create verifier: %v", err)
+	}
+
+	valid := jwt.MapClaims{
+		"iss": "https://issuer.example.com",
+		"aud": "mock-api",
+		"sub": "user-42",
+		"exp": time.Now().Add(time.Hour).Unix(),
+	}
+	expired := jwt.MapClaims{
+		"iss": "https://issuer.example.com",
+		"aud": "mock-api",
+		"exp": time.Now().Add(-time.Hour).Unix(),
+	}
+	wrongAudience := jwt.MapClaims{
+		"iss": "https://issuer.example.com",
+		"aud": "other-api",
+	}
+
+	tests := []struct {
+		name          string
+		authorization string
+		expectOK      bool
+		expectError   bool
+	}{
+		{
+			name:          "valid token",
+			authorization: "Bearer " + signHS256(t, valid, "top-secret"),
+			expectOK:      true,
+		},
+		{
+			name:          "missing token",
+			authorization: "",
+			expectError:   false,
+		},
+		{
+			name:          "wrong scheme",
+			authorization: "Basic dXNlcjpwYXNz",
+			expectError:   false,
+		},
+		{
+			name:          "expired token",
+			authorization: "Bearer " + signHS256(t, expired, "top-secret"),
+			expectError:   true,
+		},
+		{
+			name:          "wrong audience",
+			authorization: "Bearer " + signHS256(t, wrongAudience, "top-secret"),
+			expectError:   true,
+		},
+		{
+			name:          "wrong secret",
+			authorization: "Bearer " + signHS256(t, valid, "guessed"),
+			expectError:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/test", nil)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			w := httptest.NewRecorder()
+
+			ok := verifier.authenticate(w, req)
+			if ok != tt.expectOK {
+				t.Fatalf("Expected ok=%v, got %v", tt.expectOK, ok)
+			}
+
+			if tt.expectOK {
+				return
+			}
+
+			if w.Code != http.StatusUnauthorized {
+				t.Errorf("Expected status 401, got %d", w.Code)
+			}
+			challenge := w.Header().Get("WWW-Authenticate")
+			if !strings.HasPrefix(challenge, `Bearer realm="mock-cors-server"`) {
+				t.Errorf("Unexpected WWW-Authenticate header: %s", challenge)
+			}
+			if strings.Contains(challenge, `error="invalid_token"`) != tt.expectError {
+				t.Errorf("Expected invalid_token error=%v in challenge, got %s", tt.expectError, challenge)
+			}
+		})
+	}
+}
+
+func TestJWTVerifierWithJWKS(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+
+	jwks, _ := json.Marshal(map[string]interface{}{
+		"keys": []map[string]string{
+			{
+				"kty": "EC",
+				"kid": "test-key",
+				"crv": "P-256",
+				"x":   base64.RawURLEncoding.EncodeToString(key.PublicKey.X.FillBytes(make([]byte, 32))),
+				"y":   base64.RawURLEncoding.EncodeToString(key.PublicKey.Y.FillBytes(make([]byte, 32))),
+			},
+		},
+	})
+	jwksFile, err := os.CreateTemp("", "jwks*.json")
+	if err != nil {
+		t.Fatalf("Failed to create temp file: %v", err)
+	}
+	defer os.Remove(jwksFile.Name())
+	jwksFile.Write(jwks)
+	jwksFile.Close()
+
+	verifier, err := newJWTVerifier(&config.JWTConfig{JWKSFile: jwksFile.Name()}, nil)
+	if err != nil {
+		t.Fatalf("Failed to create verifier: %v", err)
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, jwt.MapClaims{"sub": "ec-user"})
+	token.Header["kid"] = "test-key"
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatalf("Failed to sign token: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/test", nil)
+	req.Header.Set("Authorization", "Bearer "+signed)
+	if !verifier.authenticate(httptest.NewRecorder(), req) {
+		t.Error("Expected token signed with the JWKS key to be accepted")
+	}
+
+	// HMAC tokens must not be accepted when only an EC key is configured
+	req.Header.Set("Authorization", "Bearer "+signHS256(t, jwt.MapClaims{"sub": "x"}, "secret"))
+	if verifier.authenticate(httptest.NewRecorder(), req) {
+		t.Error("Expected HS256 token to be rejected")
+	}
+}
+
+func TestJWTVerifierClaims(t *testing.T) {
+	verifier, err := newJWTVerifier(&config.JWTConfig{
+		Secret: "top-secret",
+		Claims: map[string]string{"role": "admin", "scope": "orders:write", "tenant": "7"},
+	}, nil)
+	if err != nil {
+		t.Fatalf("Failed to create verifier: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		claims   jwt.MapClaims
+		expectOK bool
+	}{
+		{
+			name:     "all claims",
+			claims:   jwt.MapClaims{"role": "admin", "scope": "orders:read orders:write", "tenant": 7},
+			expectOK: true,
+		},
+		{
+			name:     "array claim",
+			claims:   jwt.MapClaims{"role": []string{"user", "admin"}, "scope": "orders:write", "tenant": "7"},
+			expectOK: true,
+		},
+		{
+			name:     "wrong value",
+			claims:   jwt.MapClaims{"role": "user", "scope": "orders:write", "tenant": 7},
+			expectOK: false,
+		},
+		{
+			name:     "missing scope",
+			claims:   jwt.MapClaims{"role": "admin", "scope": "orders:read", "tenant": 7},
+			expectOK: false,
+		},
+		{
+			name:     "missing claim",
+			claims:   jwt.MapClaims{"role": "admin", "scope": "orders:write"},
+			expectOK: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/test", nil)
+			req.Header.Set("Authorization", "Bearer "+signHS256(t, tt.claims, "top-secret"))
+			w := httptest.NewRecorder()
+
+			if ok := verifier.authenticate(w, req); ok != tt.expectOK {
+				t.Fatalf("Expected ok=%v, got %v", tt.expectOK, ok)
+			}
+			if tt.expectOK {
+				return
+			}
+
+			// Valid tokens without the claims are forbidden, not unauthorized
+			if w.Code != http.StatusForbidden {
+				t.Errorf("Expected status 403, got %d", w.Code)
+			}
+			if challenge := w.Header().Get("WWW-Authenticate"); !strings.Contains(challenge, `error="insufficient_scope"`) {
+				t.Errorf("Expected insufficient_scope challenge, got %s", challenge)
+			}
+		})
+	}
+}
+
+func TestJWTRoute(t *testing.T) {
+	cfg := &config.Config{
+		Routes: []config.Route{
+			{
+				Path:        "/secure",
+				Type:        "json",
+				JSONContent: `{"secure": true}`,
+				JWT:         &config.JWTConfig{Secret: "top-secret"},
+			},
+		},
+		CORS: config.CORSConfig{
+			AllowOrigins: []string{"*"},
+			AllowMethods: []string{"POST", "OPTIONS"},
+			AllowHeaders: []string{"Authorization"},
+		},
+	}
+
+	server := New(cfg)
+	if err := server.setupRoutes(); err != nil {
+		t.Fatalf("Failed to set up routes: %v", err)
+	}
+
+	// Preflight requests never carry credentials and must succeed
+	req := httptest.NewRequest(http.MethodOptions, "/secure", nil)
+	req.Header.Set("Origin", "https://example.com")
+	w := httptest.NewRecorder()
+	server.mux.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected preflight status 200, got %d", w.Code)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/secure", nil)
+	w = httptest.NewRecorder()
+	server.mux.ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status 401 without token, got %d", w.Code)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/secure", nil)
+	req.Header.Set("Authorization", "Bearer "+signHS256(t, jwt.MapClaims{"sub": "user"}, "top-secret"))
+	w = httptest.NewRecorder()
+	server.mux.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status 200 with token, got %d", w.Code)
+	}
+}
+
+func TestJWTVerifierRequiresKey(t *testing.T) {
+	if _, err := newJWTVerifier(&config.JWTConfig{}, nil); err == nil {
+		t.Error("Expected error when no key is configured")
+	}
+	if _, err := newJWTVerifier(&config.JWTConfig{UseOIDC: true}, nil); err == nil {
+		t.Error("Expected error when use_oidc is set without a provider")
+	}
+}
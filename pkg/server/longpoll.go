@@ -0,0 +1,132 @@
+package server
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/developmeh/mock-cors-server/internal/config"
+)
+
+// defaultLongPollTimeout is how long long_poll routes hold requests unless
+// they set a timeout
+const defaultLongPollTimeout = 30 * time.Second
+
+// triggerEvent is the response a trigger releases held requests with; an
+// empty body keeps the route's json_content
+type triggerEvent struct {
+	body        []byte
+	contentType string
+}
+
+// triggerHub releases the requests waiting on named triggers
+type triggerHub struct {
+	mu      sync.Mutex
+	waiters map[string]map[chan triggerEvent]struct{}
+}
+
+// newTriggerHub creates a hub without waiting requests
+func newTriggerHub() *triggerHub {
+	return &triggerHub{waiters: make(map[string]map[chan triggerEvent]struct{})}
+}
+
+// wait registers a request waiting on a trigger. The returned function
+// unregisters it.
+func (h *triggerHub) wait(name string) (<-chan triggerEvent, func()) {
+	ch := make(chan triggerEvent, 1)
+	h.mu.Lock()
+	if h.waiters[name] == nil {
+		h.waiters[name] = make(map[chan triggerEvent]struct{})
+	}
+	h.waiters[name][ch] = struct{}{}
+	h.mu.Unlock()
+
+	return ch, func() {
+		h.mu.Lock()
+		delete(h.waiters[name], ch)
+		if len(h.waiters[name]) == 0 {
+			delete(h.waiters, name)
+		}
+		h.mu.Unlock()
+	}
+}
+
+// fire releases every request waiting on a trigger, returning their number
+func (h *triggerHub) fire(name string, event triggerEvent) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	waiters := h.waiters[name]
+	for ch := range waiters {
+		ch <- event
+	}
+	delete(h.waiters, name)
+	return len(waiters)
+}
+
+// longPoll holds the requests of a long_poll route until its trigger fires
+// or the timeout passes
+type longPoll struct {
+	hub           *triggerHub
+	trigger       string
+	timeout       time.Duration
+	timeoutStatus int
+	status        int
+	body          string
+	contentType   string
+}
+
+// newLongPoll prepares a long_poll route
+func newLongPoll(route config.Route, contentType string, hub *triggerHub) *longPoll {
+	lp := &longPoll{
+		hub:           hub,
+		trigger:       route.Trigger,
+		timeout:       time.Duration(route.Timeout) * time.Millisecond,
+		timeoutStatus: route.TimeoutStatus,
+		status:        route.Status,
+		body:          route.JSONContent,
+		contentType:   contentType,
+	}
+	if lp.timeout == 0 {
+		lp.timeout = defaultLongPollTimeout
+	}
+	if lp.timeoutStatus == 0 {
+		lp.timeoutStatus = http.StatusNoContent
+	}
+	if lp.status == 0 {
+		lp.status = http.StatusOK
+	}
+	return lp
+}
+
+// serve holds the request. Released requests get the trigger's body, or
+// json_content; requests that time out, or are held when the server shuts
+// down, get timeout_status without a body, as a long poll with nothing new
+// to report.
+func (lp *longPoll) serve(w http.ResponseWriter, r *http.Request) {
+	var released <-chan triggerEvent
+	if lp.trigger != "" {
+		ch, cancel := lp.hub.wait(lp.trigger)
+		defer cancel()
+		released = ch
+	}
+
+	timer := time.NewTimer(lp.timeout)
+	defer timer.Stop()
+	select {
+	case event := <-released:
+		body, contentType := event.body, event.contentType
+		if len(body) == 0 {
+			body, contentType = []byte(lp.body), lp.contentType
+		}
+		if contentType == "" {
+			contentType = lp.contentType
+		}
+		w.Header().Set("Content-Type", contentType)
+		w.WriteHeader(lp.status)
+		w.Write(body)
+	case <-timer.C:
+		w.WriteHeader(lp.timeoutStatus)
+	case <-r.Context().Done():
+		w.WriteHeader(lp.timeoutStatus)
+	}
+}
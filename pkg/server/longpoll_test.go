@@ -0,0 +1,126 @@
+package server
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/developmeh/mock-cors-server/internal/config"
+)
+
+func TestTriggerHub(t *testing.T) {
+	hub := newTriggerHub()
+	first, cancelFirst := hub.wait("orders")
+	second, cancelSecond := hub.wait("orders")
+	defer cancelSecond()
+	other, cancelOther := hub.wait("invoices")
+	defer cancelOther()
+
+	cancelFirst()
+	if n := hub.fire("orders", triggerEvent{body: []byte("new")}); n != 1 {
+		t.Errorf("Expected 1 request released, got %d", n)
+	}
+	if event := <-second; string(event.body) != "new" {
+		t.Errorf("Expected the trigger body, got %q", event.body)
+	}
+	select {
+	case <-first:
+		t.Error("Expected canceled waits not to be released")
+	case <-other:
+		t.Error("Expected other triggers not to be released")
+	default:
+	}
+
+	if n := hub.fire("orders", triggerEvent{}); n != 0 {
+		t.Errorf("Expected released requests to wait no longer, got %d", n)
+	}
+}
+
+func TestLongPollRoute(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.Routes = []config.Route{
+		{Path: "/poll", Type: "long_poll", Trigger: "orders", Timeout: 5000, JSONContent: `{"orders": []}`},
+		{Path: "/quick", Type: "long_poll", Timeout: 20, TimeoutStatus: http.StatusRequestTimeout},
+	}
+	server := New(cfg)
+	if err := server.setupRoutes(); err != nil {
+		t.Fatalf("Expected routes to be set up, got %v", err)
+	}
+	server.setupAdmin()
+	ts := httptest.NewServer(server.mux)
+	defer ts.Close()
+
+	// poll starts a long poll, sending its response once it is released
+	poll := func(path string) <-chan *http.Response {
+		responses := make(chan *http.Response, 1)
+		go func() {
+			resp, err := http.Get(ts.URL + path)
+			if err != nil {
+				t.Errorf("Request failed: %v", err)
+				responses <- nil
+				return
+			}
+			responses <- resp
+		}()
+		return responses
+	}
+	// fire posts to the trigger once the poll is waiting
+	fire := func(t *testing.T, body, contentType string) {
+		t.Helper()
+		for deadline := time.Now().Add(2 * time.Second); time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+			resp, err := http.Post(ts.URL+"/__admin/triggers/orders", contentType, strings.NewReader(body))
+			if err != nil {
+				t.Fatalf("Trigger failed: %v", err)
+			}
+			released, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			if strings.Contains(string(released), `"released":1`) {
+				return
+			}
+		}
+		t.Fatal("Expected the trigger to release the poll")
+	}
+	read := func(t *testing.T, responses <-chan *http.Response) (*http.Response, string) {
+		t.Helper()
+		select {
+		case resp := <-responses:
+			if resp == nil {
+				t.FailNow()
+			}
+			defer resp.Body.Close()
+			body, _ := io.ReadAll(resp.Body)
+			return resp, string(body)
+		case <-time.After(3 * time.Second):
+			t.Fatal("Expected the poll to be answered")
+		}
+		return nil, ""
+	}
+
+	t.Run("triggered", func(t *testing.T) {
+		responses := poll("/poll")
+		fire(t, "", "")
+		resp, body := read(t, responses)
+		if resp.StatusCode != http.StatusOK || body != `{"orders": []}` || resp.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("Expected json_content, got %d %q %v", resp.StatusCode, body, resp.Header)
+		}
+	})
+
+	t.Run("triggered with body", func(t *testing.T) {
+		responses := poll("/poll")
+		fire(t, "order 7 shipped", "text/plain")
+		resp, body := read(t, responses)
+		if body != "order 7 shipped" || resp.Header.Get("Content-Type") != "text/plain" {
+			t.Errorf("Expected the posted body, got %q %v", body, resp.Header)
+		}
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		resp, body := read(t, poll("/quick"))
+		if resp.StatusCode != http.StatusRequestTimeout || body != "" {
+			t.Errorf("Expected an empty 408, got %d %q", resp.StatusCode, body)
+		}
+	})
+}
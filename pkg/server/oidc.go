@@ -0,0 +1,40 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/developmeh/mock-cors-server/pkg/oidc"
+)
+
+// setupOIDC mounts the mock OpenID Connect provider when it is enabled
+func (s *Server) setupOIDC() error {
+	if !s.config.OIDC.Enabled {
+		return nil
+	}
+
+	provider, err := oidc.New(s.config.OIDC, s.config.Port)
+	if err != nil {
+		return fmt.Errorf("failed to create OIDC provider: %w", err)
+	}
+
+	for path, handler := range provider.Routes() {
+		handler := handler
+		s.mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+			// The provider endpoints use the global CORS settings
+			s.setCORSHeaders(w, r, nil)
+
+			// Handle OPTIONS method (CORS preflight)
+			if r.Method == http.MethodOptions {
+				w.WriteHeader(http.StatusOK)
+				return
+			}
+
+			handler(w, r)
+		})
+	}
+
+	s.oidc = provider
+	fmt.Printf("OIDC provider enabled with issuer %s\n", provider.Issuer())
+	return nil
+}
@@ -0,0 +1,291 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/developmeh/mock-cors-server/internal/config"
+	"github.com/developmeh/mock-cors-server/internal/importer"
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/getkin/kin-openapi/routers/gorillamux"
+)
+
+// setupOpenAPI adds a route for every operation of the configured OpenAPI
+// spec, and prepares request validation when it is enabled. Configured routes
+// take precedence over imported ones with the same path and method.
+func (s *Server) setupOpenAPI() error {
+	if s.config.OpenAPI.Spec == "" {
+		return nil
+	}
+
+	doc, err := importer.LoadOpenAPI(s.config.OpenAPI.Spec)
+	if err != nil {
+		return err
+	}
+
+	routes, warnings := importer.OpenAPIRoutes(doc)
+	for _, warning := range warnings {
+		fmt.Printf("Warning: %s\n", warning)
+	}
+
+	added := 0
+	for _, route := range routes {
+		if s.overridden(route) {
+			continue
+		}
+		s.config.Routes = append(s.config.Routes, route)
+		added++
+	}
+
+	fmt.Printf("Imported %d routes from %s\n", added, s.config.OpenAPI.Spec)
+
+	mode := strings.ToLower(s.config.OpenAPI.Validate)
+	if mode == "warn" || mode == "enforce" {
+		v, err := newSpecValidator(doc, mode == "enforce", s.config.OpenAPI.ValidateResponses)
+		if err != nil {
+			return fmt.Errorf("failed to prepare OpenAPI validation: %w", err)
+		}
+		s.validator = v
+		fmt.Printf("Validating requests against %s (%s)\n", s.config.OpenAPI.Spec, mode)
+	}
+	return nil
+}
+
+// overridden reports whether a configured route answers the same requests
+func (s *Server) overridden(route config.Route) bool {
+	for _, existing := range s.config.Routes {
+		if existing.Overlaps(route) {
+			return true
+		}
+	}
+	return false
+}
+
+// specValidator checks requests, and optionally responses, against the
+// operations of an OpenAPI spec
+type specValidator struct {
+	router    routers.Router
+	enforce   bool // Answer violations instead of only logging them
+	responses bool
+}
+
+// violation describes one way a request or response departs from the spec
+type violation struct {
+	In      string `json:"in"` // path, query, header, cookie, body or response
+	Name    string `json:"name,omitempty"`
+	Pointer string `json:"pointer,omitempty"` // JSON pointer into the body
+	Message string `json:"message"`
+}
+
+// newSpecValidator routes requests to the operations of a spec
+func newSpecValidator(doc *openapi3.T, enforce, responses bool) (*specValidator, error) {
+	// Requests reach the mock on its own address, whatever servers the spec
+	// lists, under the base path its routes were given
+	local := *doc
+	local.Servers = nil
+	if base := importer.BasePath(doc); base != "" {
+		local.Servers = openapi3.Servers{{URL: base}}
+	}
+
+	router, err := gorillamux.NewRouter(&local)
+	if err != nil {
+		return nil, err
+	}
+	return &specValidator{router: router, enforce: enforce, responses: responses}, nil
+}
+
+// wrap validates requests for operations of the spec before next answers
+// them. Requests the spec does not describe are passed through, so routes
+// can extend it. Streamed responses are sent as they are written and never
+// validated.
+func (v *specValidator) wrap(next http.HandlerFunc, streamed bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		route, params, err := v.router.FindRoute(r)
+		if err != nil {
+			next(w, r)
+			return
+		}
+		operation := r.Method + " " + route.Path
+
+		input := &openapi3filter.RequestValidationInput{
+			Request:    r,
+			PathParams: params,
+			Route:      route,
+			Options: &openapi3filter.Options{
+				MultiError:          true,
+				SkipSettingDefaults: true,
+				// Credentials are checked by the jwt and require_headers settings
+				AuthenticationFunc: openapi3filter.NoopAuthenticationFunc,
+			},
+		}
+		if err := openapi3filter.ValidateRequest(r.Context(), input); err != nil {
+			violations := describeViolations(err)
+			if v.enforce {
+				writeViolations(w, http.StatusBadRequest, "invalid_request", "request does not match the OpenAPI spec", operation, violations)
+				return
+			}
+			logViolations("request", operation, violations)
+		}
+
+		if !v.responses || streamed {
+			next(w, r)
+			return
+		}
+
+		buffered := &bufferedResponse{ResponseWriter: w, status: http.StatusOK}
+		next(buffered, r)
+
+		// Partial and bodiless answers, such as a 206 to a range request
+		// for a static file, say nothing about the operation's responses
+		if !hasFullBody(r.Method, buffered.status) {
+			w.WriteHeader(buffered.status)
+			w.Write(buffered.body.Bytes())
+			return
+		}
+
+		err = openapi3filter.ValidateResponse(r.Context(), &openapi3filter.ResponseValidationInput{
+			RequestValidationInput: input,
+			Status:                 buffered.status,
+			Header:                 w.Header(),
+			Body:                   io.NopCloser(bytes.NewReader(buffered.body.Bytes())),
+			Options:                &openapi3filter.Options{MultiError: true, IncludeResponseStatus: true},
+		})
+		if err != nil {
+			violations := describeViolations(err)
+			if v.enforce {
+				w.Header().Del("Content-Length")
+				writeViolations(w, http.StatusInternalServerError, "invalid_response", "configured response does not match the OpenAPI spec", operation, violations)
+				return
+			}
+			logViolations("response", operation, violations)
+		}
+
+		w.WriteHeader(buffered.status)
+		w.Write(buffered.body.Bytes())
+	}
+}
+
+// bufferedResponse holds a response back until it has been validated.
+// Headers go straight to the underlying writer.
+type bufferedResponse struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+// WriteHeader records the status
+func (b *bufferedResponse) WriteHeader(status int) {
+	b.status = status
+}
+
+// Write buffers the body
+func (b *bufferedResponse) Write(data []byte) (int, error) {
+	return b.body.Write(data)
+}
+
+// hasFullBody reports whether a response carries the whole representation
+// the spec describes: not a HEAD response, a partial range or a status
+// without a body
+func hasFullBody(method string, status int) bool {
+	switch {
+	case method == http.MethodHead:
+		return false
+	case status < 200, status == http.StatusNoContent, status == http.StatusPartialContent, status == http.StatusNotModified:
+		return false
+	}
+	return true
+}
+
+// describeViolations flattens validation errors into violations
+func describeViolations(err error) []violation {
+	if multi, ok := err.(openapi3.MultiError); ok {
+		var violations []violation
+		for _, e := range multi {
+			violations = append(violations, describeViolations(e)...)
+		}
+		return violations
+	}
+
+	var v violation
+	var requestErr *openapi3filter.RequestError
+	var responseErr *openapi3filter.ResponseError
+	switch {
+	case errors.As(err, &requestErr):
+		switch {
+		case requestErr.Parameter != nil:
+			v.In, v.Name = requestErr.Parameter.In, requestErr.Parameter.Name
+		case requestErr.RequestBody != nil:
+			v.In = "body"
+		default:
+			v.In = "request"
+		}
+		// Schema errors may hold several failures of their own
+		if _, ok := requestErr.Err.(openapi3.MultiError); ok {
+			violations := describeViolations(requestErr.Err)
+			for i := range violations {
+				violations[i].In, violations[i].Name = v.In, v.Name
+			}
+			return violations
+		}
+	case errors.As(err, &responseErr):
+		v.In = "response"
+		if _, ok := responseErr.Err.(openapi3.MultiError); ok {
+			violations := describeViolations(responseErr.Err)
+			for i := range violations {
+				violations[i].In = v.In
+			}
+			return violations
+		}
+	}
+
+	var schemaErr *openapi3.SchemaError
+	if errors.As(err, &schemaErr) {
+		if pointer := schemaErr.JSONPointer(); len(pointer) > 0 {
+			v.Pointer = "/" + strings.Join(pointer, "/")
+		}
+		v.Message = schemaErr.Reason
+	} else if requestErr != nil && requestErr.Err != nil {
+		v.Message = requestErr.Err.Error()
+	} else if responseErr != nil && responseErr.Reason != "" {
+		v.Message = responseErr.Reason
+		if responseErr.Err != nil {
+			v.Message += ": " + responseErr.Err.Error()
+		}
+	} else {
+		v.Message = err.Error()
+	}
+	return []violation{v}
+}
+
+// writeViolations answers with a JSON description of the violations
+func writeViolations(w http.ResponseWriter, status int, code, message, operation string, violations []violation) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error":      code,
+		"message":    message,
+		"operation":  operation,
+		"violations": violations,
+	})
+}
+
+// logViolations reports violations in warn mode
+func logViolations(kind, operation string, violations []violation) {
+	for _, v := range violations {
+		location := v.In
+		if v.Name != "" {
+			location += " " + v.Name
+		}
+		if v.Pointer != "" {
+			location += " " + v.Pointer
+		}
+		fmt.Printf("Warning: %s %s does not match the OpenAPI spec: %s: %s\n", operation, kind, location, v.Message)
+	}
+}
@@ -0,0 +1,248 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/developmeh/mock-cors-server/internal/config"
+)
+
+func TestSetupOpenAPI(t *testing.T) {
+	spec := filepath.Join(t.TempDir(), "spec.yaml")
+	content := `openapi: 3.0.3
+info: {title: Pets, version: "1"}
+paths:
+  /pets:
+    get:
+      responses:
+        "200":
+          description: ok
+          content:
+            application/json:
+              example: [{id: 1}]
+    post:
+      responses:
+        "201":
+          description: created
+`
+	if err := os.WriteFile(spec, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write spec: %v", err)
+	}
+
+	cfg := config.DefaultConfig()
+	cfg.OpenAPI.Spec = spec
+	cfg.Routes = []config.Route{
+		// Configured routes win over imported ones
+		{Path: "/pets", Type: "json", Methods: []string{"POST"}, Status: http.StatusAccepted},
+	}
+
+	server := New(cfg)
+	if err := server.setupOpenAPI(); err != nil {
+		t.Fatalf("Expected spec to load, got %v", err)
+	}
+	if len(cfg.Routes) != 2 {
+		t.Fatalf("Expected the GET operation to be added, got %+v", cfg.Routes)
+	}
+	if err := server.setupRoutes(); err != nil {
+		t.Fatalf("Expected routes to be set up, got %v", err)
+	}
+
+	for method, expected := range map[string]int{http.MethodGet: http.StatusOK, http.MethodPost: http.StatusAccepted} {
+		req := httptest.NewRequest(method, "/pets", nil)
+		w := httptest.NewRecorder()
+		server.mux.ServeHTTP(w, req)
+
+		if w.Code != expected {
+			t.Errorf("%s: expected status %d, got %d", method, expected, w.Code)
+		}
+	}
+}
+
+func TestSetupOpenAPIMissingSpec(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.OpenAPI.Spec = filepath.Join(t.TempDir(), "missing.yaml")
+
+	if err := New(cfg).setupOpenAPI(); err == nil {
+		t.Error("Expected an error for a missing spec")
+	}
+}
+
+func TestSpecValidator(t *testing.T) {
+	spec := filepath.Join(t.TempDir(), "spec.yaml")
+	content := `openapi: 3.0.3
+info: {title: Pets, version: "1"}
+servers: [{url: "https://api.example.com/v1"}]
+paths:
+  /pets/{id}:
+    put:
+      parameters:
+        - {name: id, in: path, required: true, schema: {type: integer}}
+        - {name: dry_run, in: query, schema: {type: boolean}}
+      requestBody:
+        required: true
+        content:
+          application/json:
+            schema:
+              type: object
+              required: [name]
+              properties:
+                name: {type: string}
+      responses:
+        "200":
+          description: ok
+          content:
+            application/json:
+              schema:
+                type: object
+                required: [id]
+                properties:
+                  id: {type: integer}
+`
+	if err := os.WriteFile(spec, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write spec: %v", err)
+	}
+
+	newServer := func(mode string, responses bool, body string) *Server {
+		cfg := config.DefaultConfig()
+		cfg.OpenAPI = config.OpenAPIConfig{Spec: spec, Validate: mode, ValidateResponses: responses}
+		cfg.Routes = []config.Route{
+			{Path: "/v1/pets/{id}", Type: "json", Methods: []string{"PUT"}, JSONContent: body},
+			{Path: "/extra", Type: "dummy"},
+		}
+
+		server := New(cfg)
+		if err := server.setupOpenAPI(); err != nil {
+			t.Fatalf("Expected spec to load, got %v", err)
+		}
+		if err := server.setupRoutes(); err != nil {
+			t.Fatalf("Expected routes to be set up, got %v", err)
+		}
+		return server
+	}
+
+	tests := []struct {
+		name           string
+		mode           string
+		responses      bool
+		responseBody   string
+		method         string
+		target         string
+		body           string
+		expectedStatus int
+		expectedIn     []string
+	}{
+		{name: "valid request", mode: "enforce", method: http.MethodPut, target: "/v1/pets/1?dry_run=true", body: `{"name": "Rex"}`, expectedStatus: http.StatusOK},
+		{name: "invalid path and query", mode: "enforce", method: http.MethodPut, target: "/v1/pets/abc?dry_run=maybe", body: `{"name": "Rex"}`, expectedStatus: http.StatusBadRequest, expectedIn: []string{"path", "query"}},
+		{name: "invalid body", mode: "enforce", method: http.MethodPut, target: "/v1/pets/1", body: `{"name": 5}`, expectedStatus: http.StatusBadRequest, expectedIn: []string{"body"}},
+		{name: "warn only", mode: "warn", method: http.MethodPut, target: "/v1/pets/abc", body: `{}`, expectedStatus: http.StatusOK},
+		{name: "operation outside the spec", mode: "enforce", method: http.MethodPost, target: "/extra", expectedStatus: http.StatusOK},
+		{name: "invalid response", mode: "enforce", responses: true, responseBody: `{"id": "x"}`, method: http.MethodPut, target: "/v1/pets/1", body: `{"name": "Rex"}`, expectedStatus: http.StatusInternalServerError, expectedIn: []string{"response"}},
+		{name: "invalid response in warn mode", mode: "warn", responses: true, responseBody: `{"id": "x"}`, method: http.MethodPut, target: "/v1/pets/1", body: `{"name": "Rex"}`, expectedStatus: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			responseBody := tt.responseBody
+			if responseBody == "" {
+				responseBody = `{"id": 1}`
+			}
+			server := newServer(tt.mode, tt.responses, responseBody)
+
+			req := httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			server.mux.ServeHTTP(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.expectedStatus, w.Code, w.Body.String())
+			}
+			if tt.expectedIn == nil {
+				return
+			}
+
+			var result struct {
+				Operation  string      `json:"operation"`
+				Violations []violation `json:"violations"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+				t.Fatalf("Expected a JSON description, got %s", w.Body.String())
+			}
+			if result.Operation != "PUT /pets/{id}" {
+				t.Errorf("Expected operation PUT /pets/{id}, got %q", result.Operation)
+			}
+			var in []string
+			for _, v := range result.Violations {
+				in = append(in, v.In)
+			}
+			if strings.Join(in, ",") != strings.Join(tt.expectedIn, ",") {
+				t.Errorf("Expected violations in %v, got %+v", tt.expectedIn, result.Violations)
+			}
+		})
+	}
+}
+
+func TestSpecValidatorPartialResponses(t *testing.T) {
+	dir := t.TempDir()
+	spec := filepath.Join(dir, "spec.yaml")
+	content := `openapi: 3.0.3
+info: {title: Files, version: "1"}
+paths:
+  /notes.txt:
+    get:
+      responses:
+        "200":
+          description: ok
+          content:
+            text/plain:
+              schema: {type: string}
+`
+	if err := os.WriteFile(spec, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write spec: %v", err)
+	}
+	notes := filepath.Join(dir, "notes.txt")
+	if err := os.WriteFile(notes, []byte("hello, world"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	cfg := config.DefaultConfig()
+	cfg.OpenAPI = config.OpenAPIConfig{Spec: spec, Validate: "enforce", ValidateResponses: true}
+	cfg.Routes = []config.Route{{Path: "/notes.txt", Type: "static", FilePath: notes}}
+	server := New(cfg)
+	if err := server.setupOpenAPI(); err != nil {
+		t.Fatalf("Expected spec to load, got %v", err)
+	}
+	if err := server.setupRoutes(); err != nil {
+		t.Fatalf("Expected routes to be set up, got %v", err)
+	}
+
+	serve := func(method string, headers map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/notes.txt", nil)
+		for name, value := range headers {
+			req.Header.Set(name, value)
+		}
+		w := httptest.NewRecorder()
+		server.mux.ServeHTTP(w, req)
+		return w
+	}
+
+	full := serve(http.MethodGet, nil)
+	if full.Code != http.StatusOK || full.Body.String() != "hello, world" {
+		t.Fatalf("Expected the file, got %d %s", full.Code, full.Body.String())
+	}
+
+	// The spec declares neither 206 nor 304, yet they answer the same operation
+	if w := serve(http.MethodGet, map[string]string{"Range": "bytes=0-4"}); w.Code != http.StatusPartialContent || w.Body.String() != "hello" {
+		t.Errorf("Expected 206 with the range, got %d %s", w.Code, w.Body.String())
+	}
+	if w := serve(http.MethodGet, map[string]string{"If-None-Match": full.Header().Get("ETag")}); w.Code != http.StatusNotModified {
+		t.Errorf("Expected 304, got %d %s", w.Code, w.Body.String())
+	}
+	if w := serve(http.MethodHead, nil); w.Code != http.StatusOK {
+		t.Errorf("Expected 200 for HEAD, got %d %s", w.Code, w.Body.String())
+	}
+}
@@ -1,16 +1,23 @@
 package server
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
+	"mime"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
 
 	"github.com/developmeh/mock-cors-server/internal/config"
+	"github.com/developmeh/mock-cors-server/pkg/oidc"
 )
 
 // ResponseData represents the structure of our JSON response
@@ -24,15 +31,24 @@ type ResponseData struct {
 
 // Server represents the HTTP server
 type Server struct {
-	config *config.Config
-	mux    *http.ServeMux
+	config    *config.Config
+	mux       *http.ServeMux
+	oidc      *oidc.Provider
+	sessions  *sessionStore
+	validator *specValidator // Checks requests against the OpenAPI spec
+	recorder  *harRecorder
+	upgraded  sync.WaitGroup // WebSocket connections, which Shutdown does not wait for
+	triggers  *triggerHub    // Release the requests held by long_poll routes
 }
 
 // New creates a new server with the given configuration
 func New(cfg *config.Config) *Server {
 	return &Server{
-		config: cfg,
-		mux:    http.NewServeMux(),
+		config:   cfg,
+		mux:      http.NewServeMux(),
+		sessions: newSessionStore(),
+		triggers: newTriggerHub(),
+		recorder: newHARRecorder(cfg.HAR.MaxEntries),
 	}
 }
 
@@ -72,10 +88,15 @@ func (s *Server) setCORSHeaders(w http.ResponseWriter, r *http.Request, routeCOR
 	origin := r.Header.Get("Origin")
 	if origin != "" && (contains(cors.AllowOrigins, origin) || contains(cors.AllowOrigins, "*")) {
 		w.Header().Set("Access-Control-Allow-Origin", origin)
+		// The echoed origin differs between clients, caches must keep them apart
+		addVary(w.Header(), "Origin")
 	}
 
 	w.Header().Set("Access-Control-Allow-Methods", joinStrings(cors.AllowMethods))
 	w.Header().Set("Access-Control-Allow-Headers", joinStrings(cors.AllowHeaders))
+	if len(cors.ExposeHeaders) > 0 {
+		w.Header().Set("Access-Control-Expose-Headers", joinStrings(cors.ExposeHeaders))
+	}
 
 	if cors.AllowCredentials {
 		w.Header().Set("Access-Control-Allow-Credentials", "true")
@@ -106,59 +127,367 @@ func joinStrings(slice []string) string {
 	return result
 }
 
-// setupRoutes sets up the routes based on configuration
-func (s *Server) setupRoutes() {
-	// Set up routes from configuration
+// defaultMethods are answered by routes that do not list their methods
+var defaultMethods = map[string][]string{
+	"static":     {http.MethodGet, http.MethodHead},
+	"static_dir": {http.MethodGet, http.MethodHead},
+	"sse":        {http.MethodGet, http.MethodHead},
+	"websocket":  {http.MethodGet},
+	"stream":     {http.MethodGet, http.MethodHead},
+	"long_poll":  {http.MethodGet},
+	"graphql":    {http.MethodGet, http.MethodPost},
+	"grpc":       {http.MethodGet, http.MethodPost},
+	"json":       {http.MethodPost},
+	"dummy":      {http.MethodPost},
+}
+
+// methodHandler answers the requests of one route on a shared path
+type methodHandler struct {
+	methods []string
+	cors    *config.CORSConfig
+	handler http.HandlerFunc
+}
+
+// allows reports whether the route answers a method; GET routes answer HEAD
+func (h methodHandler) allows(method string) bool {
+	for _, m := range h.methods {
+		if m == method || (m == http.MethodGet && method == http.MethodHead) {
+			return true
+		}
+	}
+	return false
+}
+
+// setupRoutes sets up the routes based on configuration. Routes sharing a
+// path are registered once and dispatched by method.
+func (s *Server) setupRoutes() error {
+	var paths []string
+	byPath := make(map[string][]methodHandler)
+
 	for _, route := range s.config.Routes {
-		routePath := route.Path
-		routeCORS := route.CORS
-		routeType := route.Type
-		filePath := route.FilePath
-		jsonContent := route.JSONContent
-		contentType := route.ContentType
-
-		// Default content type based on route type
-		if contentType == "" {
-			switch routeType {
-			case "static":
-				contentType = s.getContentTypeFromFile(filePath)
-			case "json", "dummy":
-				contentType = "application/json"
-			default:
-				contentType = "application/json"
+		// The admin endpoints are mounted after the routes, and would clash
+		if strings.HasPrefix(route.Path, config.AdminPrefix) {
+			return fmt.Errorf("route %s: path is reserved for the admin endpoints", route.Path)
+		}
+
+		handler, err := s.routeHandler(route)
+		if err != nil {
+			return fmt.Errorf("route %s: %w", route.Path, err)
+		}
+
+		methods := defaultMethods[route.Type]
+		if methods == nil {
+			methods = defaultMethods["dummy"]
+		}
+		if len(route.Methods) > 0 {
+			methods = nil
+			for _, m := range route.Methods {
+				methods = append(methods, strings.ToUpper(m))
 			}
 		}
 
-		// Create a handler for this route
-		s.mux.HandleFunc(routePath, func(w http.ResponseWriter, r *http.Request) {
-			// Set CORS headers
-			s.setCORSHeaders(w, r, routeCORS)
+		if _, ok := byPath[route.Path]; !ok {
+			paths = append(paths, route.Path)
+		}
+		byPath[route.Path] = append(byPath[route.Path], methodHandler{methods: methods, cors: route.CORS, handler: handler})
+	}
+
+	for _, path := range paths {
+		if err := s.handle(path, s.dispatch(byPath[path])); err != nil {
+			return fmt.Errorf("route %s: %w", path, err)
+		}
+	}
+
+	return nil
+}
+
+// handle registers a handler, reporting patterns the mux rejects, such as
+// wildcards conflicting with another route, instead of panicking
+func (s *Server) handle(pattern string, handler http.HandlerFunc) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+	s.mux.HandleFunc(pattern, handler)
+	return nil
+}
+
+// dispatch picks the route answering the request method. Preflights are
+// answered by the route for the method they ask about.
+func (s *Server) dispatch(handlers []methodHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		method := r.Method
+		if method == http.MethodOptions {
+			if requested := r.Header.Get("Access-Control-Request-Method"); requested != "" {
+				method = requested
+			}
+		}
 
-			// Handle OPTIONS method (CORS preflight)
-			if r.Method == http.MethodOptions {
-				w.WriteHeader(http.StatusOK)
+		for _, h := range handlers {
+			if h.allows(method) {
+				h.handler(w, r)
 				return
 			}
+		}
+
+		// Preflights for other methods still get the CORS headers
+		if r.Method == http.MethodOptions {
+			handlers[0].handler(w, r)
+			return
+		}
+
+		var allowed []string
+		for _, h := range handlers {
+			allowed = append(allowed, h.methods...)
+		}
+		s.setCORSHeaders(w, r, handlers[0].cors)
+		w.Header().Set("Allow", joinStrings(allowed))
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
 
-			// Handle different route types
-			switch routeType {
-			case "static":
-				s.handleStaticFile(w, r, filePath, contentType)
-			case "json":
-				s.handleJSONBlob(w, r, jsonContent, contentType)
-			case "dummy":
-				s.handleDummyResponse(w, r, contentType)
-			default:
-				// Default to dummy response for backward compatibility
-				s.handleDummyResponse(w, r, contentType)
+// routeHandler builds the handler of a single route
+func (s *Server) routeHandler(route config.Route) (http.HandlerFunc, error) {
+	routeCORS := route.CORS
+	routeType := route.Type
+	filePath := route.FilePath
+	jsonContent := route.JSONContent
+	contentType := route.ContentType
+
+	// Files are only served for GET and HEAD; other methods would always 405
+	if routeType == "static" || routeType == "static_dir" {
+		for _, method := range route.Methods {
+			if !config.IsFileMethod(method) {
+				return nil, fmt.Errorf("%s routes only answer GET and HEAD, not %s", routeType, method)
 			}
-		})
+		}
+	}
+
+	// Default content type based on route type
+	if contentType == "" {
+		switch routeType {
+		case "static":
+			contentType = s.getContentTypeFromFile(filePath)
+		case "sse":
+			contentType = "text/event-stream"
+		case "stream":
+			contentType = "text/plain; charset=utf-8"
+		case "json", "dummy":
+			contentType = "application/json"
+		default:
+			contentType = "application/json"
+		}
+	}
+
+	// Responses are compressed with the route's settings, or the global ones
+	compression := s.config.Compression
+	if route.Compression != nil {
+		compression = *route.Compression
+	}
+	comp := newCompressor(compression)
+
+	// Resolve the directory served by static_dir routes
+	var dir *staticDir
+	if routeType == "static_dir" {
+		d, err := newStaticDir(route)
+		if err != nil {
+			return nil, err
+		}
+		dir = d
+	}
+
+	// Prepare the event stream of sse routes
+	var stream *sseStream
+	if routeType == "sse" {
+		st, err := newSSEStream(route, contentType)
+		if err != nil {
+			return nil, err
+		}
+		stream = st
+	}
+
+	// Prepare the chunks of stream routes, and the waiting of long polls
+	var chunks *chunkStream
+	if routeType == "stream" {
+		cs, err := newChunkStream(route, contentType)
+		if err != nil {
+			return nil, err
+		}
+		chunks = cs
+	}
+	var poll *longPoll
+	if routeType == "long_poll" {
+		poll = newLongPoll(route, contentType, s.triggers)
+	}
+
+	// Load the schema of graphql routes
+	var endpoint *graphQLEndpoint
+	if routeType == "graphql" {
+		g, err := newGraphQLEndpoint(route, contentType)
+		if err != nil {
+			return nil, err
+		}
+		endpoint = g
+	}
+
+	// Load the services of grpc routes, whose clients need extra CORS headers
+	var service *grpcService
+	if routeType == "grpc" {
+		g, err := newGRPCService(route)
+		if err != nil {
+			return nil, err
+		}
+		service = g
+
+		cors := s.config.CORS
+		if routeCORS != nil {
+			cors = *routeCORS
+		}
+		routeCORS = service.cors(cors)
+	}
+
+	// Prepare the script of websocket routes, which check origins themselves
+	var script *webSocketScript
+	if routeType == "websocket" {
+		cors := s.config.CORS
+		if routeCORS != nil {
+			cors = *routeCORS
+		}
+		ws, err := newWebSocketScript(route, cors)
+		if err != nil {
+			return nil, err
+		}
+		script = ws
+	}
+
+	// Compile the header guard if the route requires partner headers
+	var guard *headerGuard
+	if route.RequireHeaders != nil {
+		g, err := newHeaderGuard(route.RequireHeaders)
+		if err != nil {
+			return nil, err
+		}
+		guard = g
 	}
+
+	// Build the bearer token verifier if the route requires a JWT
+	var verifier *jwtVerifier
+	if route.JWT != nil {
+		v, err := newJWTVerifier(route.JWT, s.oidc)
+		if err != nil {
+			return nil, err
+		}
+		verifier = v
+	}
+
+	// Prepare the session cookie handling
+	var session *sessionHandler
+	if route.Session != nil {
+		h, err := newSessionHandler(route.Session, s.sessions)
+		if err != nil {
+			return nil, err
+		}
+		session = h
+
+		// Cross-origin requests only carry the cookie when credentials are allowed
+		cors := s.config.CORS
+		if routeCORS != nil {
+			cors = *routeCORS
+		}
+		if !cors.AllowCredentials {
+			fmt.Printf("Warning: route %s uses sessions but CORS does not allow credentials\n", route.Path)
+		}
+	}
+
+	// Handle different route types; the method was checked by dispatch
+	respond := func(w http.ResponseWriter, r *http.Request) {
+		for name, value := range route.Headers {
+			w.Header().Set(name, value)
+		}
+		if route.CacheControl != "" {
+			w.Header().Set("Cache-Control", route.CacheControl)
+		}
+
+		switch routeType {
+		case "static":
+			s.handleStaticFile(w, r, filePath, contentType)
+		case "static_dir":
+			s.serveStaticDir(w, r, dir)
+		case "sse":
+			stream.serve(w, r)
+		case "websocket":
+			script.serve(w, r)
+		case "stream":
+			chunks.serve(w, r)
+		case "long_poll":
+			poll.serve(w, r)
+		case "graphql":
+			endpoint.serve(w, r)
+		case "grpc":
+			service.serve(w, r)
+		case "json":
+			s.writeJSONBlob(w, jsonContent, contentType, route.Status)
+		default:
+			// Default to dummy response for backward compatibility
+			s.writeDummyResponse(w, contentType, route.Status)
+		}
+	}
+
+	// Requests for operations of the OpenAPI spec are checked against it.
+	// WebSocket handshakes are left alone, and event and chunk streams are
+	// flushed as they go, so their responses cannot be buffered for validation.
+	if s.validator != nil && routeType != "websocket" {
+		respond = s.validator.wrap(respond, routeType == "sse" || routeType == "stream")
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Set CORS headers
+		s.setCORSHeaders(w, r, routeCORS)
+
+		// Handle OPTIONS method (CORS preflight)
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+
+		// Preflights are never guarded, everything else must carry the required headers
+		if guard != nil && !guard.check(w, r) {
+			return
+		}
+
+		// Likewise every non-preflight request needs a valid token
+		if verifier != nil && !verifier.authenticate(w, r) {
+			return
+		}
+
+		// Apply the session action, which may answer the request itself
+		if session != nil && !session.handle(w, r) {
+			return
+		}
+
+		if comp != nil {
+			cw, cr := comp.wrap(w, r)
+			defer cw.Close()
+			w, r = cw, cr
+		}
+		respond(w, r)
+	}, nil
 }
 
-// getContentTypeFromFile determines content type based on file extension
+// getContentTypeFromFile determines content type based on file extension.
+// Types configured in mime_types come first, then the built-in types, the
+// system MIME database and finally the content of the file.
 func (s *Server) getContentTypeFromFile(filePath string) string {
 	ext := strings.ToLower(filepath.Ext(filePath))
+	if s.config != nil && ext != "" {
+		for configured, contentType := range s.config.MimeTypes {
+			if strings.EqualFold(strings.TrimPrefix(configured, "."), ext[1:]) {
+				return contentType
+			}
+		}
+	}
+
 	switch ext {
 	case ".html", ".htm":
 		return "text/html"
@@ -182,12 +511,57 @@ func (s *Server) getContentTypeFromFile(filePath string) string {
 		return "image/svg+xml"
 	case ".pdf":
 		return "application/pdf"
-	default:
+	}
+
+	if contentType, ok := extraMimeTypes[ext]; ok {
+		return contentType
+	}
+	if contentType := mime.TypeByExtension(ext); ext != "" && contentType != "" {
+		return contentType
+	}
+	return sniffContentType(filePath)
+}
+
+// extraMimeTypes are types browsers insist on, e.g. for module scripts and
+// WebAssembly, which system MIME databases often lack
+var extraMimeTypes = map[string]string{
+	".mjs":         "application/javascript",
+	".wasm":        "application/wasm",
+	".map":         "application/json",
+	".webmanifest": "application/manifest+json",
+	".webp":        "image/webp",
+	".avif":        "image/avif",
+	".ico":         "image/x-icon",
+	".woff":        "font/woff",
+	".woff2":       "font/woff2",
+	".ttf":         "font/ttf",
+	".otf":         "font/otf",
+	".mp4":         "video/mp4",
+	".webm":        "video/webm",
+	".mp3":         "audio/mpeg",
+	".csv":         "text/csv",
+	".md":          "text/markdown",
+}
+
+// sniffContentType detects the content type from the first bytes of a file,
+// falling back to application/octet-stream
+func sniffContentType(filePath string) string {
+	file, err := os.Open(filePath)
+	if err != nil {
 		return "application/octet-stream"
 	}
+	defer file.Close()
+
+	buf := make([]byte, 512)
+	n, _ := io.ReadFull(file, buf)
+	if n == 0 {
+		return "application/octet-stream"
+	}
+	return http.DetectContentType(buf[:n])
 }
 
-// handleStaticFile serves a static file
+// handleStaticFile serves a static file, answering conditional requests
+// with 304 Not Modified and range requests with 206 Partial Content
 func (s *Server) handleStaticFile(w http.ResponseWriter, r *http.Request, filePath, contentType string) {
 	// Only allow GET and HEAD methods for static files
 	if r.Method != http.MethodGet && r.Method != http.MethodHead {
@@ -196,11 +570,18 @@ func (s *Server) handleStaticFile(w http.ResponseWriter, r *http.Request, filePa
 	}
 
 	// Check if file exists
-	if _, err := os.Stat(filePath); os.IsNotExist(err) {
+	info, err := os.Stat(filePath)
+	if os.IsNotExist(err) || (err == nil && info.IsDir()) {
 		http.Error(w, "File not found", http.StatusNotFound)
 		return
 	}
 
+	// Serve a precompressed sibling such as app.js.br when the route allows it
+	if sibling, encoding, siblingInfo, ok := precompressedFile(w, r, filePath); ok {
+		w.Header().Set("Content-Encoding", encoding)
+		filePath, info = sibling, siblingInfo
+	}
+
 	// Open the file
 	file, err := os.Open(filePath)
 	if err != nil {
@@ -212,45 +593,50 @@ func (s *Server) handleStaticFile(w http.ResponseWriter, r *http.Request, filePa
 	// Set content type header
 	w.Header().Set("Content-Type", contentType)
 
-	// Set status code
-	w.WriteHeader(http.StatusOK)
-
-	// Copy file content to response (skip for HEAD requests)
-	if r.Method != http.MethodHead {
-		io.Copy(w, file)
+	// Validators for conditional requests; a configured ETag header wins
+	if w.Header().Get("ETag") == "" {
+		w.Header().Set("ETag", fileETag(info))
 	}
+
+	// ServeContent handles If-None-Match, If-Modified-Since, Range and HEAD
+	http.ServeContent(w, r, filePath, info.ModTime(), file)
 }
 
-// handleJSONBlob serves a JSON blob from configuration
-func (s *Server) handleJSONBlob(w http.ResponseWriter, r *http.Request, jsonContent, contentType string) {
-	// Only allow POST method for JSON blob endpoints
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
+// fileETag derives a strong ETag from the modification time and size of a
+// file, which change whenever its content is replaced
+func fileETag(info os.FileInfo) string {
+	return fmt.Sprintf("\"%x-%x\"", info.ModTime().UnixNano(), info.Size())
+}
 
+// writeJSONBlob writes a JSON blob from configuration. A zero status means
+// 200; with an explicit status the body may be empty.
+func (s *Server) writeJSONBlob(w http.ResponseWriter, jsonContent, contentType string, status int) {
 	// Validate JSON content
-	if jsonContent == "" {
+	if jsonContent == "" && status == 0 {
 		http.Error(w, "No JSON content configured", http.StatusInternalServerError)
 		return
 	}
+	if status == 0 {
+		status = http.StatusOK
+	}
 
 	// Set content type header
-	w.Header().Set("Content-Type", contentType)
+	if jsonContent != "" {
+		w.Header().Set("Content-Type", contentType)
+	}
 
 	// Set status code
-	w.WriteHeader(http.StatusOK)
+	w.WriteHeader(status)
 
 	// Write JSON content
 	w.Write([]byte(jsonContent))
 }
 
-// handleDummyResponse serves the hardcoded dummy response
-func (s *Server) handleDummyResponse(w http.ResponseWriter, r *http.Request, contentType string) {
-	// Only allow POST method for dummy response
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
+// writeDummyResponse writes the hardcoded dummy response. A zero status
+// means 200.
+func (s *Server) writeDummyResponse(w http.ResponseWriter, contentType string, status int) {
+	if status == 0 {
+		status = http.StatusOK
 	}
 
 	// Create dummy response data
@@ -266,22 +652,75 @@ func (s *Server) handleDummyResponse(w http.ResponseWriter, r *http.Request, con
 	w.Header().Set("Content-Type", contentType)
 
 	// Set status code
-	w.WriteHeader(http.StatusOK)
+	w.WriteHeader(status)
 
 	// Encode and send the response
 	json.NewEncoder(w).Encode(responseData)
 }
 
-// Start starts the server
+// Start starts the server and blocks until it fails, or is interrupted.
+// On interrupt the server shuts down gracefully and writes the recorded
+// traffic to the HAR file, when one is configured.
 func (s *Server) Start() error {
+	// Set up the mock identity provider
+	if err := s.setupOIDC(); err != nil {
+		return err
+	}
+
+	// Add the routes described by the OpenAPI spec
+	if err := s.setupOpenAPI(); err != nil {
+		return err
+	}
+
 	// Set up routes
-	s.setupRoutes()
+	if err := s.setupRoutes(); err != nil {
+		return err
+	}
+	s.setupAdmin()
+
+	// Record the traffic, then wrap everything with the logging middleware
+	handler := s.loggingMiddleware(s.trackUpgrades(s.recorder.middleware(s.mux)))
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-	// Wrap the mux with the logging middleware
-	loggingHandler := s.loggingMiddleware(s.mux)
+	// Requests share a context canceled on shutdown, which ends open streams
+	baseCtx, cancelRequests := context.WithCancel(context.Background())
+	defer cancelRequests()
 
 	// Start the server
-	addr := fmt.Sprintf(":%d", s.config.Port)
+	srv := &http.Server{
+		Addr:        fmt.Sprintf(":%d", s.config.Port),
+		Handler:     handler,
+		BaseContext: func(net.Listener) context.Context { return baseCtx },
+	}
+	errs := make(chan error, 1)
+	go func() {
+		errs <- srv.ListenAndServe()
+	}()
 	fmt.Printf("Server running on http://localhost:%d\n", s.config.Port)
-	return http.ListenAndServe(addr, loggingHandler)
+
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+	}
+
+	fmt.Println("Shutting down")
+	cancelRequests()
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		fmt.Printf("Warning: %v\n", err)
+	}
+	s.waitForUpgrades(shutdownCtx)
+
+	if s.config.HAR.Out != "" {
+		n, err := s.recorder.writeFile(s.config.HAR.Out)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Wrote %d requests to %s\n", n, s.config.HAR.Out)
+	}
+	return nil
 }
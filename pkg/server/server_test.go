@@ -5,7 +5,10 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/developmeh/mock-cors-server/internal/config"
 )
@@ -55,6 +58,12 @@ func TestGetContentTypeFromFile(t *testing.T) {
 		{"test.gif", "image/gif"},
 		{"test.svg", "image/svg+xml"},
 		{"test.pdf", "application/pdf"},
+		{"module.mjs", "application/javascript"},
+		{"app.wasm", "application/wasm"},
+		{"font.woff2", "font/woff2"},
+		{"app.js.map", "application/json"},
+		{"photo.webp", "image/webp"},
+		{"photo.AVIF", "image/avif"},
 		{"test.unknown", "application/octet-stream"},
 		{"test", "application/octet-stream"},
 	}
@@ -69,8 +78,55 @@ func TestGetContentTypeFromFile(t *testing.T) {
 	}
 }
 
+func TestGetContentTypeFromFileConfigured(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string][]byte{
+		"logo":      []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"),
+		"page":      []byte("<!DOCTYPE html><html></html>"),
+		"data.bin":  {0x00, 0x01, 0x02},
+		"empty.xyz": {},
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), content, 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+
+	server := New(&config.Config{MimeTypes: map[string]string{
+		"js":     "text/javascript",
+		"custom": "application/vnd.custom+json",
+	}})
+
+	tests := []struct {
+		filePath   string
+		expectedCT string
+	}{
+		{"app.js", "text/javascript"},
+		{"app.JS", "text/javascript"},
+		{"x.custom", "application/vnd.custom+json"},
+		{"app.wasm", "application/wasm"},
+		{filepath.Join(dir, "logo"), "image/png"},
+		{filepath.Join(dir, "page"), "text/html; charset=utf-8"},
+		{filepath.Join(dir, "data.bin"), "application/octet-stream"},
+		{filepath.Join(dir, "empty.xyz"), "application/octet-stream"},
+	}
+
+	for _, tt := range tests {
+		t.Run(filepath.Base(tt.filePath), func(t *testing.T) {
+			if ct := server.getContentTypeFromFile(tt.filePath); ct != tt.expectedCT {
+				t.Errorf("Expected content type %s for %s, got %s", tt.expectedCT, tt.filePath, ct)
+			}
+		})
+	}
+}
+
 func TestHandleDummyResponse(t *testing.T) {
-	server := &Server{}
+	server := New(&config.Config{
+		Routes: []config.Route{{Path: "/test", Type: "dummy", ContentType: "application/json"}},
+	})
+	if err := server.setupRoutes(); err != nil {
+		t.Fatalf("Expected routes to be set up, got %v", err)
+	}
 
 	tests := []struct {
 		name           string
@@ -103,7 +159,7 @@ func TestHandleDummyResponse(t *testing.T) {
 			req := httptest.NewRequest(tt.method, "/test", nil)
 			w := httptest.NewRecorder()
 
-			server.handleDummyResponse(w, req, "application/json")
+			server.mux.ServeHTTP(w, req)
 
 			if w.Code != tt.expectedStatus {
 				t.Errorf("Expected status %d, got %d", tt.expectedStatus, w.Code)
@@ -137,8 +193,6 @@ func TestHandleDummyResponse(t *testing.T) {
 }
 
 func TestHandleJSONBlob(t *testing.T) {
-	server := &Server{}
-
 	tests := []struct {
 		name           string
 		method         string
@@ -171,10 +225,17 @@ func TestHandleJSONBlob(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
+			server := New(&config.Config{
+				Routes: []config.Route{{Path: "/test", Type: "json", JSONContent: tt.jsonContent, ContentType: "application/json"}},
+			})
+			if err := server.setupRoutes(); err != nil {
+				t.Fatalf("Expected routes to be set up, got %v", err)
+			}
+
 			req := httptest.NewRequest(tt.method, "/test", nil)
 			w := httptest.NewRecorder()
 
-			server.handleJSONBlob(w, req, tt.jsonContent, "application/json")
+			server.mux.ServeHTTP(w, req)
 
 			if w.Code != tt.expectedStatus {
 				t.Errorf("Expected status %d, got %d", tt.expectedStatus, w.Code)
@@ -279,6 +340,113 @@ func TestHandleStaticFile(t *testing.T) {
 	}
 }
 
+func TestHandleStaticFileConditional(t *testing.T) {
+	server := &Server{}
+
+	file := filepath.Join(t.TempDir(), "video.txt")
+	if err := os.WriteFile(file, []byte("0123456789"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	modified := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	if err := os.Chtimes(file, modified, modified); err != nil {
+		t.Fatalf("Failed to set modification time: %v", err)
+	}
+
+	serve := func(headers map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/test", nil)
+		for name, value := range headers {
+			req.Header.Set(name, value)
+		}
+		w := httptest.NewRecorder()
+		server.handleStaticFile(w, req, file, "text/plain")
+		return w
+	}
+
+	w := serve(nil)
+	etag := w.Header().Get("ETag")
+	if w.Code != http.StatusOK || etag == "" || w.Header().Get("Last-Modified") != "Tue, 02 Jan 2024 03:04:05 GMT" {
+		t.Fatalf("Expected validators, got %d %v", w.Code, w.Header())
+	}
+	if w.Header().Get("Accept-Ranges") != "bytes" {
+		t.Errorf("Expected Accept-Ranges: bytes, got %v", w.Header())
+	}
+
+	tests := []struct {
+		name           string
+		headers        map[string]string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{name: "matching etag", headers: map[string]string{"If-None-Match": etag}, expectedStatus: http.StatusNotModified},
+		{name: "other etag", headers: map[string]string{"If-None-Match": `"other"`}, expectedStatus: http.StatusOK, expectedBody: "0123456789"},
+		{name: "not modified since", headers: map[string]string{"If-Modified-Since": "Wed, 03 Jan 2024 00:00:00 GMT"}, expectedStatus: http.StatusNotModified},
+		{name: "modified since", headers: map[string]string{"If-Modified-Since": "Mon, 01 Jan 2024 00:00:00 GMT"}, expectedStatus: http.StatusOK, expectedBody: "0123456789"},
+		{name: "range", headers: map[string]string{"Range": "bytes=2-5"}, expectedStatus: http.StatusPartialContent, expectedBody: "2345"},
+		{name: "suffix range", headers: map[string]string{"Range": "bytes=-3"}, expectedStatus: http.StatusPartialContent, expectedBody: "789"},
+		{name: "unsatisfiable range", headers: map[string]string{"Range": "bytes=20-"}, expectedStatus: http.StatusRequestedRangeNotSatisfiable},
+		{name: "range of the current version", headers: map[string]string{"Range": "bytes=0-0", "If-Range": etag}, expectedStatus: http.StatusPartialContent, expectedBody: "0"},
+		{name: "range of a stale version", headers: map[string]string{"Range": "bytes=0-0", "If-Range": `"stale"`}, expectedStatus: http.StatusOK, expectedBody: "0123456789"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(tt.headers)
+			if w.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+			if tt.expectedBody != "" && w.Body.String() != tt.expectedBody {
+				t.Errorf("Expected body %q, got %q", tt.expectedBody, w.Body.String())
+			}
+		})
+	}
+
+	t.Run("content range", func(t *testing.T) {
+		w := serve(map[string]string{"Range": "bytes=2-5"})
+		if w.Header().Get("Content-Range") != "bytes 2-5/10" {
+			t.Errorf("Expected Content-Range: bytes 2-5/10, got %v", w.Header())
+		}
+	})
+}
+
+func TestRouteCacheControl(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "sw.js")
+	if err := os.WriteFile(file, []byte("self.addEventListener('fetch', () => {})"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	cfg := &config.Config{
+		Routes: []config.Route{
+			{Path: "/sw.js", Type: "static", FilePath: file, CacheControl: "no-cache"},
+			{Path: "/api", Type: "json", JSONContent: `{}`, CacheControl: "no-store"},
+		},
+	}
+	server := New(cfg)
+	if err := server.setupRoutes(); err != nil {
+		t.Fatalf("Expected routes to be set up, got %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	server.mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/sw.js", nil))
+	if w.Header().Get("Cache-Control") != "no-cache" {
+		t.Errorf("Expected Cache-Control: no-cache, got %v", w.Header())
+	}
+
+	// Revalidation keeps the caching policy
+	req := httptest.NewRequest(http.MethodGet, "/sw.js", nil)
+	req.Header.Set("If-None-Match", w.Header().Get("ETag"))
+	w = httptest.NewRecorder()
+	server.mux.ServeHTTP(w, req)
+	if w.Code != http.StatusNotModified || w.Header().Get("Cache-Control") != "no-cache" {
+		t.Errorf("Expected 304 with Cache-Control, got %d %v", w.Code, w.Header())
+	}
+
+	w = httptest.NewRecorder()
+	server.mux.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api", nil))
+	if w.Header().Get("Cache-Control") != "no-store" {
+		t.Errorf("Expected Cache-Control: no-store, got %v", w.Header())
+	}
+}
+
 func TestSetCORSHeaders(t *testing.T) {
 	cfg := &config.Config{
 		CORS: config.CORSConfig{
@@ -320,6 +488,7 @@ func TestSetCORSHeaders(t *testing.T) {
 				AllowOrigins:     []string{"https://route-specific.com"},
 				AllowMethods:     []string{"POST"},
 				AllowHeaders:     []string{"Content-Type"},
+				ExposeHeaders:    []string{"X-Total-Count", "ETag"},
 				AllowCredentials: false,
 				MaxAge:           1800,
 			},
@@ -354,6 +523,14 @@ func TestSetCORSHeaders(t *testing.T) {
 				t.Error("Expected Access-Control-Allow-Headers to be set")
 			}
 
+			// Only configured exposed headers are listed
+			exposeHeaders := w.Header().Get("Access-Control-Expose-Headers")
+			if tt.routeCORS != nil && exposeHeaders != "X-Total-Count, ETag" {
+				t.Errorf("Expected Access-Control-Expose-Headers X-Total-Count, ETag, got %q", exposeHeaders)
+			} else if tt.routeCORS == nil && exposeHeaders != "" {
+				t.Errorf("Expected no Access-Control-Expose-Headers, got %q", exposeHeaders)
+			}
+
 			maxAge := w.Header().Get("Access-Control-Max-Age")
 			if maxAge == "" {
 				t.Error("Expected Access-Control-Max-Age to be set")
@@ -532,3 +709,124 @@ func TestSetupRoutes(t *testing.T) {
 		}
 	})
 }
+
+func TestSetupRoutesMethods(t *testing.T) {
+	cfg := &config.Config{
+		Port: 8081,
+		Routes: []config.Route{
+			{
+				Path:        "/pets/{id}",
+				Type:        "json",
+				Methods:     []string{"GET"},
+				JSONContent: `{"id": 1}`,
+				ContentType: "application/json",
+				Headers:     map[string]string{"X-Request-Id": "abc"},
+			},
+			{
+				Path:    "/pets/{id}",
+				Type:    "json",
+				Methods: []string{"delete"},
+				Status:  http.StatusNoContent,
+			},
+			{
+				Path:   "/pets",
+				Type:   "dummy",
+				Status: http.StatusCreated,
+			},
+		},
+		CORS: config.CORSConfig{
+			AllowOrigins: []string{"*"},
+			AllowMethods: []string{"GET", "POST", "DELETE", "OPTIONS"},
+		},
+	}
+
+	server := New(cfg)
+	if err := server.setupRoutes(); err != nil {
+		t.Fatalf("Expected routes to be set up, got %v", err)
+	}
+
+	tests := []struct {
+		name           string
+		method         string
+		path           string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{name: "get", method: http.MethodGet, path: "/pets/7", expectedStatus: http.StatusOK, expectedBody: `{"id": 1}`},
+		{name: "head answered by get", method: http.MethodHead, path: "/pets/7", expectedStatus: http.StatusOK},
+		{name: "delete without body", method: http.MethodDelete, path: "/pets/7", expectedStatus: http.StatusNoContent},
+		{name: "unlisted method", method: http.MethodPut, path: "/pets/7", expectedStatus: http.StatusMethodNotAllowed},
+		{name: "default methods with status", method: http.MethodPost, path: "/pets", expectedStatus: http.StatusCreated},
+		{name: "default methods reject get", method: http.MethodGet, path: "/pets", expectedStatus: http.StatusMethodNotAllowed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			w := httptest.NewRecorder()
+
+			server.mux.ServeHTTP(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+			if tt.expectedBody != "" && w.Body.String() != tt.expectedBody {
+				t.Errorf("Expected body %s, got %s", tt.expectedBody, w.Body.String())
+			}
+		})
+	}
+
+	t.Run("route headers", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/pets/7", nil)
+		w := httptest.NewRecorder()
+		server.mux.ServeHTTP(w, req)
+
+		if w.Header().Get("X-Request-Id") != "abc" {
+			t.Errorf("Expected route header, got %v", w.Header())
+		}
+	})
+
+	t.Run("allow header", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPatch, "/pets/7", nil)
+		w := httptest.NewRecorder()
+		server.mux.ServeHTTP(w, req)
+
+		if allow := w.Header().Get("Allow"); allow != "GET, DELETE" {
+			t.Errorf("Expected Allow: GET, DELETE, got %q", allow)
+		}
+	})
+
+	t.Run("preflight for a listed method", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodOptions, "/pets/7", nil)
+		req.Header.Set("Origin", "https://example.com")
+		req.Header.Set("Access-Control-Request-Method", "DELETE")
+		w := httptest.NewRecorder()
+		server.mux.ServeHTTP(w, req)
+
+		if w.Code != http.StatusOK || w.Header().Get("Access-Control-Allow-Origin") == "" {
+			t.Errorf("Expected preflight with CORS headers, got %d %v", w.Code, w.Header())
+		}
+	})
+}
+
+func TestSetupRoutesInvalidPattern(t *testing.T) {
+	cfg := &config.Config{
+		Routes: []config.Route{{Path: "/pets/{id", Type: "dummy"}},
+	}
+
+	if err := New(cfg).setupRoutes(); err == nil {
+		t.Error("Expected an error for an invalid pattern")
+	}
+}
+
+func TestSetupRoutesStaticMethods(t *testing.T) {
+	cfg := &config.Config{
+		Routes: []config.Route{{Path: "/file", Type: "static", FilePath: "server.go", Methods: []string{"PUT"}}},
+	}
+
+	// The route would answer every request with 405, so it is refused
+	err := New(cfg).setupRoutes()
+	if err == nil || !strings.Contains(err.Error(), "static routes only answer GET and HEAD") {
+		t.Errorf("Expected a static methods error, got %v", err)
+	}
+}
@@ -0,0 +1,175 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/developmeh/mock-cors-server/internal/config"
+)
+
+const defaultSessionCookie = "mock_session"
+
+// sessionStore keeps session values in memory, keyed by session ID
+type sessionStore struct {
+	mu       sync.Mutex
+	sessions map[string]map[string]string
+}
+
+// newSessionStore creates an empty session store
+func newSessionStore() *sessionStore {
+	return &sessionStore{sessions: make(map[string]map[string]string)}
+}
+
+// create stores a copy of values under a new session ID
+func (st *sessionStore) create(values map[string]string) string {
+	b := make([]byte, 18)
+	rand.Read(b)
+	id := base64.RawURLEncoding.EncodeToString(b)
+
+	copied := make(map[string]string, len(values))
+	for k, v := range values {
+		copied[k] = v
+	}
+
+	st.mu.Lock()
+	st.sessions[id] = copied
+	st.mu.Unlock()
+	return id
+}
+
+// get returns a copy of the values of a session
+func (st *sessionStore) get(id string) (map[string]string, bool) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	values, ok := st.sessions[id]
+	if !ok {
+		return nil, false
+	}
+	copied := make(map[string]string, len(values))
+	for k, v := range values {
+		copied[k] = v
+	}
+	return copied, true
+}
+
+// delete removes a session
+func (st *sessionStore) delete(id string) {
+	st.mu.Lock()
+	delete(st.sessions, id)
+	st.mu.Unlock()
+}
+
+// sessionHandler applies a route's session configuration
+type sessionHandler struct {
+	store    *sessionStore
+	action   string
+	values   map[string]string
+	template http.Cookie
+}
+
+// newSessionHandler validates a route's session configuration
+func newSessionHandler(cfg *config.SessionConfig, store *sessionStore) (*sessionHandler, error) {
+	action := strings.ToLower(cfg.Action)
+	switch action {
+	case "set", "require", "read", "clear":
+	default:
+		return nil, fmt.Errorf("unknown session action %q (expected set, require, read or clear)", cfg.Action)
+	}
+
+	cookie := http.Cookie{
+		Name:     cfg.CookieName,
+		Path:     cfg.Path,
+		Domain:   cfg.Domain,
+		MaxAge:   cfg.MaxAge,
+		Secure:   cfg.Secure,
+		HttpOnly: cfg.HTTPOnly == nil || *cfg.HTTPOnly,
+	}
+	if cookie.Name == "" {
+		cookie.Name = defaultSessionCookie
+	}
+	if cookie.Path == "" {
+		cookie.Path = "/"
+	}
+
+	switch strings.ToLower(cfg.SameSite) {
+	case "":
+		cookie.SameSite = http.SameSiteDefaultMode
+	case "lax":
+		cookie.SameSite = http.SameSiteLaxMode
+	case "strict":
+		cookie.SameSite = http.SameSiteStrictMode
+	case "none":
+		cookie.SameSite = http.SameSiteNoneMode
+		if !cookie.Secure {
+			// Browsers drop SameSite=None cookies that are not Secure
+			fmt.Printf("Warning: session cookie %s uses SameSite=None without Secure and will be rejected by browsers\n", cookie.Name)
+		}
+	default:
+		return nil, fmt.Errorf("unknown same_site value %q (expected lax, strict or none)", cfg.SameSite)
+	}
+
+	return &sessionHandler{
+		store:    store,
+		action:   action,
+		values:   cfg.Values,
+		template: cookie,
+	}, nil
+}
+
+// handle runs the session action. It returns false when it has written the
+// response itself, either because the session is missing or because the
+// action is "read".
+func (h *sessionHandler) handle(w http.ResponseWriter, r *http.Request) bool {
+	switch h.action {
+	case "set":
+		cookie := h.template
+		cookie.Value = h.store.create(h.values)
+		http.SetCookie(w, &cookie)
+		return true
+
+	case "clear":
+		if existing, err := r.Cookie(h.template.Name); err == nil {
+			h.store.delete(existing.Value)
+		}
+		cookie := h.template
+		cookie.MaxAge = -1
+		http.SetCookie(w, &cookie)
+		return true
+	}
+
+	// require and read both need a live session with matching values
+	values, ok := h.current(r)
+	if !ok {
+		writeAuthError(w, http.StatusUnauthorized, "session_required", fmt.Sprintf("a valid %s cookie is required", h.template.Name))
+		return false
+	}
+	for key, want := range h.values {
+		if values[key] != want {
+			writeAuthError(w, http.StatusForbidden, "session_mismatch", fmt.Sprintf("session value %s does not match", key))
+			return false
+		}
+	}
+
+	if h.action == "read" {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(values)
+		return false
+	}
+	return true
+}
+
+// current returns the values of the session referenced by the request cookie
+func (h *sessionHandler) current(r *http.Request) (map[string]string, bool) {
+	cookie, err := r.Cookie(h.template.Name)
+	if err != nil {
+		return nil, false
+	}
+	return h.store.get(cookie.Value)
+}
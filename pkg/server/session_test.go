@@ -0,0 +1,143 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/developmeh/mock-cors-server/internal/config"
+)
+
+func TestSessionFlow(t *testing.T) {
+	cfg := &config.Config{
+		Routes: []config.Route{
+			{
+				Path:        "/login",
+				Type:        "json",
+				JSONContent: `{"loggedIn": true}`,
+				Session: &config.SessionConfig{
+					Action:   "set",
+					Values:   map[string]string{"user": "alice", "role": "admin"},
+					SameSite: "none",
+					Secure:   true,
+					MaxAge:   600,
+				},
+			},
+			{
+				Path:        "/admin",
+				Type:        "json",
+				JSONContent: `{"admin": true}`,
+				Session:     &config.SessionConfig{Action: "require", Values: map[string]string{"role": "admin"}},
+			},
+			{
+				Path:    "/me",
+				Type:    "json",
+				Session: &config.SessionConfig{Action: "read"},
+			},
+			{
+				Path:        "/logout",
+				Type:        "json",
+				JSONContent: `{"loggedIn": false}`,
+				Session:     &config.SessionConfig{Action: "clear"},
+			},
+		},
+		CORS: config.CORSConfig{
+			AllowOrigins:     []string{"https://app.example.com"},
+			AllowMethods:     []string{"POST", "OPTIONS"},
+			AllowCredentials: true,
+		},
+	}
+
+	server := New(cfg)
+	if err := server.setupRoutes(); err != nil {
+		t.Fatalf("Failed to set up routes: %v", err)
+	}
+
+	do := func(path string, cookie *http.Cookie) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, nil)
+		req.Header.Set("Origin", "https://app.example.com")
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+		w := httptest.NewRecorder()
+		server.mux.ServeHTTP(w, req)
+		return w
+	}
+
+	// Protected routes reject requests without a session
+	if w := do("/admin", nil); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status 401 without session, got %d", w.Code)
+	}
+
+	w := do("/login", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected login status 200, got %d", w.Code)
+	}
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 {
+		t.Fatalf("Expected one cookie, got %d", len(cookies))
+	}
+	session := cookies[0]
+	if session.Name != "mock_session" || !session.HttpOnly || !session.Secure || session.SameSite != http.SameSiteNoneMode || session.MaxAge != 600 {
+		t.Errorf("Unexpected cookie attributes: %+v", session)
+	}
+	if w.Header().Get("Access-Control-Allow-Credentials") != "true" {
+		t.Error("Expected credentialed CORS response")
+	}
+
+	if w := do("/admin", session); w.Code != http.StatusOK {
+		t.Errorf("Expected status 200 with session, got %d", w.Code)
+	}
+
+	w = do("/me", session)
+	var values map[string]string
+	if err := json.Unmarshal(w.Body.Bytes(), &values); err != nil {
+		t.Fatalf("Expected JSON session values, got error: %v", err)
+	}
+	if values["user"] != "alice" {
+		t.Errorf("Expected user alice in session, got %v", values)
+	}
+
+	w = do("/logout", session)
+	cleared := w.Result().Cookies()
+	if len(cleared) != 1 || cleared[0].MaxAge >= 0 {
+		t.Errorf("Expected logout to expire the cookie, got %+v", cleared)
+	}
+
+	if w := do("/admin", session); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status 401 after logout, got %d", w.Code)
+	}
+}
+
+func TestSessionValueMismatch(t *testing.T) {
+	store := newSessionStore()
+	id := store.create(map[string]string{"role": "viewer"})
+
+	handler, err := newSessionHandler(&config.SessionConfig{Action: "require", Values: map[string]string{"role": "admin"}}, store)
+	if err != nil {
+		t.Fatalf("Failed to create session handler: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/test", nil)
+	req.AddCookie(&http.Cookie{Name: "mock_session", Value: id})
+	w := httptest.NewRecorder()
+
+	if handler.handle(w, req) {
+		t.Error("Expected request with mismatching session value to be rejected")
+	}
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Expected status 403, got %d", w.Code)
+	}
+}
+
+func TestSessionInvalidConfig(t *testing.T) {
+	store := newSessionStore()
+
+	if _, err := newSessionHandler(&config.SessionConfig{Action: "destroy"}, store); err == nil {
+		t.Error("Expected error for unknown action")
+	}
+	if _, err := newSessionHandler(&config.SessionConfig{Action: "set", SameSite: "sometimes"}, store); err == nil {
+		t.Error("Expected error for unknown same_site value")
+	}
+}
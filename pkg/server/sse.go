@@ -0,0 +1,133 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/developmeh/mock-cors-server/internal/config"
+)
+
+// sseStream streams the events of an sse route
+type sseStream struct {
+	events      []config.SSEEvent
+	loop        bool
+	contentType string
+	status      int
+}
+
+// newSSEStream prepares an sse route
+func newSSEStream(route config.Route, contentType string) (*sseStream, error) {
+	if len(route.Events) == 0 {
+		return nil, fmt.Errorf("events are required for sse routes")
+	}
+	if route.Loop {
+		var total int
+		for _, event := range route.Events {
+			total += event.Delay
+		}
+		if total <= 0 {
+			return nil, fmt.Errorf("looping streams need a delay on at least one event")
+		}
+	}
+
+	status := route.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	return &sseStream{events: route.Events, loop: route.Loop, contentType: contentType, status: status}, nil
+}
+
+// serve streams the events, resuming after the one named by Last-Event-ID.
+// Without loop the stream stays open once the events are sent, like a real
+// server with nothing more to say, until the client goes away.
+func (st *sseStream) serve(w http.ResponseWriter, r *http.Request) {
+	header := w.Header()
+	header.Set("Content-Type", st.contentType)
+	if header.Get("Cache-Control") == "" {
+		header.Set("Cache-Control", "no-cache")
+	}
+	header.Set("X-Accel-Buffering", "no") // Keep reverse proxies from buffering the stream
+	w.WriteHeader(st.status)
+
+	rc := http.NewResponseController(w)
+	if r.Method == http.MethodHead || st.status != http.StatusOK {
+		return
+	}
+	if err := rc.Flush(); err != nil {
+		fmt.Printf("Warning: %s cannot stream events: %v\n", r.URL.Path, err)
+		return
+	}
+
+	next := st.resumeIndex(r)
+	for {
+		for ; next < len(st.events); next++ {
+			event := st.events[next]
+			if event.Delay > 0 {
+				timer := time.NewTimer(time.Duration(event.Delay) * time.Millisecond)
+				select {
+				case <-r.Context().Done():
+					timer.Stop()
+					return
+				case <-timer.C:
+				}
+			}
+
+			if _, err := w.Write(formatEvent(event)); err != nil {
+				return
+			}
+			if err := rc.Flush(); err != nil {
+				return
+			}
+		}
+		if !st.loop {
+			break
+		}
+		next = 0
+	}
+
+	<-r.Context().Done()
+}
+
+// resumeIndex returns the index of the first event to send: the one after
+// the event named by Last-Event-ID, or by the lastEventId query parameter
+// of EventSource polyfills that cannot set headers
+func (st *sseStream) resumeIndex(r *http.Request) int {
+	lastID := r.Header.Get("Last-Event-ID")
+	if lastID == "" {
+		lastID = r.URL.Query().Get("lastEventId")
+	}
+	if lastID == "" {
+		return 0
+	}
+	for i, event := range st.events {
+		if event.ID == lastID {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// formatEvent encodes an event in the text/event-stream format
+func formatEvent(event config.SSEEvent) []byte {
+	var b strings.Builder
+	if event.Event != "" {
+		fmt.Fprintf(&b, "event: %s\n", event.Event)
+	}
+	if event.ID != "" {
+		fmt.Fprintf(&b, "id: %s\n", event.ID)
+	}
+	if event.Retry > 0 {
+		fmt.Fprintf(&b, "retry: %d\n", event.Retry)
+	}
+	if event.Data != "" {
+		data := strings.ReplaceAll(strings.ReplaceAll(event.Data, "\r\n", "\n"), "\r", "\n")
+		data = strings.TrimSuffix(data, "\n") // Left by YAML block scalars
+		for _, line := range strings.Split(data, "\n") {
+			fmt.Fprintf(&b, "data: %s\n", line)
+		}
+	}
+	b.WriteString("\n")
+	return []byte(b.String())
+}
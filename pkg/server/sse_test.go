@@ -0,0 +1,207 @@
+package server
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/developmeh/mock-cors-server/internal/config"
+)
+
+func TestFormatEvent(t *testing.T) {
+	tests := []struct {
+		name     string
+		event    config.SSEEvent
+		expected string
+	}{
+		{name: "data", event: config.SSEEvent{Data: "hello"}, expected: "data: hello\n\n"},
+		{name: "all fields", event: config.SSEEvent{Event: "notice", ID: "7", Data: `{"n": 1}`, Retry: 3000}, expected: "event: notice\nid: 7\nretry: 3000\ndata: {\"n\": 1}\n\n"},
+		{name: "multi-line data", event: config.SSEEvent{Data: "line 1\r\nline 2\n"}, expected: "data: line 1\ndata: line 2\n\n"},
+		{name: "retry only", event: config.SSEEvent{Retry: 100}, expected: "retry: 100\n\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := string(formatEvent(tt.event)); got != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+// readEvents reads n events from a stream, returning their id and data lines
+func readEvents(t *testing.T, scanner *bufio.Scanner, n int) []string {
+	t.Helper()
+	var events []string
+	var current []string
+	for len(events) < n && scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			events = append(events, strings.Join(current, "|"))
+			current = nil
+			continue
+		}
+		if strings.HasPrefix(line, "id: ") || strings.HasPrefix(line, "data: ") {
+			current = append(current, line)
+		}
+	}
+	if len(events) < n {
+		t.Fatalf("Expected %d events, got %v (%v)", n, events, scanner.Err())
+	}
+	return events
+}
+
+func TestSSERoute(t *testing.T) {
+	events := []config.SSEEvent{
+		{ID: "1", Data: "first", Retry: 1000},
+		{ID: "2", Event: "notice", Data: "second"},
+		{ID: "3", Data: "third", Delay: 20},
+	}
+	cfg := config.DefaultConfig()
+	cfg.CORS = config.CORSConfig{AllowOrigins: []string{"https://app.example.com"}, AllowCredentials: true}
+	cfg.Routes = []config.Route{
+		{Path: "/events", Type: "sse", Events: events},
+		{Path: "/ticker", Type: "sse", Events: events, Loop: true},
+		{Path: "/gone", Type: "sse", Events: events, Status: http.StatusNoContent},
+	}
+	server := New(cfg)
+	if err := server.setupRoutes(); err != nil {
+		t.Fatalf("Expected routes to be set up, got %v", err)
+	}
+	ts := httptest.NewServer(server.mux)
+	defer ts.Close()
+
+	open := func(t *testing.T, path string, headers map[string]string) (*http.Response, *bufio.Scanner) {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodGet, ts.URL+path, nil)
+		for name, value := range headers {
+			req.Header.Set(name, value)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		t.Cleanup(func() { resp.Body.Close() })
+		return resp, bufio.NewScanner(resp.Body)
+	}
+
+	t.Run("stream", func(t *testing.T) {
+		resp, scanner := open(t, "/events", map[string]string{"Origin": "https://app.example.com"})
+		if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" || resp.Header.Get("Cache-Control") != "no-cache" {
+			t.Fatalf("Unexpected response: %d %v", resp.StatusCode, resp.Header)
+		}
+		// EventSource with credentials needs the exact origin
+		if resp.Header.Get("Access-Control-Allow-Origin") != "https://app.example.com" || resp.Header.Get("Access-Control-Allow-Credentials") != "true" || resp.Header.Get("Vary") != "Origin" {
+			t.Errorf("Unexpected CORS headers: %v", resp.Header)
+		}
+
+		got := readEvents(t, scanner, 3)
+		expected := []string{"id: 1|data: first", "id: 2|data: second", "id: 3|data: third"}
+		if strings.Join(got, ",") != strings.Join(expected, ",") {
+			t.Errorf("Expected %v, got %v", expected, got)
+		}
+	})
+
+	t.Run("resume after last event id", func(t *testing.T) {
+		_, scanner := open(t, "/events", map[string]string{"Last-Event-ID": "2"})
+		if got := readEvents(t, scanner, 1); got[0] != "id: 3|data: third" {
+			t.Errorf("Expected to resume with event 3, got %v", got)
+		}
+	})
+
+	t.Run("resume with query parameter", func(t *testing.T) {
+		_, scanner := open(t, "/events?lastEventId=1", nil)
+		if got := readEvents(t, scanner, 1); got[0] != "id: 2|data: second" {
+			t.Errorf("Expected to resume with event 2, got %v", got)
+		}
+	})
+
+	t.Run("loop", func(t *testing.T) {
+		_, scanner := open(t, "/ticker", nil)
+		got := readEvents(t, scanner, 5)
+		if got[3] != "id: 1|data: first" || got[4] != "id: 2|data: second" {
+			t.Errorf("Expected the events to start over, got %v", got)
+		}
+	})
+
+	t.Run("status", func(t *testing.T) {
+		resp, _ := open(t, "/gone", nil)
+		if resp.StatusCode != http.StatusNoContent {
+			t.Errorf("Expected 204, got %d", resp.StatusCode)
+		}
+	})
+
+	t.Run("delay", func(t *testing.T) {
+		start := time.Now()
+		_, scanner := open(t, "/events?lastEventId=2", nil)
+		readEvents(t, scanner, 1)
+		if elapsed := time.Since(start); elapsed < 20*time.Millisecond {
+			t.Errorf("Expected the event after its delay, got it after %v", elapsed)
+		}
+	})
+}
+
+func TestSSERouteWithResponseValidation(t *testing.T) {
+	spec := filepath.Join(t.TempDir(), "spec.yaml")
+	content := `openapi: 3.0.3
+info: {title: Events, version: "1"}
+paths:
+  /events:
+    get:
+      parameters:
+        - {name: topic, in: query, schema: {type: integer}}
+      responses:
+        "200":
+          description: ok
+          content:
+            text/event-stream:
+              schema: {type: string}
+`
+	if err := os.WriteFile(spec, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write spec: %v", err)
+	}
+
+	cfg := config.DefaultConfig()
+	cfg.OpenAPI = config.OpenAPIConfig{Spec: spec, Validate: "enforce", ValidateResponses: true}
+	cfg.Routes = []config.Route{
+		{Path: "/events", Type: "sse", Events: []config.SSEEvent{{ID: "1", Data: "first"}, {ID: "2", Data: "second"}}},
+	}
+	server := New(cfg)
+	if err := server.setupOpenAPI(); err != nil {
+		t.Fatalf("Expected spec to load, got %v", err)
+	}
+	if err := server.setupRoutes(); err != nil {
+		t.Fatalf("Expected routes to be set up, got %v", err)
+	}
+	ts := httptest.NewServer(server.mux)
+	defer ts.Close()
+
+	// Events are streamed rather than buffered for response validation
+	resp, err := http.Get(ts.URL + "/events?topic=1")
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", resp.StatusCode)
+	}
+	got := readEvents(t, bufio.NewScanner(resp.Body), 2)
+	if got[0] != "id: 1|data: first" || got[1] != "id: 2|data: second" {
+		t.Errorf("Unexpected events: %v", got)
+	}
+
+	// Requests are still checked
+	invalid, err := http.Get(ts.URL + "/events?topic=abc")
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	invalid.Body.Close()
+	if invalid.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an invalid request, got %d", invalid.StatusCode)
+	}
+}
@@ -0,0 +1,199 @@
+package server
+
+import (
+	"fmt"
+	"html"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/developmeh/mock-cors-server/internal/config"
+)
+
+// defaultIndexFiles are served for directory requests when a route lists none
+var defaultIndexFiles = []string{"index.html"}
+
+// staticDir serves the files of a directory below the path of a route
+type staticDir struct {
+	root        string // Directory, with symlinks resolved
+	segments    int    // Path segments of the route, stripped from requests
+	indexFiles  []string
+	listing     bool
+	spaFallback bool
+	contentType string // Overrides the detected content type when set
+}
+
+// newStaticDir prepares a static_dir route
+func newStaticDir(route config.Route) (*staticDir, error) {
+	if route.Dir == "" {
+		return nil, fmt.Errorf("dir is required for static_dir routes")
+	}
+	root, err := filepath.Abs(route.Dir)
+	if err == nil {
+		root, err = filepath.EvalSymlinks(root)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	indexFiles := route.IndexFiles
+	if len(indexFiles) == 0 {
+		indexFiles = defaultIndexFiles
+	}
+
+	return &staticDir{
+		root:        root,
+		segments:    strings.Count(strings.TrimSuffix(route.Path, "/"), "/"),
+		indexFiles:  indexFiles,
+		listing:     route.Listing,
+		spaFallback: route.SPAFallback,
+		contentType: route.ContentType,
+	}, nil
+}
+
+// serveStaticDir answers a GET or HEAD request with a file, an index file or a
+// directory listing
+func (s *Server) serveStaticDir(w http.ResponseWriter, r *http.Request, d *staticDir) {
+	rel := d.relativePath(r.URL.Path)
+	name, info, ok := d.resolve(rel)
+
+	if ok && info.IsDir() {
+		// Relative links of index files and listings need the trailing slash
+		if !strings.HasSuffix(r.URL.Path, "/") {
+			target := r.URL.Path + "/"
+			if r.URL.RawQuery != "" {
+				target += "?" + r.URL.RawQuery
+			}
+			http.Redirect(w, r, target, http.StatusMovedPermanently)
+			return
+		}
+		if index, found := d.index(name); found {
+			s.handleStaticFile(w, r, index, d.fileContentType(s, index))
+			return
+		}
+		if d.listing {
+			d.writeListing(w, r, name, rel)
+			return
+		}
+		ok = false
+	}
+
+	if !ok {
+		if d.spaFallback && wantsPage(r) {
+			if index, found := d.index(d.root); found {
+				s.handleStaticFile(w, r, index, d.fileContentType(s, index))
+				return
+			}
+		}
+		http.Error(w, "File not found", http.StatusNotFound)
+		return
+	}
+
+	s.handleStaticFile(w, r, name, d.fileContentType(s, name))
+}
+
+// relativePath strips the segments of the route from a request path,
+// returning a clean slash separated path without leading slash
+func (d *staticDir) relativePath(urlPath string) string {
+	rest := strings.TrimPrefix(urlPath, "/")
+	for i := 0; i < d.segments; i++ {
+		_, after, found := strings.Cut(rest, "/")
+		if !found {
+			return ""
+		}
+		rest = after
+	}
+	// Cleaning a rooted path drops every ".." that would climb above it
+	return strings.TrimPrefix(path.Clean("/"+rest), "/")
+}
+
+// resolve maps a relative path to a file below the root. Paths leaving the
+// root, directly or through symlinks, are reported as missing.
+func (d *staticDir) resolve(rel string) (string, os.FileInfo, bool) {
+	if strings.ContainsRune(rel, 0) || (filepath.Separator != '/' && strings.ContainsRune(rel, filepath.Separator)) {
+		return "", nil, false
+	}
+
+	name := filepath.Join(d.root, filepath.FromSlash(rel))
+	resolved, err := filepath.EvalSymlinks(name)
+	if err != nil || !within(d.root, resolved) {
+		return "", nil, false
+	}
+	info, err := os.Stat(resolved)
+	if err != nil {
+		return "", nil, false
+	}
+	return resolved, info, true
+}
+
+// index returns the first index file present in a directory
+func (d *staticDir) index(dir string) (string, bool) {
+	for _, name := range d.indexFiles {
+		file, err := filepath.EvalSymlinks(filepath.Join(dir, name))
+		if err != nil || !within(d.root, file) {
+			continue
+		}
+		if info, err := os.Stat(file); err == nil && info.Mode().IsRegular() {
+			return file, true
+		}
+	}
+	return "", false
+}
+
+// fileContentType returns the configured content type, or detects it from
+// the file name
+func (d *staticDir) fileContentType(s *Server, name string) string {
+	if d.contentType != "" {
+		return d.contentType
+	}
+	return s.getContentTypeFromFile(name)
+}
+
+// writeListing writes an HTML listing of a directory
+func (d *staticDir) writeListing(w http.ResponseWriter, r *http.Request, dir, rel string) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+
+	title := html.EscapeString(r.URL.Path)
+	var b strings.Builder
+	fmt.Fprintf(&b, "<!DOCTYPE html>\n<html>\n<head><meta charset=\"utf-8\"><title>Index of %s</title></head>\n<body>\n<h1>Index of %s</h1>\n<ul>\n", title, title)
+	if rel != "" {
+		b.WriteString("<li><a href=\"../\">../</a></li>\n")
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() {
+			name += "/"
+		}
+		link := url.URL{Path: name}
+		fmt.Fprintf(&b, "<li><a href=\"%s\">%s</a></li>\n", html.EscapeString(link.String()), html.EscapeString(name))
+	}
+	b.WriteString("</ul>\n</body>\n</html>\n")
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	if r.Method != http.MethodHead {
+		w.Write([]byte(b.String()))
+	}
+}
+
+// within reports whether name is root or below it
+func within(root, name string) bool {
+	rel, err := filepath.Rel(root, name)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// wantsPage reports whether a request for a missing file should get the
+// single-page application: navigations accept HTML, and client-side routes
+// rarely have an extension, unlike missing assets
+func wantsPage(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), "text/html") || path.Ext(r.URL.Path) == ""
+}
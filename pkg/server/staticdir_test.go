@@ -0,0 +1,144 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/developmeh/mock-cors-server/internal/config"
+)
+
+// writeFiles creates files below dir, keyed by slash separated path
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		file := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+}
+
+func TestServeStaticDir(t *testing.T) {
+	base := t.TempDir()
+	writeFiles(t, base, map[string]string{
+		"secret.txt":             "secret",
+		"app/index.html":         "<h1>app</h1>",
+		"app/assets/app.js":      "console.log(1)",
+		"app/assets/<b>&.css":    "body {}",
+		"app/docs/guide.txt":     "guide",
+		"app/docs/api/index.htm": "api",
+	})
+	app := filepath.Join(base, "app")
+	if err := os.Symlink(filepath.Join(base, "secret.txt"), filepath.Join(app, "leak.txt")); err != nil {
+		t.Fatalf("Failed to create symlink: %v", err)
+	}
+
+	cfg := &config.Config{
+		Routes: []config.Route{
+			{Path: "/app/", Type: "static_dir", Dir: app, SPAFallback: true},
+			{Path: "/t/{tenant}/docs/", Type: "static_dir", Dir: filepath.Join(app, "docs"), Listing: true, IndexFiles: []string{"index.htm"}},
+			{Path: "/plain/", Type: "static_dir", Dir: filepath.Join(app, "assets")},
+		},
+	}
+	server := New(cfg)
+	if err := server.setupRoutes(); err != nil {
+		t.Fatalf("Expected routes to be set up, got %v", err)
+	}
+
+	tests := []struct {
+		name                string
+		method              string
+		path                string
+		accept              string
+		expectedStatus      int
+		expectedBody        string
+		expectedContentType string
+	}{
+		{name: "file", method: http.MethodGet, path: "/app/assets/app.js", expectedStatus: http.StatusOK, expectedBody: "console.log(1)", expectedContentType: "application/javascript"},
+		{name: "index file", method: http.MethodGet, path: "/app/", expectedStatus: http.StatusOK, expectedBody: "<h1>app</h1>", expectedContentType: "text/html"},
+		{name: "head", method: http.MethodHead, path: "/app/assets/app.js", expectedStatus: http.StatusOK},
+		{name: "post", method: http.MethodPost, path: "/app/assets/app.js", expectedStatus: http.StatusMethodNotAllowed},
+		{name: "spa fallback", method: http.MethodGet, path: "/app/orders/42", expectedStatus: http.StatusOK, expectedBody: "<h1>app</h1>"},
+		{name: "spa fallback for navigations", method: http.MethodGet, path: "/app/users/jane.doe", accept: "text/html,*/*", expectedStatus: http.StatusOK, expectedBody: "<h1>app</h1>"},
+		{name: "missing asset", method: http.MethodGet, path: "/app/assets/missing.js", expectedStatus: http.StatusNotFound},
+		{name: "symlink leaving the directory", method: http.MethodGet, path: "/app/leak.txt", expectedStatus: http.StatusNotFound},
+		{name: "custom index file", method: http.MethodGet, path: "/t/acme/docs/api/", expectedStatus: http.StatusOK, expectedBody: "api"},
+		{name: "directory without index", method: http.MethodGet, path: "/plain/", expectedStatus: http.StatusNotFound},
+		{name: "directory redirect", method: http.MethodGet, path: "/t/acme/docs/api", expectedStatus: http.StatusMovedPermanently},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			w := httptest.NewRecorder()
+
+			server.mux.ServeHTTP(w, req)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+			if tt.expectedBody != "" && w.Body.String() != tt.expectedBody {
+				t.Errorf("Expected body %q, got %q", tt.expectedBody, w.Body.String())
+			}
+			if tt.expectedContentType != "" && w.Header().Get("Content-Type") != tt.expectedContentType {
+				t.Errorf("Expected content type %s, got %s", tt.expectedContentType, w.Header().Get("Content-Type"))
+			}
+		})
+	}
+
+	t.Run("listing", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/t/acme/docs/", nil)
+		w := httptest.NewRecorder()
+		server.mux.ServeHTTP(w, req)
+
+		body := w.Body.String()
+		if w.Code != http.StatusOK || !strings.Contains(body, `<a href="api/">api/</a>`) || !strings.Contains(body, `<a href="guide.txt">guide.txt</a>`) {
+			t.Errorf("Expected a listing, got %d %s", w.Code, body)
+		}
+	})
+
+	t.Run("listing escapes names", func(t *testing.T) {
+		cfg := &config.Config{Routes: []config.Route{{Path: "/files/", Type: "static_dir", Dir: filepath.Join(app, "assets"), Listing: true}}}
+		server := New(cfg)
+		if err := server.setupRoutes(); err != nil {
+			t.Fatalf("Expected routes to be set up, got %v", err)
+		}
+		w := httptest.NewRecorder()
+		server.mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/files/", nil))
+
+		if body := w.Body.String(); !strings.Contains(body, "&lt;b&gt;&amp;.css") || strings.Contains(body, "<b>") {
+			t.Errorf("Expected escaped names, got %s", body)
+		}
+	})
+}
+
+func TestStaticDirRelativePath(t *testing.T) {
+	d := &staticDir{segments: 2} // Route /{tenant}/docs/
+
+	tests := []struct {
+		path     string
+		expected string
+	}{
+		{path: "/acme/docs/", expected: ""},
+		{path: "/acme/docs/api/index.htm", expected: "api/index.htm"},
+		{path: "/acme/docs/../../../etc/passwd", expected: "etc/passwd"},
+		{path: "/acme/docs/a/./b//c", expected: "a/b/c"},
+		{path: "/acme", expected: ""},
+	}
+
+	for _, tt := range tests {
+		if got := d.relativePath(tt.path); got != tt.expected {
+			t.Errorf("relativePath(%q) = %q, expected %q", tt.path, got, tt.expected)
+		}
+	}
+}
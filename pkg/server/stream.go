@@ -0,0 +1,80 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/developmeh/mock-cors-server/internal/config"
+)
+
+// chunkStream sends the body of a stream route chunk by chunk
+type chunkStream struct {
+	chunks      []config.StreamChunk
+	contentType string
+	status      int
+}
+
+// newChunkStream prepares a stream route. Chunks of NDJSON streams get the
+// line break ending them when they lack one.
+func newChunkStream(route config.Route, contentType string) (*chunkStream, error) {
+	if len(route.Chunks) == 0 {
+		return nil, fmt.Errorf("chunks are required for stream routes")
+	}
+
+	chunks := route.Chunks
+	if config.IsNDJSON(contentType) {
+		chunks = make([]config.StreamChunk, len(route.Chunks))
+		for i, chunk := range route.Chunks {
+			if !strings.HasSuffix(chunk.Data, "\n") {
+				chunk.Data += "\n"
+			}
+			chunks[i] = chunk
+		}
+	}
+
+	status := route.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	return &chunkStream{chunks: chunks, contentType: contentType, status: status}, nil
+}
+
+// serve writes the chunks after their delays, flushing each one so clients
+// read it as soon as it is sent. Without a Content-Length the body goes out
+// with chunked transfer encoding over HTTP/1.1.
+func (cs *chunkStream) serve(w http.ResponseWriter, r *http.Request) {
+	header := w.Header()
+	header.Set("Content-Type", cs.contentType)
+	header.Set("X-Content-Type-Options", "nosniff") // Browsers buffer text they sniff
+	header.Set("X-Accel-Buffering", "no")           // Keep reverse proxies from buffering the stream
+	w.WriteHeader(cs.status)
+
+	if r.Method == http.MethodHead {
+		return
+	}
+	rc := http.NewResponseController(w)
+	if err := rc.Flush(); err != nil {
+		fmt.Printf("Warning: %s cannot stream chunks: %v\n", r.URL.Path, err)
+		return
+	}
+	for _, chunk := range cs.chunks {
+		if chunk.Delay > 0 {
+			timer := time.NewTimer(time.Duration(chunk.Delay) * time.Millisecond)
+			select {
+			case <-r.Context().Done():
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+		}
+
+		if _, err := w.Write([]byte(chunk.Data)); err != nil {
+			return
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package server
+
+import (
+	"bufio"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/developmeh/mock-cors-server/internal/config"
+)
+
+func TestNewChunkStream(t *testing.T) {
+	route := config.Route{Path: "/tokens", Type: "stream", Chunks: []config.StreamChunk{{Data: `{"token": "Hel"}`}, {Data: "{\"token\": \"lo\"}\n"}}}
+
+	cs, err := newChunkStream(route, "application/x-ndjson")
+	if err != nil {
+		t.Fatalf("Expected stream, got %v", err)
+	}
+	// NDJSON chunks end with exactly one line break
+	if cs.chunks[0].Data != "{\"token\": \"Hel\"}\n" || cs.chunks[1].Data != "{\"token\": \"lo\"}\n" {
+		t.Errorf("Unexpected chunks: %q", cs.chunks)
+	}
+	if route.Chunks[0].Data != `{"token": "Hel"}` {
+		t.Error("Expected the route's chunks to be left alone")
+	}
+
+	cs, _ = newChunkStream(route, "text/plain")
+	if cs.chunks[0].Data != `{"token": "Hel"}` {
+		t.Errorf("Expected plain chunks as is, got %q", cs.chunks[0].Data)
+	}
+
+	if _, err := newChunkStream(config.Route{Path: "/empty", Type: "stream"}, "text/plain"); err == nil {
+		t.Error("Expected an error without chunks")
+	}
+}
+
+func TestStreamRoute(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.Routes = []config.Route{
+		{Path: "/completion", Type: "stream", Methods: []string{http.MethodPost}, ContentType: "application/x-ndjson", Chunks: []config.StreamChunk{
+			{Data: `{"token": "Hello"}`},
+			{Data: `{"token": " world"}`, Delay: 50},
+			{Data: `{"done": true}`},
+		}},
+		{Path: "/text", Type: "stream", Chunks: []config.StreamChunk{{Data: "one "}, {Data: "two"}}},
+	}
+	server := New(cfg)
+	if err := server.setupRoutes(); err != nil {
+		t.Fatalf("Expected routes to be set up, got %v", err)
+	}
+	ts := httptest.NewServer(server.mux)
+	defer ts.Close()
+
+	t.Run("ndjson", func(t *testing.T) {
+		start := time.Now()
+		resp, err := http.Post(ts.URL+"/completion", "application/json", nil)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		defer resp.Body.Close()
+		if resp.Header.Get("Content-Type") != "application/x-ndjson" || len(resp.TransferEncoding) == 0 || resp.TransferEncoding[0] != "chunked" {
+			t.Errorf("Expected a chunked NDJSON response, got %v %v", resp.Header, resp.TransferEncoding)
+		}
+
+		reader := bufio.NewReader(resp.Body)
+		line, _ := reader.ReadString('\n')
+		if line != "{\"token\": \"Hello\"}\n" {
+			t.Errorf("Expected the first token, got %q", line)
+		}
+		// The first chunk arrives before the delay of the second
+		if elapsed := time.Since(start); elapsed >= 50*time.Millisecond {
+			t.Errorf("Expected the first chunk right away, got it after %v", elapsed)
+		}
+
+		rest, _ := io.ReadAll(reader)
+		if string(rest) != "{\"token\": \" world\"}\n{\"done\": true}\n" {
+			t.Errorf("Unexpected rest of the stream: %q", rest)
+		}
+		if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+			t.Errorf("Expected the stream to honour the delay, ended after %v", elapsed)
+		}
+	})
+
+	t.Run("text", func(t *testing.T) {
+		resp, err := http.Get(ts.URL + "/text")
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		if string(body) != "one two" || resp.Header.Get("Content-Type") != "text/plain; charset=utf-8" || resp.Header.Get("X-Content-Type-Options") != "nosniff" {
+			t.Errorf("Unexpected response: %q %v", body, resp.Header)
+		}
+	})
+
+	t.Run("head", func(t *testing.T) {
+		resp, err := http.Head(ts.URL + "/text")
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("Expected 200, got %d", resp.StatusCode)
+		}
+	})
+}
+
+func TestStreamRouteWithResponseValidation(t *testing.T) {
+	spec := filepath.Join(t.TempDir(), "spec.yaml")
+	content := `openapi: 3.0.3
+info: {title: Completions, version: "1"}
+paths:
+  /completion:
+    post:
+      parameters:
+        - {name: model, in: query, schema: {type: integer}}
+      responses:
+        "200":
+          description: ok
+          content:
+            application/x-ndjson:
+              schema: {type: string}
+`
+	if err := os.WriteFile(spec, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write spec: %v", err)
+	}
+
+	cfg := config.DefaultConfig()
+	cfg.OpenAPI = config.OpenAPIConfig{Spec: spec, Validate: "enforce", ValidateResponses: true}
+	cfg.Routes = []config.Route{
+		{Path: "/completion", Type: "stream", Methods: []string{http.MethodPost}, ContentType: "application/x-ndjson", Chunks: []config.StreamChunk{
+			{Data: `{"token": "Hello"}`},
+			{Data: `{"done": true}`},
+		}},
+	}
+	server := New(cfg)
+	if err := server.setupOpenAPI(); err != nil {
+		t.Fatalf("Expected spec to load, got %v", err)
+	}
+	if err := server.setupRoutes(); err != nil {
+		t.Fatalf("Expected routes to be set up, got %v", err)
+	}
+	ts := httptest.NewServer(server.mux)
+	defer ts.Close()
+
+	// Chunks are streamed rather than buffered for response validation
+	resp, err := http.Post(ts.URL+"/completion?model=1", "application/json", nil)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || string(body) != "{\"token\": \"Hello\"}\n{\"done\": true}\n" {
+		t.Errorf("Expected the chunks, got %d %q", resp.StatusCode, body)
+	}
+
+	// Requests are still checked
+	invalid, err := http.Post(ts.URL+"/completion?model=abc", "application/json", nil)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	invalid.Body.Close()
+	if invalid.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an invalid request, got %d", invalid.StatusCode)
+	}
+}
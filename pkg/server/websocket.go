@@ -0,0 +1,206 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/developmeh/mock-cors-server/internal/config"
+)
+
+// closeTimeout bounds the wait for the client to answer a close frame
+const closeTimeout = time.Second
+
+// trackUpgrades counts the WebSocket connections in progress, so shutdown
+// can let them close and be recorded
+func (s *Server) trackUpgrades(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+			next.ServeHTTP(w, r)
+			return
+		}
+		s.upgraded.Add(1)
+		defer s.upgraded.Done()
+		next.ServeHTTP(w, r)
+	})
+}
+
+// waitForUpgrades waits until the WebSocket connections are closed, or ctx
+// is done
+func (s *Server) waitForUpgrades(ctx context.Context) {
+	done := make(chan struct{})
+	go func() {
+		s.upgraded.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		fmt.Println("Warning: WebSocket connections did not close in time")
+	}
+}
+
+// webSocketScript plays the scripted conversation of a websocket route
+type webSocketScript struct {
+	upgrader  websocket.Upgrader
+	onConnect []config.WebSocketMessage
+	replies   []webSocketReply
+	status    int
+}
+
+// webSocketReply is a message sent in reply to inbound messages matching
+// its pattern
+type webSocketReply struct {
+	pattern *regexp.Regexp
+	message config.WebSocketMessage
+}
+
+// newWebSocketScript prepares a websocket route. Browsers do not apply CORS
+// to WebSockets, so the handshake's Origin is checked against the allowed
+// origins instead.
+func newWebSocketScript(route config.Route, cors config.CORSConfig) (*webSocketScript, error) {
+	ws := &webSocketScript{status: route.Status}
+	for i, message := range route.Messages {
+		if message.Match == "" {
+			ws.onConnect = append(ws.onConnect, message)
+			continue
+		}
+		pattern, err := regexp.Compile(message.Match)
+		if err != nil {
+			return nil, fmt.Errorf("messages[%d]: invalid pattern: %w", i, err)
+		}
+		ws.replies = append(ws.replies, webSocketReply{pattern: pattern, message: message})
+	}
+
+	ws.upgrader = websocket.Upgrader{
+		Subprotocols: route.Subprotocols,
+		CheckOrigin: func(r *http.Request) bool {
+			// Clients other than browsers usually send no origin
+			origin := r.Header.Get("Origin")
+			if origin == "" || contains(cors.AllowOrigins, origin) || contains(cors.AllowOrigins, "*") {
+				return true
+			}
+			fmt.Printf("Warning: %s rejected WebSocket connection from origin %s\n", r.URL.Path, origin)
+			return false
+		},
+	}
+	return ws, nil
+}
+
+// serve upgrades the connection and plays the script until either side
+// closes it or the server shuts down. A status other than 101 rejects the
+// handshake, as an overloaded or failing server would.
+func (ws *webSocketScript) serve(w http.ResponseWriter, r *http.Request) {
+	if ws.status != 0 && ws.status != http.StatusSwitchingProtocols {
+		w.WriteHeader(ws.status)
+		return
+	}
+
+	// Headers set for the route, such as route headers and cookies, go with the handshake
+	conn, err := ws.upgrader.Upgrade(w, r, w.Header().Clone())
+	if err != nil {
+		return // The upgrader answered the request
+	}
+	defer conn.Close()
+
+	c := &webSocketConn{conn: conn, r: r}
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-r.Context().Done():
+			c.close(websocket.CloseGoingAway)
+		case <-done:
+		}
+	}()
+
+	go func() {
+		for _, message := range ws.onConnect {
+			if !c.send(message) {
+				return
+			}
+		}
+	}()
+
+	for {
+		messageType, data, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		recordWebSocketMessage(r, true, messageType, data)
+		if messageType != websocket.TextMessage {
+			continue
+		}
+		for _, reply := range ws.replies {
+			if reply.pattern.Match(data) {
+				go c.send(reply.message)
+				break
+			}
+		}
+	}
+}
+
+// webSocketConn serializes the writes of scripted messages to a connection
+type webSocketConn struct {
+	conn   *websocket.Conn
+	r      *http.Request
+	mu     sync.Mutex
+	closed bool
+}
+
+// send writes a message after its delay, closing the connection when the
+// message says so. It reports whether the connection is still open.
+func (c *webSocketConn) send(message config.WebSocketMessage) bool {
+	if message.Delay > 0 {
+		timer := time.NewTimer(time.Duration(message.Delay) * time.Millisecond)
+		select {
+		case <-c.r.Context().Done():
+			timer.Stop()
+			return false
+		case <-timer.C:
+		}
+	}
+
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return false
+	}
+	if message.Send != "" {
+		// Recorded first, as the client may answer before the write returns,
+		// and dropped again when it fails
+		drop := recordWebSocketMessage(c.r, false, websocket.TextMessage, []byte(message.Send))
+		if err := c.conn.WriteMessage(websocket.TextMessage, []byte(message.Send)); err != nil {
+			drop()
+			c.mu.Unlock()
+			return false
+		}
+	}
+	c.mu.Unlock()
+
+	if message.Close != 0 {
+		c.close(message.Close)
+		return false
+	}
+	return true
+}
+
+// close starts the closing handshake; the read loop ends once the client
+// answers, or after closeTimeout
+func (c *webSocketConn) close(code int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return
+	}
+	c.closed = true
+	deadline := time.Now().Add(closeTimeout)
+	c.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, ""), deadline)
+	c.conn.SetReadDeadline(deadline)
+}
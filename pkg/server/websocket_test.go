@@ -0,0 +1,164 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/developmeh/mock-cors-server/internal/config"
+	"github.com/developmeh/mock-cors-server/internal/har"
+)
+
+func TestWebSocketRoute(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.CORS = config.CORSConfig{AllowOrigins: []string{"https://app.example.com"}}
+	cfg.Routes = []config.Route{
+		{Path: "/ws", Type: "websocket", Subprotocols: []string{"chat.v2", "chat.v1"}, Messages: []config.WebSocketMessage{
+			{Send: `{"type": "welcome"}`},
+			{Match: `"type":\s*"ping"`, Send: `{"type": "pong"}`},
+			{Match: `^bye$`, Send: "goodbye", Close: websocket.CloseNormalClosure},
+			{Match: `slow`, Send: "finally", Delay: 30},
+		}},
+		{Path: "/open", Type: "websocket", CORS: &config.CORSConfig{AllowOrigins: []string{"*"}}},
+		{Path: "/kick", Type: "websocket", Messages: []config.WebSocketMessage{{Close: 4001, Delay: 10}}},
+		{Path: "/down", Type: "websocket", Status: http.StatusServiceUnavailable},
+	}
+	server := New(cfg)
+	if err := server.setupRoutes(); err != nil {
+		t.Fatalf("Expected routes to be set up, got %v", err)
+	}
+	ts := httptest.NewServer(server.recorder.middleware(server.mux))
+	defer ts.Close()
+	wsURL := "ws" + strings.TrimPrefix(ts.URL, "http")
+
+	dial := func(t *testing.T, path string, header http.Header) (*websocket.Conn, *http.Response, error) {
+		t.Helper()
+		dialer := websocket.Dialer{Subprotocols: []string{"chat.v1", "chat.v2"}}
+		conn, resp, err := dialer.Dial(wsURL+path, header)
+		if err == nil {
+			t.Cleanup(func() { conn.Close() })
+		}
+		return conn, resp, err
+	}
+	read := func(t *testing.T, conn *websocket.Conn) string {
+		t.Helper()
+		conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatalf("Failed to read message: %v", err)
+		}
+		return string(data)
+	}
+
+	t.Run("conversation", func(t *testing.T) {
+		conn, resp, err := dial(t, "/ws", http.Header{"Origin": {"https://app.example.com"}})
+		if err != nil {
+			t.Fatalf("Failed to connect: %v", err)
+		}
+		if conn.Subprotocol() != "chat.v2" {
+			t.Errorf("Expected the preferred subprotocol chat.v2, got %q", conn.Subprotocol())
+		}
+		if resp.Header.Get("Access-Control-Allow-Origin") != "https://app.example.com" {
+			t.Errorf("Expected the route headers on the handshake, got %v", resp.Header)
+		}
+		if got := read(t, conn); got != `{"type": "welcome"}` {
+			t.Errorf("Expected the welcome message, got %q", got)
+		}
+
+		conn.WriteMessage(websocket.TextMessage, []byte(`{"type": "ping"}`))
+		if got := read(t, conn); got != `{"type": "pong"}` {
+			t.Errorf("Expected pong, got %q", got)
+		}
+
+		// Unmatched messages are not answered
+		conn.WriteMessage(websocket.TextMessage, []byte("hello"))
+		start := time.Now()
+		conn.WriteMessage(websocket.TextMessage, []byte("slow"))
+		if got := read(t, conn); got != "finally" || time.Since(start) < 30*time.Millisecond {
+			t.Errorf("Expected the delayed reply, got %q after %v", got, time.Since(start))
+		}
+
+		conn.WriteMessage(websocket.TextMessage, []byte("bye"))
+		if got := read(t, conn); got != "goodbye" {
+			t.Errorf("Expected goodbye, got %q", got)
+		}
+		_, _, err = conn.ReadMessage()
+		if !websocket.IsCloseError(err, websocket.CloseNormalClosure) {
+			t.Errorf("Expected a normal closure, got %v", err)
+		}
+	})
+
+	t.Run("origin rejected", func(t *testing.T) {
+		_, resp, err := dial(t, "/ws", http.Header{"Origin": {"https://evil.example.com"}})
+		if !errors.Is(err, websocket.ErrBadHandshake) || resp.StatusCode != http.StatusForbidden {
+			t.Errorf("Expected 403, got %v", err)
+		}
+	})
+
+	t.Run("route origins", func(t *testing.T) {
+		if _, _, err := dial(t, "/open", http.Header{"Origin": {"https://evil.example.com"}}); err != nil {
+			t.Errorf("Expected any origin to connect, got %v", err)
+		}
+	})
+
+	t.Run("closed by server", func(t *testing.T) {
+		conn, _, err := dial(t, "/kick", nil)
+		if err != nil {
+			t.Fatalf("Failed to connect: %v", err)
+		}
+		conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		_, _, err = conn.ReadMessage()
+		if !websocket.IsCloseError(err, 4001) {
+			t.Errorf("Expected close code 4001, got %v", err)
+		}
+	})
+
+	t.Run("rejected handshake", func(t *testing.T) {
+		_, resp, err := dial(t, "/down", nil)
+		if err == nil || resp.StatusCode != http.StatusServiceUnavailable {
+			t.Errorf("Expected 503, got %v", err)
+		}
+	})
+
+	t.Run("not a websocket", func(t *testing.T) {
+		resp, err := http.Get(ts.URL + "/ws")
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("Expected 400, got %d", resp.StatusCode)
+		}
+	})
+
+	t.Run("recorded", func(t *testing.T) {
+		// The entry is added once the server has seen the connection close
+		var entry *har.Entry
+		for deadline := time.Now().Add(2 * time.Second); entry == nil && time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+			for _, e := range server.recorder.archive().Log.Entries {
+				if strings.HasSuffix(e.Request.URL, "/ws") && e.ResourceType == "websocket" {
+					entry = &e
+				}
+			}
+		}
+		if entry == nil {
+			t.Fatal("Expected the conversation to be recorded")
+		}
+		if entry.Response.Status != http.StatusSwitchingProtocols {
+			t.Errorf("Expected status 101, got %d", entry.Response.Status)
+		}
+		var got []string
+		for _, m := range entry.WebSocketMessages {
+			got = append(got, m.Type+" "+m.Data)
+		}
+		expected := []string{`receive {"type": "welcome"}`, `send {"type": "ping"}`, `receive {"type": "pong"}`, "send hello", "send slow", "receive finally", "send bye", "receive goodbye"}
+		if strings.Join(got, ",") != strings.Join(expected, ",") {
+			t.Errorf("Expected messages %v, got %v", expected, got)
+		}
+	})
+}